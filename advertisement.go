@@ -0,0 +1,82 @@
+package minissdpc
+
+import "strings"
+
+// A DeviceAdvertisement describes a UPnP device and the services it
+// offers. It expands into the full set of SSDP advertisements that
+// the UPnP Device Architecture requires for the device.
+type DeviceAdvertisement struct {
+	// UUID identifies the device, with or without the "uuid:" prefix
+	UUID string
+
+	// DeviceType is the device's URN, e.g. urn:Belkin:device:controllee:1
+	DeviceType string
+
+	// ServiceTypes lists the URNs of the services offered by the device
+	ServiceTypes []string
+
+	// Devices holds any embedded devices. If their Location or
+	// Server are empty, they are inherited from the parent.
+	Devices []DeviceAdvertisement
+
+	Location string
+	Server   string
+}
+
+// Services returns the Service entries that must be registered to
+// advertise the device: upnp:rootdevice, uuid:<UUID>, the device type
+// and each service type, followed by the entries for every embedded
+// device. Duplicate service types within a device are only advertised once.
+func (d *DeviceAdvertisement) Services() []Service {
+	services := []Service{{
+		Type:     NTRootDevice,
+		USN:      d.uuid() + "::" + NTRootDevice,
+		Server:   d.Server,
+		Location: d.Location,
+	}}
+	return d.appendServices(services, d.Location, d.Server)
+}
+
+func (d *DeviceAdvertisement) appendServices(services []Service, location, server string) []Service {
+	if d.Location != "" {
+		location = d.Location
+	}
+	if d.Server != "" {
+		server = d.Server
+	}
+	uuid := d.uuid()
+
+	add := func(nt, usn string) {
+		services = append(services, Service{
+			Type:     nt,
+			USN:      usn,
+			Server:   server,
+			Location: location,
+		})
+	}
+
+	add(uuid, uuid)
+	add(d.DeviceType, uuid+"::"+d.DeviceType)
+
+	seen := make(map[string]bool, len(d.ServiceTypes))
+	for _, t := range d.ServiceTypes {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		add(t, uuid+"::"+t)
+	}
+
+	for i := range d.Devices {
+		services = d.Devices[i].appendServices(services, location, server)
+	}
+	return services
+}
+
+// uuid returns the device UUID in its "uuid:" prefixed form
+func (d *DeviceAdvertisement) uuid() string {
+	if strings.HasPrefix(d.UUID, "uuid:") {
+		return d.UUID
+	}
+	return "uuid:" + d.UUID
+}
@@ -0,0 +1,61 @@
+package minissdpc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDeviceAdvertisementServices(t *testing.T) {
+	const (
+		location = "http://192.168.1.10:49153/setup.xml"
+		server   = "Linux/3.10 UPnP/1.0 minissdpc/1.0"
+	)
+
+	d := DeviceAdvertisement{
+		UUID:       "Socket-1_0-221517K0101769",
+		DeviceType: "urn:Belkin:device:controllee:1",
+		ServiceTypes: []string{
+			"urn:Belkin:service:basicevent:1",
+			"urn:Belkin:service:metainfo:1",
+			"urn:Belkin:service:basicevent:1",
+		},
+		Devices: []DeviceAdvertisement{
+			{
+				UUID:         "uuid:Sensor-1_0-221517K0101770",
+				DeviceType:   "urn:Belkin:device:sensor:1",
+				ServiceTypes: []string{"urn:Belkin:service:basicevent:1"},
+				Location:     "http://192.168.1.10:49154/setup.xml",
+			},
+		},
+		Location: location,
+		Server:   server,
+	}
+
+	root := "uuid:Socket-1_0-221517K0101769"
+	embedded := "uuid:Sensor-1_0-221517K0101770"
+	embeddedLocation := "http://192.168.1.10:49154/setup.xml"
+
+	expect := []Service{
+		{NTRootDevice, root + "::upnp:rootdevice", server, location},
+		{root, root, server, location},
+		{"urn:Belkin:device:controllee:1", root + "::urn:Belkin:device:controllee:1", server, location},
+		{"urn:Belkin:service:basicevent:1", root + "::urn:Belkin:service:basicevent:1", server, location},
+		{"urn:Belkin:service:metainfo:1", root + "::urn:Belkin:service:metainfo:1", server, location},
+		{embedded, embedded, server, embeddedLocation},
+		{"urn:Belkin:device:sensor:1", embedded + "::urn:Belkin:device:sensor:1", server, embeddedLocation},
+		{"urn:Belkin:service:basicevent:1", embedded + "::urn:Belkin:service:basicevent:1", server, embeddedLocation},
+	}
+
+	out := d.Services()
+	if !reflect.DeepEqual(out, expect) {
+		t.Logf("expected: %v\n", expect)
+		t.Logf("     got: %v\n", out)
+		t.Fatal("mismatched services from advertisement")
+	}
+
+	for _, s := range out {
+		if err := s.Validate(); err != nil {
+			t.Errorf("generated service failed validation: %v", err)
+		}
+	}
+}
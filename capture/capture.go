@@ -0,0 +1,263 @@
+// Package capture stores sessions between minissdpd clients and the
+// daemon, as recorded by the proxy package, and replays them to
+// clients. A capture of a real daemon's responses can then be used
+// as a deterministic test fixture.
+//
+// A capture file is JSON. Each session holds the exchanges of one
+// connection, in order: the bytes of a request, hex encoded, and the
+// bytes the daemon sent in response. Notifications sent to a
+// subscribed client are exchanges without a request. The summary of
+// an exchange describes it for humans, and is not used for replay.
+// Sessions are written as they end, and their ids give the order in
+// which they began, which is the order in which they are replayed.
+//
+//	{
+//	  "version": 1,
+//	  "sessions": [
+//	    {
+//	      "id": 1,
+//	      "exchanges": [
+//	        {
+//	          "summary": "all: 0 services",
+//	          "request": "030100",
+//	          "response": "00"
+//	        }
+//	      ]
+//	    }
+//	  ]
+//	}
+package capture
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/forfuncsake/minissdpc/proxy"
+)
+
+// fileVersion is the version of the capture file format
+const fileVersion = 1
+
+// Bytes are encoded in JSON as a hex string
+type Bytes []byte
+
+// MarshalJSON encodes the bytes as a hex string
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(b))
+}
+
+// UnmarshalJSON decodes a hex string into the bytes
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := hex.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("invalid hex bytes: %v", err)
+	}
+	*b = decoded
+	return nil
+}
+
+// A File holds recorded sessions
+type File struct {
+	Version  int       `json:"version"`
+	Sessions []Session `json:"sessions"`
+}
+
+// A Session holds the exchanges of a single connection
+type Session struct {
+	// ID numbers the sessions in the order they began
+	ID        int        `json:"id,omitempty"`
+	Exchanges []Exchange `json:"exchanges"`
+}
+
+// An Exchange is a request and the daemon's response to it.
+// Either may be empty: registrations are not answered, and
+// notifications are not requested.
+type Exchange struct {
+	Summary  string `json:"summary,omitempty"`
+	Request  Bytes  `json:"request,omitempty"`
+	Response Bytes  `json:"response,omitempty"`
+}
+
+// Read parses a capture file, and orders its sessions by ID
+func Read(r io.Reader) (*File, error) {
+	f := &File{}
+	if err := json.NewDecoder(r).Decode(f); err != nil {
+		return nil, fmt.Errorf("could not parse capture: %v", err)
+	}
+	if f.Version != fileVersion {
+		return nil, fmt.Errorf("capture has unsupported version %d", f.Version)
+	}
+	sort.SliceStable(f.Sessions, func(i, j int) bool {
+		return f.Sessions[i].ID < f.Sessions[j].ID
+	})
+	return f, nil
+}
+
+// ReadFile parses the capture file at path
+func ReadFile(path string) (*File, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read capture: %v", err)
+	}
+	defer r.Close()
+	return Read(r)
+}
+
+// Write writes f as an indented capture file
+func Write(w io.Writer, f *File) error {
+	f.Version = fileVersion
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode capture: %v", err)
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// A Recorder builds a capture from the messages of a proxy.
+// Its Add method can be used as, or called from, proxy.Proxy.Log.
+type Recorder struct {
+	mu       sync.Mutex
+	sessions map[int]*Session
+
+	// w, if set, is written each session as it ends,
+	// which is then forgotten
+	w       io.Writer
+	written int
+	err     error
+}
+
+// NewRecorder returns an empty Recorder, which keeps every session
+// in memory until File is called
+func NewRecorder() *Recorder {
+	return &Recorder{sessions: make(map[int]*Session)}
+}
+
+// NewFileRecorder returns a Recorder that writes a capture file to w,
+// adding each session as it ends so that only the sessions in progress
+// are held in memory. Close must be called to complete the file.
+func NewFileRecorder(w io.Writer) (*Recorder, error) {
+	r := &Recorder{sessions: make(map[int]*Session), w: w}
+	_, err := fmt.Fprintf(w, "{\n  \"version\": %d,\n  \"sessions\": [", fileVersion)
+	return r, err
+}
+
+// Add records a message seen by a proxy
+func (r *Recorder) Add(m proxy.Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.sessions[m.Session]
+	if s == nil {
+		s = &Session{ID: m.Session}
+		r.sessions[m.Session] = s
+	}
+	if m.Kind == proxy.KindClose && r.w != nil {
+		delete(r.sessions, m.Session)
+		r.write(s)
+		return
+	}
+	if len(m.Data) == 0 {
+		return
+	}
+
+	summary := strings.SplitN(m.String(), "\n", 2)[0]
+	// Drop the time, session and direction
+	if f := strings.SplitN(summary, " ", 5); len(f) == 5 {
+		summary = f[4]
+	}
+	if m.Kind != proxy.KindServices && len(m.Services) == 1 {
+		summary += " " + m.Services[0].USN
+	}
+
+	last := len(s.Exchanges) - 1
+	switch {
+	case m.From == proxy.FromClient:
+		s.Exchanges = append(s.Exchanges, Exchange{Summary: summary, Request: m.Data})
+	case m.Kind != proxy.KindNotification && last >= 0 && len(s.Exchanges[last].Request) > 0:
+		// A response, or more of one if it was relayed raw
+		e := &s.Exchanges[last]
+		if len(e.Response) == 0 {
+			e.Summary += ": " + summary
+		}
+		e.Response = append(e.Response, m.Data...)
+	default:
+		s.Exchanges = append(s.Exchanges, Exchange{Summary: summary, Response: m.Data})
+	}
+}
+
+// write adds s to the file written by the recorder.
+// It must be called with r.mu held.
+func (r *Recorder) write(s *Session) {
+	if r.err != nil {
+		return
+	}
+	b, err := json.MarshalIndent(s, "    ", "  ")
+	if err != nil {
+		r.err = fmt.Errorf("could not encode capture: %v", err)
+		return
+	}
+	sep := ",\n    "
+	if r.written == 0 {
+		sep = "\n    "
+	}
+	r.written++
+	if _, err := io.WriteString(r.w, sep); err != nil {
+		r.err = err
+		return
+	}
+	_, r.err = r.w.Write(b)
+}
+
+// Close writes the sessions still in progress, in the order they
+// began, and completes the file of a Recorder returned by
+// NewFileRecorder. It returns the first error met writing the file.
+func (r *Recorder) Close() error {
+	if r.w == nil {
+		return nil
+	}
+	f := r.File()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range f.Sessions {
+		r.write(&f.Sessions[i])
+	}
+	r.sessions = make(map[int]*Session)
+	if r.err == nil {
+		_, r.err = io.WriteString(r.w, "\n  ]\n}\n")
+	}
+	return r.err
+}
+
+// File returns the sessions recorded so far, in the order they began.
+// For a Recorder returned by NewFileRecorder, these are only the
+// sessions in progress, as the others have been written.
+func (r *Recorder) File() *File {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]int, 0, len(r.sessions))
+	for id := range r.sessions {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	f := &File{Version: fileVersion, Sessions: []Session{}}
+	for _, id := range ids {
+		s := *r.sessions[id]
+		s.Exchanges = append([]Exchange(nil), s.Exchanges...)
+		f.Sessions = append(f.Sessions, s)
+	}
+	return f
+}
@@ -0,0 +1,189 @@
+package capture
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/forfuncsake/minissdpc"
+	"github.com/forfuncsake/minissdpc/mock"
+	"github.com/forfuncsake/minissdpc/proxy"
+)
+
+var testService = minissdpc.Service{
+	Type:     "urn:Belkin:device:controllee:1",
+	USN:      "uuid:Socket-1_0-221517K0101769::urn:Belkin:device:controllee:1",
+	Server:   "Unspecified, UPnP/1.0, Unspecified",
+	Location: "http://192.168.1.10:49153/setup.xml",
+}
+
+// record runs client against a mock daemon through a recording proxy
+func record(t *testing.T, client func(path string)) *File {
+	dir, err := ioutil.TempDir("", "ssdpc-capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	daemon := mock.NewServer(testService)
+	dl, err := net.Listen("unix", filepath.Join(dir, "minissdpd.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go daemon.Serve(dl)
+	defer daemon.Close()
+
+	rec := NewRecorder()
+	p := proxy.New(dl.Addr().String())
+	p.Log = rec.Add
+	path := filepath.Join(dir, "proxy.sock")
+	pl, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go p.Serve(pl)
+	defer p.Close()
+
+	client(path)
+
+	// The proxy logs each message before relaying it,
+	// so the client has seen nothing that is not recorded
+	return rec.File()
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	moved := testService
+	moved.Location = "http://192.168.1.11:49153/setup.xml"
+
+	var recorded []minissdpc.Service
+	f := record(t, func(path string) {
+		c := &minissdpc.Client{SocketPath: path}
+		if err := c.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		if err := c.RegisterService(moved); err != nil {
+			t.Fatal(err)
+		}
+		var err error
+		if recorded, err = c.GetServicesByType("urn:Belkin:"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if len(f.Sessions) != 1 || len(f.Sessions[0].Exchanges) != 2 {
+		t.Fatalf("unexpected capture %+v", f)
+	}
+	e := f.Sessions[0].Exchanges
+	if len(e[0].Response) != 0 || !strings.HasPrefix(e[0].Summary, "register ") {
+		t.Fatalf("unexpected register exchange %+v", e[0])
+	}
+	if !strings.Contains(e[1].Summary, "count=1") {
+		t.Fatalf("unexpected query exchange %+v", e[1])
+	}
+
+	// The capture survives a round trip through a file
+	var buf bytes.Buffer
+	if err := Write(&buf, f); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path, r, stop := serve(t, f)
+	defer stop()
+	c := &minissdpc.Client{SocketPath: path}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RegisterService(moved); err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := c.GetServicesByType("urn:Belkin:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(replayed, recorded) {
+		t.Fatalf("expected %v, got %v", recorded, replayed)
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	for _, content := range []string{
+		"{",
+		`{"version": 2, "sessions": []}`,
+		`{"version": 1, "sessions": [{"exchanges": [{"request": "0g"}]}]}`,
+	} {
+		if _, err := Read(strings.NewReader(content)); err == nil {
+			t.Fatalf("expected an error reading %s", content)
+		}
+	}
+}
+
+func TestFileRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	rec, err := NewFileRecorder(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := func(session int, b ...byte) {
+		rec.Add(proxy.Message{Session: session, From: proxy.FromClient, Kind: "all", Data: b})
+	}
+	rec.Add(proxy.Message{Session: 1, From: proxy.FromClient, Kind: proxy.KindOpen})
+	request(1, minissdpc.RequestTypeAll, 1, 0)
+	rec.Add(proxy.Message{Session: 2, From: proxy.FromClient, Kind: proxy.KindOpen})
+	request(2, minissdpc.RequestTypeAll, 1, 1)
+	rec.Add(proxy.Message{Session: 2, From: proxy.FromClient, Kind: proxy.KindClose})
+
+	// The ended session is written and no longer held
+	if !strings.Contains(buf.String(), `"id": 2`) || strings.Contains(buf.String(), `"id": 1`) {
+		t.Fatalf("expected only session 2 to be written, got %s", buf.String())
+	}
+	if f := rec.File(); len(f.Sessions) != 1 || f.Sessions[0].ID != 1 {
+		t.Fatalf("expected only session 1 to be held, got %+v", f.Sessions)
+	}
+
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sessions are read in the order they began
+	if len(f.Sessions) != 2 || f.Sessions[0].ID != 1 || f.Sessions[1].ID != 2 {
+		t.Fatalf("unexpected sessions %+v", f.Sessions)
+	}
+	if got := f.Sessions[1].Exchanges[0].Request; !bytes.Equal(got, []byte{minissdpc.RequestTypeAll, 1, 1}) {
+		t.Fatalf("unexpected request %x", got)
+	}
+}
+
+func TestFileRecorderEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	rec, err := NewFileRecorder(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Sessions) != 0 {
+		t.Fatalf("expected no sessions, got %+v", f.Sessions)
+	}
+}
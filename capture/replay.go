@@ -0,0 +1,189 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultCloseTimeout is how long Close waits for clients to hang
+// up, unless the Replayer's CloseTimeout is set
+const DefaultCloseTimeout = 5 * time.Second
+
+var (
+	errNoSession       = errors.New("no recorded session left for the connection")
+	errUnexpectedBytes = errors.New("client sent more than the recorded session")
+	errNoHangup        = errors.New("client did not hang up after the recorded session")
+)
+
+// A Replayer serves recorded sessions back to clients, acting as
+// the daemon that was recorded. Each connection replays the next
+// session of the file: every request must match the recorded one
+// byte for byte, and is answered with the recorded response.
+// Notifications are sent as soon as the request before them has
+// been answered. It must be created with NewReplayer.
+type Replayer struct {
+	// CloseTimeout is how long Close waits for clients to hang up
+	// before it closes their connections
+	CloseTimeout time.Duration
+
+	file *File
+
+	mu        sync.Mutex
+	next      int
+	errs      []error
+	listeners []net.Listener
+	conns     map[net.Conn]bool
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewReplayer returns a Replayer for the sessions of f
+func NewReplayer(f *File) *Replayer {
+	return &Replayer{
+		CloseTimeout: DefaultCloseTimeout,
+		file:         f,
+		conns:        make(map[net.Conn]bool),
+	}
+}
+
+// Serve accepts connections on l and replays sessions to them
+// until Close is called, when it returns nil
+func (r *Replayer) Serve(l net.Listener) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		l.Close()
+		return nil
+	}
+	r.listeners = append(r.listeners, l)
+	r.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			r.mu.Lock()
+			closed := r.closed
+			r.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		var s *Session
+		if r.next < len(r.file.Sessions) {
+			s = &r.file.Sessions[r.next]
+		}
+		r.next++
+		r.conns[conn] = true
+		r.wg.Add(1)
+		r.mu.Unlock()
+
+		go func(n int) {
+			defer r.wg.Done()
+			err := replay(conn, s)
+			r.mu.Lock()
+			if err != nil {
+				r.errs = append(r.errs, fmt.Errorf("session %d: %v", n, err))
+			}
+			delete(r.conns, conn)
+			r.mu.Unlock()
+			conn.Close()
+		}(r.next)
+	}
+}
+
+// Close stops accepting connections, and waits for the clients of
+// running sessions to hang up. After CloseTimeout, the connections
+// of those that have not are closed, which is reported as an error.
+// It returns the first mismatch found between the clients and the
+// recorded sessions, if any.
+func (r *Replayer) Close() error {
+	r.mu.Lock()
+	for _, l := range r.listeners {
+		l.Close()
+	}
+	r.listeners = nil
+	r.closed = true
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(r.CloseTimeout):
+		r.mu.Lock()
+		for conn := range r.conns {
+			conn.SetDeadline(time.Now())
+		}
+		r.mu.Unlock()
+		<-done
+	}
+	return r.Err()
+}
+
+// Err returns the first mismatch found so far
+func (r *Replayer) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.errs) == 0 {
+		return nil
+	}
+	return r.errs[0]
+}
+
+// replay plays s on conn, then waits for the client to hang up
+func replay(conn net.Conn, s *Session) error {
+	if s == nil {
+		return errNoSession
+	}
+
+	for i, e := range s.Exchanges {
+		if len(e.Request) > 0 {
+			got := make([]byte, len(e.Request))
+			n, err := io.ReadFull(conn, got)
+			if err != nil {
+				return fmt.Errorf("exchange %d (%s): expected request %x, got %x: %v", i, e.Summary, []byte(e.Request), got[:n], err)
+			}
+			if !bytes.Equal(got, e.Request) {
+				return fmt.Errorf("exchange %d (%s): expected request %x, got %x", i, e.Summary, []byte(e.Request), got)
+			}
+		}
+		if len(e.Response) > 0 {
+			if _, err := conn.Write(e.Response); err != nil {
+				return fmt.Errorf("exchange %d (%s): %v", i, e.Summary, err)
+			}
+		}
+	}
+
+	n, err := conn.Read(make([]byte, 1))
+	if n > 0 {
+		return errUnexpectedBytes
+	}
+	if isTimeout(err) {
+		return errNoHangup
+	}
+	if err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
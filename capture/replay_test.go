@@ -0,0 +1,128 @@
+package capture
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forfuncsake/minissdpc"
+)
+
+// serve replays f on a temporary socket
+func serve(t *testing.T, f *File) (string, *Replayer, func()) {
+	dir, err := ioutil.TempDir("", "ssdpc-replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "minissdpd.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReplayer(f)
+	go r.Serve(l)
+	return path, r, func() {
+		r.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func testCapture() *File {
+	return &File{
+		Version: fileVersion,
+		Sessions: []Session{
+			{Exchanges: []Exchange{
+				{Summary: "version", Request: Bytes{minissdpc.RequestTypeVersion, 1, 0}, Response: Bytes{3, '1', '.', '5'}},
+			}},
+			{Exchanges: []Exchange{
+				{Summary: "all", Request: Bytes{minissdpc.RequestTypeAll, 1, 0}, Response: Bytes{0}},
+			}},
+		},
+	}
+}
+
+func TestReplayer(t *testing.T) {
+	path, r, stop := serve(t, testCapture())
+	defer stop()
+
+	// Sessions are replayed in order, one per connection
+	c := &minissdpc.Client{SocketPath: path}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.Version(); err != nil || v != "1.5" {
+		t.Fatalf("unexpected version %q, %v", v, err)
+	}
+	c.Close()
+
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if services, err := c.GetServicesAll(); err != nil || len(services) != 0 {
+		t.Fatalf("unexpected services %v, %v", services, err)
+	}
+	c.Close()
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplayerMismatch(t *testing.T) {
+	path, r, stop := serve(t, testCapture())
+	defer stop()
+
+	c := &minissdpc.Client{SocketPath: path}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetServicesAll(); err == nil {
+		t.Fatal("expected an error for a request that was not recorded")
+	}
+	c.Close()
+
+	// The second session is not used, and there is no third
+	for i := 0; i < 2; i++ {
+		if err := c.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		c.Close()
+	}
+
+	err := r.Close()
+	if err == nil || !strings.Contains(err.Error(), "expected request 000100, got 030100") {
+		t.Fatalf("expected a request mismatch, got %v", err)
+	}
+}
+
+func TestReplayerNoHangup(t *testing.T) {
+	path, r, stop := serve(t, testCapture())
+	defer stop()
+	r.CloseTimeout = 10 * time.Millisecond
+
+	c := &minissdpc.Client{SocketPath: path}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Version(); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- r.Close()
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), errNoHangup.Error()) {
+			t.Fatalf("expected %v, got %v", errNoHangup, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked on a client that did not hang up")
+	}
+}
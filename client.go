@@ -1,7 +1,6 @@
 package minissdpc
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"net"
@@ -20,16 +19,41 @@ var DefaultSocket = "/var/run/minissdpd.sock"
 // re-used by calling Connect() after Close()
 type Client struct {
 	SocketPath string
-	conn       net.Conn
+
+	// SkipValidation disables the checks made by Service.Validate
+	// before a service is registered
+	SkipValidation bool
+
+	// AllowLoopback accepts services with a Location on a loopback
+	// address when they are validated, as ValidateAllowLoopback does
+	AllowLoopback bool
+
+	// Resolver resolves the placeholders of Location templates,
+	// such as {iface:eth0}. SystemResolver is used if it is nil.
+	Resolver Resolver
+
+	// Ledger, if set, records each service that is registered,
+	// and limits reconciliation to services found in it
+	Ledger *Ledger
+
+	conn net.Conn
+
+	// subscribed is set once the connection receives notifications
+	subscribed bool
+
+	// buf is re-used to build requests without allocating. Only
+	// validation allocates, to parse the Location.
+	buf []byte
 }
 
 // Close will close the underlying connection to the minissdpd socket
 func (c *Client) Close() error {
-	if c == nil {
+	if c == nil || c.conn == nil {
 		return nil
 	}
 	defer func() {
 		c.conn = nil
+		c.subscribed = false
 	}()
 	return c.conn.Close()
 }
@@ -60,32 +84,50 @@ func (c *Client) Write(b []byte) (int, error) {
 // prefixed with the encoded length bytes
 func (c *Client) WriteString(s string) (int, error) {
 	// Buffer the string with its encoded length prefixed
-	buf := &bytes.Buffer{}
-	err := EncodeStringLength(len(s), buf)
+	var err error
+	c.buf, err = AppendStringLength(c.buf[:0], len(s))
 	if err != nil {
 		return 0, fmt.Errorf("could not write string length byte(s): %v", err)
 	}
-
-	_, err = buf.WriteString(s)
-	if err != nil {
-		return 0, fmt.Errorf("could not write string to request buffer: %v", err)
-	}
+	c.buf = append(c.buf, s...)
 
 	// Send the request on the socket
-	return c.Write(buf.Bytes())
+	return c.Write(c.buf)
 }
 
 // RegisterService will register a new service to be advertised
-// by minissdpd
+// by minissdpd. A Location template is resolved with the client's
+// Resolver. Unless SkipValidation is set, the service is validated
+// first and a *ValidationError is returned if it is not fit for
+// advertisement. If the service is registered but cannot be
+// recorded in the client's Ledger, a *LedgerError is returned.
 func (c *Client) RegisterService(s Service) error {
-	b := bytes.NewBuffer([]byte{RequestTypeRegister})
-	_, err := s.EncodeTo(b)
+	if IsTemplate(s.Location) {
+		var err error
+		if s, err = s.ResolveLocation(c.Resolver); err != nil {
+			return err
+		}
+	}
+	if !c.SkipValidation {
+		if err := s.validate(c.AllowLoopback); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	c.buf, err = s.AppendEncode(append(c.buf[:0], RequestTypeRegister))
 	if err != nil {
 		return fmt.Errorf("could not encode service: %v", err)
 	}
 
-	_, err = c.Write(b.Bytes())
-	return err
+	_, err = c.Write(c.buf)
+	if err != nil || c.Ledger == nil {
+		return err
+	}
+	if err := c.Ledger.Record(s); err != nil {
+		return &LedgerError{err}
+	}
+	return nil
 }
 
 // GetServicesAll will query the minissdpd server for all services
@@ -98,7 +140,7 @@ func (c *Client) GetServicesAll() ([]Service, error) {
 	}
 
 	// Decode the response
-	return decodeServices(c.conn)
+	return DecodeServices(c.conn)
 }
 
 // GetServicesByUSN will query the minissdpd server for all services
@@ -115,7 +157,7 @@ func (c *Client) GetServicesByUSN(t string) ([]Service, error) {
 	}
 
 	// Decode the response
-	return decodeServices(c.conn)
+	return DecodeServices(c.conn)
 }
 
 // GetServicesByType will query the minissdpd server for all services
@@ -132,5 +174,5 @@ func (c *Client) GetServicesByType(t string) ([]Service, error) {
 	}
 
 	// Decode the response
-	return decodeServices(c.conn)
+	return DecodeServices(c.conn)
 }
@@ -0,0 +1,117 @@
+package minissdpc_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/forfuncsake/minissdpc"
+	"github.com/forfuncsake/minissdpc/capture"
+)
+
+// The captures in testdata were recorded with "minissdpc proxy --record",
+// relaying the ls, ls type, ls usn and register commands to
+// "minissdpc serve-mock" seeded with the three services expected below.
+// Their responses are therefore encoded by this package, so these tests
+// check the client against the capture and replay round trip, not the
+// wire format. The hand-built streams of client_test.go check that.
+
+// replay returns a client connected to a replay of the named capture.
+// The returned function checks that the client sent the recorded requests.
+func replay(t *testing.T, name string) (*minissdpc.Client, func()) {
+	f, err := capture.ReadFile(filepath.Join("testdata", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "ssdpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "minissdpd.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := capture.NewReplayer(f)
+	go r.Serve(l)
+
+	c := &minissdpc.Client{SocketPath: path}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	return c, func() {
+		c.Close()
+		if err := r.Close(); err != nil {
+			t.Error(err)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestClientRegister(t *testing.T) {
+	c, check := replay(t, "register")
+	defer check()
+
+	err := c.RegisterService(minissdpc.Service{
+		Type:     "urn:Dummy:device:controllee:1",
+		USN:      "uuid:1234-1234-1234-1234::urn:Dummy:device:controllee:1",
+		Server:   "Dummy 1.0",
+		Location: "http://192.168.1.10/setup.xml",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientGetByType(t *testing.T) {
+	c, check := replay(t, "get_by_type")
+	defer check()
+
+	services, err := c.GetServicesByType("urn:Type2:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []minissdpc.Service{
+		{Type: "urn:Type2:device:controllee:1", USN: "uuid:0000-0000-0000-0002", Location: "http://127.0.0.1:8002"},
+	}
+	if !reflect.DeepEqual(services, expect) {
+		t.Fatalf("expected %v, got %v", expect, services)
+	}
+}
+
+func TestClientGetByUSN(t *testing.T) {
+	c, check := replay(t, "get_by_usn")
+	defer check()
+
+	services, err := c.GetServicesByUSN("uuid:0000-0000-0000-0003")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []minissdpc.Service{
+		{Type: "urn:Type3:device:controllee:1", USN: "uuid:0000-0000-0000-0003", Location: "http://127.0.0.1:8003"},
+	}
+	if !reflect.DeepEqual(services, expect) {
+		t.Fatalf("expected %v, got %v", expect, services)
+	}
+}
+
+func TestClientGetAll(t *testing.T) {
+	c, check := replay(t, "get_all")
+	defer check()
+
+	services, err := c.GetServicesAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []minissdpc.Service{
+		{Type: "urn:Type1:device:controllee:1", USN: "uuid:0000-0000-0000-0001", Location: "http://127.0.0.1:8001"},
+		{Type: "urn:Type2:device:controllee:1", USN: "uuid:0000-0000-0000-0002", Location: "http://127.0.0.1:8002"},
+		{Type: "urn:Type3:device:controllee:1", USN: "uuid:0000-0000-0000-0003", Location: "http://127.0.0.1:8003"},
+	}
+	if !reflect.DeepEqual(services, expect) {
+		t.Fatalf("expected %v, got %v", expect, services)
+	}
+}
@@ -1,6 +1,7 @@
 package minissdpc
 
 import (
+	"io"
 	"io/ioutil"
 	"net"
 	"os"
@@ -118,9 +119,9 @@ func TestClientWriteString(t *testing.T) {
 func TestClientRegister(t *testing.T) {
 	service := Service{
 		Type:     "urn:Dummy:device:controllee:1",
-		USN:      "1234-1234-1234-1234",
+		USN:      "uuid:1234-1234-1234-1234::urn:Dummy:device:controllee:1",
 		Server:   "Dummy 1.0",
-		Location: "http://127.0.0.1/setup.xml",
+		Location: "http://192.168.1.10/setup.xml",
 	}
 
 	expect := []byte{RequestTypeRegister}
@@ -169,6 +170,49 @@ func TestClientRegister(t *testing.T) {
 	}
 }
 
+func TestClientRegisterInvalid(t *testing.T) {
+	service := Service{
+		Type:     "urn:Dummy:device:controllee:1",
+		USN:      "1234-1234-1234-1234",
+		Server:   "Dummy 1.0",
+		Location: "http://192.168.1.10/setup.xml",
+	}
+
+	// With no connection, validation must fail before any write
+	c := Client{}
+	err := c.RegisterService(service)
+	if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+
+	c.SkipValidation = true
+	err = c.RegisterService(service)
+	if err != errNilConn {
+		t.Fatalf("expected errNilConn with validation skipped, got %v", err)
+	}
+}
+
+func TestClientRegisterLoopback(t *testing.T) {
+	service := Service{
+		Type:     "urn:Dummy:device:controllee:1",
+		USN:      "uuid:1234::urn:Dummy:device:controllee:1",
+		Server:   "Dummy 1.0",
+		Location: "http://127.0.0.1/setup.xml",
+	}
+
+	c := Client{}
+	err := c.RegisterService(service)
+	if verr, ok := err.(*ValidationError); !ok || verr.Err != errLoopbackLocation {
+		t.Fatalf("expected a loopback *ValidationError, got %v", err)
+	}
+
+	c.AllowLoopback = true
+	err = c.RegisterService(service)
+	if err != errNilConn {
+		t.Fatalf("expected errNilConn with loopback allowed, got %v", err)
+	}
+}
+
 func TestClientGetByType(t *testing.T) {
 	filter := "urn:Dummy:device:controllee:1"
 	expect := []byte{byte(len(filter))}
@@ -359,3 +403,88 @@ func TestClientGetAll(t *testing.T) {
 		t.Fatal("unexpected services returned from mock server")
 	}
 }
+
+// discardConn is a net.Conn that accepts and drops all writes
+// deadlineConn records the read deadline set on a connection
+type deadlineConn struct {
+	net.Conn
+	deadline time.Time
+}
+
+func (c *deadlineConn) SetReadDeadline(t time.Time) error {
+	c.deadline = t
+	return c.Conn.SetReadDeadline(t)
+}
+
+func TestClientVersionDeadline(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply []byte
+		err   bool
+	}{
+		{"version", append([]byte{5}, "1.6.0"...), false},
+		// A leading 0x80 is a non-canonical length
+		{"invalid", []byte{0x80, 0x05}, true},
+	}
+
+	for _, test := range tests {
+		client, server := net.Pipe()
+		go func() {
+			b := make([]byte, 3)
+			if _, err := io.ReadFull(server, b); err != nil {
+				return
+			}
+			server.Write(test.reply)
+		}()
+
+		conn := &deadlineConn{Conn: client}
+		c := Client{conn: conn}
+		_, err := c.Version()
+		if (err != nil) != test.err {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+		if !conn.deadline.IsZero() {
+			t.Errorf("%s: read deadline left set to %v", test.name, conn.deadline)
+		}
+		client.Close()
+		server.Close()
+	}
+}
+
+type discardConn struct {
+	net.Conn
+}
+
+func (discardConn) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// BenchmarkClientRegister measures the default client,
+// which validates each service before it is sent
+func BenchmarkClientRegister(b *testing.B) {
+	benchmarkClientRegister(b, false)
+}
+
+func BenchmarkClientRegisterSkipValidation(b *testing.B) {
+	benchmarkClientRegister(b, true)
+}
+
+func benchmarkClientRegister(b *testing.B, skipValidation bool) {
+	service := Service{
+		Type:     "urn:Belkin:device:controllee:1",
+		USN:      "uuid:Socket-1_0-221517K0101769::urn:Belkin:device:controllee:1",
+		Server:   "Unspecified, UPnP/1.0, Unspecified",
+		Location: "http://192.168.1.10:49153/setup.xml",
+	}
+	c := Client{
+		SkipValidation: skipValidation,
+		conn:           discardConn{},
+	}
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if err := c.RegisterService(service); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
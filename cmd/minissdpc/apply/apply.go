@@ -0,0 +1,159 @@
+// Copyright © 2018 Dave Russell <forfuncsake@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package apply registers the services of a manifest that minissdpd
+// is not advertising as declared, for the minissdpc apply command.
+package apply
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/forfuncsake/minissdpc"
+)
+
+// Options are the settings of Run
+type Options struct {
+	// DryRun reports what would change, without registering
+	// services or writing to the ledger
+	DryRun bool
+
+	// Prune forgets the services recorded in the ledger as
+	// applied by its owner that are no longer desired
+	Prune bool
+
+	// Warn, if set, is called with the errors that do not stop
+	// the services from being applied
+	Warn func(error)
+}
+
+// A Summary counts the services changed by Run, or that would
+// be changed on a dry run
+type Summary struct {
+	Registered int
+	Updated    int
+	Unchanged  int
+	Conflicts  int
+	Pruned     int
+
+	// Removed counts the services no longer desired, which
+	// are pruned only if Options.Prune is set
+	Removed int
+
+	DryRun bool
+}
+
+func (s Summary) String() string {
+	summary := fmt.Sprintf("%d registered, %d updated, %d unchanged, %d conflicts, %d pruned",
+		s.Registered, s.Updated, s.Unchanged, s.Conflicts, s.Pruned)
+	if s.DryRun {
+		summary = "dry run: " + summary
+	}
+	return summary
+}
+
+// Run registers the desired services that c's server is not
+// advertising, or is advertising at another location, and writes a
+// line to w for each service registered, updated, left to another
+// application or pruned. Pruning requires c.Ledger, whose Owner
+// identifies the services applied from the same manifest.
+func Run(c *minissdpc.Client, desired []minissdpc.Service, o Options, w io.Writer) (Summary, error) {
+	sum := Summary{DryRun: o.DryRun}
+	drift, err := c.Reconcile(desired)
+	if err != nil {
+		return sum, fmt.Errorf("could not compare the manifest with minissdpd: %v", err)
+	}
+	removed, err := Removed(c.Ledger, desired)
+	if err != nil {
+		return sum, fmt.Errorf("could not read the ledger: %v", err)
+	}
+	sum.Removed = len(removed)
+
+	for _, s := range drift.Missing {
+		fmt.Fprintf(w, "+ %s %s\n", s.USN, s.Location)
+		if err := register(c, s, o); err != nil {
+			return sum, err
+		}
+		sum.Registered++
+	}
+	for _, m := range drift.Mismatched {
+		fmt.Fprintf(w, "~ %s %s -> %s\n", m.Desired.USN, m.Advertised.Location, m.Desired.Location)
+		if err := register(c, m.Desired, o); err != nil {
+			return sum, err
+		}
+		sum.Updated++
+	}
+	for _, m := range drift.Conflicts {
+		fmt.Fprintf(w, "! %s is advertised at %s by another application, skipped\n", m.Desired.USN, m.Advertised.Location)
+	}
+	sum.Conflicts = len(drift.Conflicts)
+	sum.Unchanged = len(desired) - sum.Registered - sum.Updated - sum.Conflicts
+
+	if o.Prune && len(removed) > 0 {
+		for _, s := range removed {
+			fmt.Fprintf(w, "- %s %s\n", s.USN, s.Location)
+		}
+		if !o.DryRun {
+			if err := c.Ledger.Forget(removed...); err != nil {
+				return sum, fmt.Errorf("could not prune the ledger: %v", err)
+			}
+		}
+		sum.Pruned = len(removed)
+	}
+	return sum, nil
+}
+
+// register registers s unless o.DryRun is set. A service that
+// cannot be recorded in the ledger is still registered.
+func register(c *minissdpc.Client, s minissdpc.Service, o Options) error {
+	if o.DryRun {
+		return nil
+	}
+	err := c.RegisterService(s)
+	if _, ok := err.(*minissdpc.LedgerError); ok {
+		if o.Warn != nil {
+			o.Warn(err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not register %s: %v", s.USN, err)
+	}
+	return nil
+}
+
+// Removed returns the services recorded in the ledger as applied by
+// its owner that are not desired any more. There are none without
+// a ledger.
+func Removed(l *minissdpc.Ledger, desired []minissdpc.Service) ([]minissdpc.Service, error) {
+	if l == nil {
+		return nil, nil
+	}
+	entries, err := l.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[[2]string]bool, len(desired))
+	for _, s := range desired {
+		wanted[[2]string{s.USN, s.Type}] = true
+	}
+	var removed []minissdpc.Service
+	for _, e := range entries {
+		if e.Owner == l.Owner && !wanted[[2]string{e.Service.USN, e.Service.Type}] {
+			removed = append(removed, e.Service)
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,237 @@
+package apply
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/forfuncsake/minissdpc"
+	"github.com/forfuncsake/minissdpc/mock"
+)
+
+const owner = "apply:/etc/minissdpc/devices.yaml"
+
+func service(usn, location string) minissdpc.Service {
+	return minissdpc.Service{Type: "upnp:rootdevice", USN: usn + "::upnp:rootdevice", Location: location}
+}
+
+// fixture is a server and ledger holding services in every state
+// that Run tells apart
+type fixture struct {
+	server  *mock.Server
+	client  *minissdpc.Client
+	dir     string
+	desired []minissdpc.Service
+	close   func()
+}
+
+func newFixture(t *testing.T) *fixture {
+	dir, err := ioutil.TempDir("", "ssdpc-apply")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "minissdpd.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := mock.NewServer()
+	go s.Serve(listener)
+
+	f := &fixture{
+		server: s,
+		dir:    filepath.Join(dir, "state"),
+		desired: []minissdpc.Service{
+			service("uuid:missing", "http://192.168.1.10/setup.xml"),
+			service("uuid:moved", "http://192.168.1.11/setup.xml"),
+			service("uuid:theirs", "http://192.168.1.12/setup.xml"),
+			service("uuid:unchanged", "http://192.168.1.13/setup.xml"),
+		},
+		close: func() {
+			s.Close()
+			os.RemoveAll(dir)
+		},
+	}
+
+	moved := service("uuid:moved", "http://192.168.1.20/setup.xml")
+	s.Register(moved)
+	s.Register(service("uuid:theirs", "http://192.168.1.21/setup.xml"))
+	s.Register(f.desired[3])
+
+	l := minissdpc.NewLedger(f.dir)
+	l.Owner = owner
+	if err := l.Record(moved, f.desired[3], service("uuid:dropped", "http://192.168.1.14/setup.xml")); err != nil {
+		t.Fatal(err)
+	}
+	l.Owner = "register"
+	if err := l.Record(service("uuid:other", "http://192.168.1.15/setup.xml")); err != nil {
+		t.Fatal(err)
+	}
+
+	f.client = &minissdpc.Client{SocketPath: path, SkipValidation: true, Ledger: minissdpc.NewLedger(f.dir)}
+	f.client.Ledger.Owner = owner
+	if err := f.client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// advertised returns the locations advertised by the server, by USN
+func (f *fixture) advertised() map[string]string {
+	m := make(map[string]string)
+	for _, s := range f.server.Services() {
+		m[s.USN] = s.Location
+	}
+	return m
+}
+
+func (f *fixture) recorded(t *testing.T) []string {
+	entries, err := f.client.Ledger.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var usns []string
+	for _, e := range entries {
+		usns = append(usns, e.Service.USN)
+	}
+	sort.Strings(usns)
+	return usns
+}
+
+func TestRun(t *testing.T) {
+	f := newFixture(t)
+	defer f.close()
+	defer f.client.Close()
+
+	var out bytes.Buffer
+	sum, err := Run(f.client, f.desired, Options{Prune: true}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := "" +
+		"+ uuid:missing::upnp:rootdevice http://192.168.1.10/setup.xml\n" +
+		"~ uuid:moved::upnp:rootdevice http://192.168.1.20/setup.xml -> http://192.168.1.11/setup.xml\n" +
+		"! uuid:theirs::upnp:rootdevice is advertised at http://192.168.1.21/setup.xml by another application, skipped\n" +
+		"- uuid:dropped::upnp:rootdevice http://192.168.1.14/setup.xml\n"
+	if out.String() != expect {
+		t.Errorf("expected:\n%s\ngot:\n%s", expect, out.String())
+	}
+	if s := sum.String(); s != "1 registered, 1 updated, 1 unchanged, 1 conflicts, 1 pruned" {
+		t.Errorf("unexpected summary %q", s)
+	}
+
+	// minissdpd does not answer registrations, so they are
+	// waited for
+	expectAdvertised := map[string]string{
+		"uuid:missing::upnp:rootdevice":   "http://192.168.1.10/setup.xml",
+		"uuid:moved::upnp:rootdevice":     "http://192.168.1.11/setup.xml",
+		"uuid:theirs::upnp:rootdevice":    "http://192.168.1.21/setup.xml",
+		"uuid:unchanged::upnp:rootdevice": "http://192.168.1.13/setup.xml",
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !reflect.DeepEqual(f.advertised(), expectAdvertised) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %v to be advertised, got %v", expectAdvertised, f.advertised())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Only the services applied by the same owner are pruned
+	recorded := []string{
+		"uuid:missing::upnp:rootdevice",
+		"uuid:moved::upnp:rootdevice",
+		"uuid:other::upnp:rootdevice",
+		"uuid:unchanged::upnp:rootdevice",
+	}
+	if usns := f.recorded(t); !reflect.DeepEqual(usns, recorded) {
+		t.Errorf("expected ledger entries %v, got %v", recorded, usns)
+	}
+}
+
+func TestRunNoPrune(t *testing.T) {
+	f := newFixture(t)
+	defer f.close()
+	defer f.client.Close()
+
+	var out bytes.Buffer
+	sum, err := Run(f.client, f.desired, Options{}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Removed != 1 || sum.Pruned != 0 {
+		t.Errorf("expected 1 removed and none pruned, got %+v", sum)
+	}
+	if bytes.Contains(out.Bytes(), []byte("uuid:dropped")) {
+		t.Errorf("expected no line for the removed service, got:\n%s", out.String())
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	f := newFixture(t)
+	defer f.close()
+	defer f.client.Close()
+
+	before := f.advertised()
+	ledger, err := ioutil.ReadFile(f.client.Ledger.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	sum, err := Run(f.client, f.desired, Options{DryRun: true, Prune: true}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := sum.String(); s != "dry run: 1 registered, 1 updated, 1 unchanged, 1 conflicts, 1 pruned" {
+		t.Errorf("unexpected summary %q", s)
+	}
+	if lines := bytes.Count(out.Bytes(), []byte("\n")); lines != 4 {
+		t.Errorf("expected the 4 lines of a real run, got:\n%s", out.String())
+	}
+
+	if after := f.advertised(); !reflect.DeepEqual(after, before) {
+		t.Errorf("expected the server to be left alone, had %v, now %v", before, after)
+	}
+	b, err := ioutil.ReadFile(f.client.Ledger.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, ledger) {
+		t.Errorf("expected the ledger to be left alone, had:\n%s\nnow:\n%s", ledger, b)
+	}
+}
+
+func TestRunDryRunNoLedger(t *testing.T) {
+	f := newFixture(t)
+	defer f.close()
+	defer f.client.Close()
+
+	// A ledger that was never written is read as empty,
+	// and its directory is not created
+	f.client.Ledger = minissdpc.NewLedger(filepath.Join(f.dir, "missing"))
+	f.client.Ledger.Owner = owner
+	sum, err := Run(f.client, f.desired, Options{DryRun: true, Prune: true}, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Registered != 1 || sum.Conflicts != 2 || sum.Pruned != 0 {
+		t.Errorf("expected the advertised services to be theirs, got %+v", sum)
+	}
+	if _, err := os.Stat(f.client.Ledger.Dir); !os.IsNotExist(err) {
+		t.Errorf("expected %s not to be created, got %v", f.client.Ledger.Dir, err)
+	}
+}
+
+func TestRemoved(t *testing.T) {
+	removed, err := Removed(nil, nil)
+	if err != nil || removed != nil {
+		t.Fatalf("expected nothing to be removed without a ledger, got %v, %v", removed, err)
+	}
+}
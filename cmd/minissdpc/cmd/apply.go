@@ -0,0 +1,155 @@
+// Copyright © 2018 Dave Russell <forfuncsake@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/forfuncsake/minissdpc"
+	"github.com/forfuncsake/minissdpc/cmd/minissdpc/apply"
+	"github.com/forfuncsake/minissdpc/manifest"
+	"github.com/spf13/cobra"
+)
+
+// flags
+var applyFile string
+var applyDryRun, applyPrune, applyNoValidate, applyAllowLoopback bool
+
+// applyCmd represents the apply command
+var applyCmd = &cobra.Command{
+	Use:   "apply -f manifest.yaml",
+	Short: "Register the devices and services declared in a manifest file",
+	Long: `Reads a YAML manifest of devices and services, and registers those that
+minissdpd is not advertising yet or is advertising with a different location.
+Each device is expanded into all of the advertisements required for it from
+its uuid. See the manifest package documentation for the file format.
+
+Services registered by another application are reported and left alone.
+Services are recorded in the ledger as owned by apply:<manifest path>. With
+--prune, services that were applied from the same manifest before, but that
+are no longer in it, are forgotten from the ledger. minissdpd cannot remove a
+service, so it will advertise them until it is restarted.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if applyFile == "" {
+			fmt.Fprintln(os.Stderr, "A manifest must be provided with --file")
+			os.Exit(3)
+		}
+		m, err := loadManifest(applyFile, !applyNoValidate, applyAllowLoopback)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(3)
+		}
+		desired := m.Expand()
+
+		if applyDryRun {
+			// The ledger is only read, so that a dry run
+			// creates nothing
+			initClient()
+			client.Ledger = minissdpc.NewLedger(stateDir)
+		} else {
+			initLedger()
+		}
+		if client.Ledger != nil {
+			client.Ledger.Owner, err = applyOwner(applyFile)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(3)
+			}
+		} else if applyPrune {
+			fmt.Fprintln(os.Stderr, "warning: nothing can be pruned without the ledger")
+		}
+		client.SkipValidation = true
+		err = client.Connect()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not connect to minissdpd: %v\n", err)
+			os.Exit(2)
+		}
+		defer client.Close()
+
+		sum, err := apply.Run(client, desired, apply.Options{
+			DryRun: applyDryRun,
+			Prune:  applyPrune,
+			Warn: func(err error) {
+				fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+			},
+		}, os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+
+		if !applyPrune && sum.Removed > 0 {
+			fmt.Fprintf(os.Stderr, "%d services applied from this manifest are no longer in it, use --prune to forget them\n", sum.Removed)
+		}
+		fmt.Println(sum)
+		if sum.Pruned > 0 && !applyDryRun {
+			fmt.Fprintln(os.Stderr, "pruned services will be advertised by minissdpd until it is restarted")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+
+	applyCmd.Flags().StringVarP(&applyFile, "file", "f", "", "manifest `file` to apply, or - to read from stdin")
+	applyCmd.Flags().BoolVar(&applyDryRun, "dry-run", false, "report what would change without registering anything")
+	applyCmd.Flags().BoolVar(&applyPrune, "prune", false, "forget services applied from this manifest that are no longer in it")
+	applyCmd.Flags().BoolVar(&applyNoValidate, "no-validate", false, "skip validation of the manifest before applying")
+	applyCmd.Flags().BoolVar(&applyAllowLoopback, "allow-loopback", false, "accept locations on a loopback address, which only this host can reach")
+}
+
+// loadManifest reads the manifest at path, or from stdin if path
+// is -, and validates it if asked to, accepting loopback locations
+// if allowLoopback is set
+func loadManifest(path string, validate, allowLoopback bool) (*manifest.Manifest, error) {
+	var m *manifest.Manifest
+	var err error
+	if path == "-" {
+		m, err = manifest.Read(os.Stdin)
+	} else {
+		m, err = manifest.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if validate {
+		if allowLoopback {
+			err = m.ValidateAllowLoopback(nil)
+		} else {
+			err = m.Validate(nil)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%v (use --no-validate to skip validation)", err)
+		}
+	}
+	return m, nil
+}
+
+// applyOwner returns the ledger owner of the services applied from
+// the manifest at path, so that pruning leaves alone those registered
+// by other commands or from other manifests
+func applyOwner(path string) (string, error) {
+	if path == "-" {
+		return "apply:-", nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("could not resolve the manifest path: %v", err)
+	}
+	return "apply:" + abs, nil
+}
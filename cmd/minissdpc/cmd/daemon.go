@@ -0,0 +1,115 @@
+// Copyright © 2018 Dave Russell <forfuncsake@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/forfuncsake/minissdpc"
+	"github.com/forfuncsake/minissdpc/cmd/minissdpc/daemon"
+	"github.com/forfuncsake/minissdpc/cmd/minissdpc/logging"
+	"github.com/spf13/cobra"
+)
+
+// flags
+var daemonConfig, daemonLogFormat string
+var daemonInterval time.Duration
+var daemonNoValidate, daemonAllowLoopback bool
+
+// daemonCmd represents the daemon command
+var daemonCmd = &cobra.Command{
+	Use:   "daemon --config services.yaml",
+	Short: "Keep the services declared in a manifest file registered",
+	Long: `Runs until stopped, keeping the devices and services declared in a
+manifest registered with minissdpd. They are re-registered whenever minissdpd
+restarts or stops advertising them, and their location templates are resolved
+again at every check, so that address changes are followed.
+
+The manifest is the same as for apply, and is reloaded on SIGHUP. If the new
+manifest cannot be read, the previous one is kept. SIGTERM and SIGINT stop the
+daemon. Events are logged to stderr as structured logs.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if daemonConfig == "" || daemonConfig == "-" {
+			fmt.Fprintln(os.Stderr, "A manifest file must be provided with --config")
+			os.Exit(3)
+		}
+
+		logger, err := logging.New(os.Stderr, daemonLogFormat)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(3)
+		}
+
+		m, err := loadManifest(daemonConfig, !daemonNoValidate, daemonAllowLoopback)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(3)
+		}
+
+		initLedger()
+		r := daemon.NewRegistrar(daemon.Options{
+			SocketPath:    client.SocketPath,
+			Interval:      daemonInterval,
+			Ledger:        client.Ledger,
+			NoValidate:    daemonNoValidate,
+			AllowLoopback: daemonAllowLoopback,
+		}, m.Expand())
+		load := func() ([]minissdpc.Service, error) {
+			m, err := loadManifest(daemonConfig, !daemonNoValidate, daemonAllowLoopback)
+			if err != nil {
+				return nil, err
+			}
+			return m.Expand(), nil
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		reload := make(chan struct{}, 1)
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+		go func() {
+			for s := range sig {
+				if s != syscall.SIGHUP {
+					logger.Info("stopping", "signal", s.String())
+					cancel()
+					return
+				}
+				select {
+				case reload <- struct{}{}:
+				default:
+				}
+			}
+		}()
+
+		logger.Info("starting", "config", daemonConfig, "socket", client.SocketPath,
+			"services", len(r.Services()), "interval", r.Interval)
+		daemon.Run(ctx, r, load, reload, logger.With("config", daemonConfig))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+
+	daemonCmd.Flags().StringVarP(&daemonConfig, "config", "c", "", "manifest `file` of the services to keep registered")
+	daemonCmd.Flags().DurationVar(&daemonInterval, "interval", minissdpc.DefaultCheckInterval, "time between checks that the services are registered")
+	daemonCmd.Flags().StringVar(&daemonLogFormat, "log-format", "text", "log `format`: text or json")
+	daemonCmd.Flags().BoolVar(&daemonNoValidate, "no-validate", false, "skip validation of the services, when the manifest is loaded and when they are registered")
+	daemonCmd.Flags().BoolVar(&daemonAllowLoopback, "allow-loopback", false, "accept locations on a loopback address, which only this host can reach")
+}
@@ -0,0 +1,108 @@
+// Copyright © 2018 Dave Russell <forfuncsake@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/forfuncsake/minissdpc/cmd/minissdpc/output"
+	"github.com/forfuncsake/minissdpc/description"
+	"github.com/spf13/cobra"
+)
+
+// flags
+var (
+	describeNoSCPD  bool
+	describeTimeout time.Duration
+)
+
+// describeCmd represents the describe command
+var describeCmd = &cobra.Command{
+	Use:   "describe USN|LOCATION",
+	Short: "Fetch and show the description of a device",
+	Long: `Fetches the device description from a Location, or from the Location of the
+service advertised with the given USN (or USN prefix), and shows the device,
+its embedded devices, their services and the actions of each service.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, "a single USN or Location must be provided")
+			os.Exit(3)
+		}
+		if err := output.CheckDocumentFormat(outputFormat); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(3)
+		}
+
+		location, err := findLocation(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+
+		c := &http.Client{Timeout: describeTimeout}
+		root, err := description.Fetch(c, location)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not fetch device description: %v\n", err)
+			os.Exit(2)
+		}
+		if !describeNoSCPD {
+			// Show what could be fetched, as devices often serve
+			// a broken SCPD for some vendor service
+			if err := root.FetchSCPDs(c, location); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+			}
+		}
+
+		err = output.WriteDescription(os.Stdout, outputFormat, output.NewDescription(root, location))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not write description: %v\n", err)
+			os.Exit(2)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(describeCmd)
+
+	describeCmd.Flags().StringVarP(&outputFormat, "output", "o", output.Text, "output `format`: text, json or yaml")
+	describeCmd.Flags().BoolVar(&describeNoSCPD, "no-scpd", false, "do not fetch the service descriptions, which list the actions")
+	describeCmd.Flags().DurationVar(&describeTimeout, "timeout", 10*time.Second, "time allowed for each HTTP request")
+}
+
+// findLocation returns arg if it is an HTTP URL, or else the Location
+// of the services advertised with a USN that starts with arg
+func findLocation(arg string) (string, error) {
+	if u, err := url.Parse(arg); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		return arg, nil
+	}
+
+	initClient()
+	err := client.Connect()
+	if err != nil {
+		return "", fmt.Errorf("could not connect to minissdpd: %v", err)
+	}
+	defer client.Close()
+
+	services, err := client.GetServicesByUSN(arg)
+	if err != nil {
+		return "", fmt.Errorf("could not get services by USN: %v", err)
+	}
+	return description.FindLocation(arg, services)
+}
@@ -0,0 +1,129 @@
+// Copyright © 2018 Dave Russell <forfuncsake@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/forfuncsake/minissdpc/hue"
+	"github.com/spf13/cobra"
+)
+
+// flags
+var hueLights []string
+var hueBridgeName, hueIP, hueOnCmd, hueOffCmd string
+var huePort int
+
+// hueCmd represents the hue command
+var hueCmd = &cobra.Command{
+	Use:   "hue",
+	Short: "run a virtual Philips Hue bridge",
+	Long: `Starts a virtual Hue bridge with a dimmable light for each --name and
+registers it with minissdpd. When a client changes a light, --on-cmd or
+--off-cmd is run with HUE_LIGHT and HUE_BRI set in its environment.
+
+Most Hue clients expect the bridge on port 80.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(hueLights) == 0 {
+			fmt.Fprintln(os.Stderr, "at least one --name must be provided")
+			os.Exit(3)
+		}
+		if hueIP == "" {
+			ip, err := lanIP()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "could not find an IP address to advertise, use --ip: %v\n", err)
+				os.Exit(3)
+			}
+			hueIP = ip
+		}
+
+		b, err := hue.NewBridge(hueBridgeName, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not create bridge: %v\n", err)
+			os.Exit(2)
+		}
+		for _, name := range hueLights {
+			name := name
+			b.AddLight(name, func(s hue.State) error {
+				return runLightCommand(name, s)
+			})
+		}
+
+		port := strconv.Itoa(huePort)
+		l, err := net.Listen("tcp", net.JoinHostPort("", port))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not listen for the bridge: %v\n", err)
+			os.Exit(2)
+		}
+		go http.Serve(l, b.Handler())
+
+		initLedger()
+		err = client.Connect()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not connect to minissdpd: %v\n", err)
+			os.Exit(2)
+		}
+		defer client.Close()
+
+		baseURL := "http://" + net.JoinHostPort(hueIP, port)
+		err = b.Register(client, baseURL, "")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not register bridge: %v\n", err)
+			os.Exit(2)
+		}
+		fmt.Printf("bridge %q (%s) running at %s with %d lights\n",
+			hueBridgeName, b.BridgeID(), baseURL+hue.DescriptionPath, len(hueLights))
+
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(hueCmd)
+
+	hueCmd.Flags().StringArrayVarP(&hueLights, "name", "n", nil, "`name` of a light, may be repeated")
+	hueCmd.Flags().StringVar(&hueBridgeName, "bridge-name", "Philips hue", "name of the bridge")
+	hueCmd.Flags().StringVar(&hueIP, "ip", "", "IP address to advertise (default: the address of the first interface that is up)")
+	hueCmd.Flags().IntVarP(&huePort, "port", "p", 80, "port to serve the bridge on")
+	hueCmd.Flags().StringVar(&hueOnCmd, "on-cmd", "", "shell command run when a light is turned on or dimmed")
+	hueCmd.Flags().StringVar(&hueOffCmd, "off-cmd", "", "shell command run when a light is turned off")
+}
+
+// runLightCommand runs the on or off command for the named light
+func runLightCommand(name string, s hue.State) error {
+	command := hueOffCmd
+	if s.On {
+		command = hueOnCmd
+	}
+	if command == "" {
+		return nil
+	}
+
+	c := exec.Command("sh", "-c", command)
+	c.Env = append(os.Environ(), "HUE_LIGHT="+name, "HUE_BRI="+strconv.Itoa(s.Bri))
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	return c.Run()
+}
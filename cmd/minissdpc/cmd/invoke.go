@@ -0,0 +1,125 @@
+// Copyright © 2018 Dave Russell <forfuncsake@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/forfuncsake/minissdpc/cmd/minissdpc/output"
+	"github.com/forfuncsake/minissdpc/description"
+	"github.com/forfuncsake/minissdpc/soap"
+	"github.com/spf13/cobra"
+)
+
+// flags
+var (
+	invokeNoSCPD  bool
+	invokeTimeout time.Duration
+)
+
+// invokeCmd represents the invoke command
+var invokeCmd = &cobra.Command{
+	Use:   "invoke USN|LOCATION SERVICE-TYPE ACTION [NAME=VALUE...]",
+	Short: "Invoke a SOAP action on a service of a device",
+	Long: `Fetches the device description from a Location, or from the Location of the
+service advertised with the given USN (or USN prefix), and invokes the action
+on the service of that type, at its controlURL. The out arguments are printed,
+or the UPnP error if the service reports one.
+
+Unless --no-scpd is given, the action and its arguments are checked against
+the service description, and the arguments are sent in the declared order.`,
+	Example: `  minissdpc invoke uuid:Socket-1_0-221517K0101769 urn:Belkin:service:basicevent:1 SetBinaryState BinaryState=1`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 3 {
+			fmt.Fprintln(os.Stderr, "a USN or Location, a service type and an action must be provided")
+			os.Exit(3)
+		}
+		if err := output.CheckDocumentFormat(outputFormat); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(3)
+		}
+		serviceType, action := args[1], args[2]
+		in, err := soap.ParseArgs(args[3:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(3)
+		}
+
+		location, err := findLocation(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+
+		c := &http.Client{Timeout: invokeTimeout}
+		root, err := description.Fetch(c, location)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not fetch device description: %v\n", err)
+			os.Exit(2)
+		}
+
+		udn := strings.SplitN(args[0], "::", 2)[0]
+		service := root.Device.FindService(serviceType, udn)
+		if service == nil {
+			fmt.Fprintf(os.Stderr, "%s has no service of type %s\n", location, serviceType)
+			os.Exit(3)
+		}
+
+		if !invokeNoSCPD {
+			if err := root.FetchSCPD(c, location, service); err != nil {
+				fmt.Fprintf(os.Stderr, "%v, use --no-scpd to invoke it unchecked\n", err)
+				os.Exit(2)
+			}
+			in, err = soap.CheckArgs(service.SCPD, action, in)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(3)
+			}
+		}
+
+		controlURL, err := root.URL(location, service.ControlURL)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		out, err := soap.Invoke(c, controlURL, serviceType, action, in)
+		if e, ok := err.(*soap.Error); ok {
+			fmt.Fprintln(os.Stderr, e)
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not invoke %s: %v\n", action, err)
+			os.Exit(2)
+		}
+
+		if err := output.WriteArgs(os.Stdout, outputFormat, out); err != nil {
+			fmt.Fprintf(os.Stderr, "could not write out arguments: %v\n", err)
+			os.Exit(2)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(invokeCmd)
+
+	invokeCmd.Flags().StringVarP(&outputFormat, "output", "o", output.Text, "output `format`: text, json or yaml")
+	invokeCmd.Flags().BoolVar(&invokeNoSCPD, "no-scpd", false, "invoke without checking the action against the service description")
+	invokeCmd.Flags().DurationVar(&invokeTimeout, "timeout", 10*time.Second, "time allowed for each HTTP request")
+}
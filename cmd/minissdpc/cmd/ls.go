@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/forfuncsake/minissdpc/cmd/minissdpc/output"
 	"github.com/spf13/cobra"
 )
 
@@ -27,8 +28,14 @@ var lsCmd = &cobra.Command{
 	Short: "list services currently advertised by minissdpd",
 
 	Run: func(cmd *cobra.Command, args []string) {
+		t, err := checkOutputFlags()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(3)
+		}
+
 		initClient()
-		err := client.Connect()
+		err = client.Connect()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "could not connect to minissdpd: %v\n", err)
 			os.Exit(2)
@@ -41,11 +48,14 @@ var lsCmd = &cobra.Command{
 			os.Exit(2)
 		}
 
-		printServices(services)
+		printServices(services, t)
 		os.Exit(0)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(lsCmd)
+
+	lsCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", output.Text, "output `format`: text, json, yaml, table, csv or template")
+	lsCmd.PersistentFlags().StringVar(&outputTemplateText, "template", "", "Go text/template executed for each service, with fields .Type, .USN, .Location, .Ours, .Owner and .RegisteredAt")
 }
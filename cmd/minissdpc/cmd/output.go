@@ -0,0 +1,94 @@
+// Copyright © 2018 Dave Russell <forfuncsake@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/template"
+
+	"github.com/forfuncsake/minissdpc"
+	"github.com/forfuncsake/minissdpc/cmd/minissdpc/output"
+)
+
+// flags
+var outputFormat, outputTemplateText string
+
+// checkOutputFlags validates --output and --template, so that a bad
+// format is reported before minissdpd is queried
+func checkOutputFlags() (*template.Template, error) {
+	format, t, err := output.Parse(outputFormat, outputTemplateText)
+	if err != nil {
+		return nil, err
+	}
+	outputFormat = format
+	return t, nil
+}
+
+// printServices writes services to stdout in the selected format,
+// exiting if they cannot be written
+func printServices(services []minissdpc.Service, t *template.Template) {
+	if err := writeServices(os.Stdout, services, t); err != nil {
+		fmt.Fprintf(os.Stderr, "could not write services: %v\n", err)
+		os.Exit(2)
+	}
+}
+
+// writeServices writes services to w in the selected format. In the
+// text format, a note that there are none goes to stderr, so that w
+// is left empty in every format.
+func writeServices(w io.Writer, services []minissdpc.Service, t *template.Template) error {
+	if len(services) == 0 && outputFormat == output.Text {
+		fmt.Fprintln(os.Stderr, "No matching services returned")
+	}
+	return output.WriteServices(w, outputFormat, toOutput(services), t)
+}
+
+// toOutput marks the services found in the ledger as ours
+func toOutput(services []minissdpc.Service) []output.Service {
+	return markOwned(services, ledgerEntries())
+}
+
+// markOwned marks the services found in owners, as returned by
+// ledgerEntries, as ours
+func markOwned(services []minissdpc.Service, owners map[[2]string]minissdpc.LedgerEntry) []output.Service {
+	out := make([]output.Service, 0, len(services))
+	for _, s := range services {
+		o := output.Service{Type: s.Type, USN: s.USN, Location: s.Location}
+		if e, ok := owners[[2]string{s.USN, s.Type}]; ok {
+			registered := e.RegisteredAt
+			o.Ours = true
+			o.Owner = e.Owner
+			o.RegisteredAt = &registered
+		}
+		out = append(out, o)
+	}
+	return out
+}
+
+// ledgerEntries returns the ledger's entries keyed by USN and type.
+// A ledger that cannot be read leaves every service unowned.
+func ledgerEntries() map[[2]string]minissdpc.LedgerEntry {
+	entries, err := minissdpc.NewLedger(stateDir).Entries()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+	owners := make(map[[2]string]minissdpc.LedgerEntry, len(entries))
+	for _, e := range entries {
+		owners[[2]string{e.Service.USN, e.Service.Type}] = e
+	}
+	return owners
+}
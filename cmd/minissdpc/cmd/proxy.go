@@ -0,0 +1,117 @@
+// Copyright © 2018 Dave Russell <forfuncsake@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/forfuncsake/minissdpc"
+	"github.com/forfuncsake/minissdpc/capture"
+	"github.com/forfuncsake/minissdpc/cmd/minissdpc/logging"
+	"github.com/forfuncsake/minissdpc/proxy"
+	"github.com/spf13/cobra"
+)
+
+// flags
+var proxyListen, proxyUpstream, proxyLogFormat, proxyRecord string
+
+// proxyCmd represents the proxy command
+var proxyCmd = &cobra.Command{
+	Use:   "proxy --listen /tmp/ssdp.sock",
+	Short: "Relay a socket to minissdpd, logging every request and response",
+	Long: `Listens on the --listen socket and relays each connection to minissdpd on
+the --upstream socket. Every request and response is decoded and logged to
+stderr, in text or JSON. Point a misbehaving client at the --listen socket to
+see what it sends and receives.
+
+With --record, each session is written to a capture file as it ends, and the
+file is completed when the proxy is stopped. A capture can be replayed to
+clients as a test fixture, see the capture package.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if proxyListen == "" {
+			fmt.Fprintln(os.Stderr, "A socket to listen on must be provided with --listen")
+			os.Exit(3)
+		}
+		if err := logging.CheckFormat(proxyLogFormat); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(3)
+		}
+
+		var recorder *capture.Recorder
+		var recordFile *os.File
+		if proxyRecord != "" {
+			var err error
+			recordFile, err = os.Create(proxyRecord)
+			if err == nil {
+				recorder, err = capture.NewFileRecorder(recordFile)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "could not write capture file: %v\n", err)
+				os.Exit(3)
+			}
+		}
+
+		logJSON := json.NewEncoder(os.Stderr)
+		p := proxy.New(proxyUpstream)
+		p.Log = func(m proxy.Message) {
+			if recorder != nil {
+				recorder.Add(m)
+			}
+			if proxyLogFormat == logging.JSON {
+				logJSON.Encode(m)
+				return
+			}
+			fmt.Fprintln(os.Stderr, m)
+		}
+
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sig
+			p.Close()
+		}()
+
+		fmt.Fprintf(os.Stderr, "relaying %s to %s\n", proxyListen, proxyUpstream)
+		err := p.ListenAndServe(proxyListen)
+		if recorder != nil {
+			werr := recorder.Close()
+			if cerr := recordFile.Close(); werr == nil {
+				werr = cerr
+			}
+			if werr != nil {
+				fmt.Fprintf(os.Stderr, "could not write capture file: %v\n", werr)
+				os.Exit(2)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not listen on %s: %v\n", proxyListen, err)
+			os.Exit(2)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(proxyCmd)
+
+	proxyCmd.Flags().StringVarP(&proxyListen, "listen", "l", "", "unix socket `path` for clients to connect to")
+	proxyCmd.Flags().StringVar(&proxyUpstream, "upstream", minissdpc.DefaultSocket, "minissdpd's unix socket `path`")
+	proxyCmd.Flags().StringVar(&proxyLogFormat, "log-format", "text", "log `format`: text or json")
+	proxyCmd.Flags().StringVar(&proxyRecord, "record", "", "capture `file` to write the sessions to")
+}
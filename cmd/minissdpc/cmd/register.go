@@ -24,6 +24,7 @@ import (
 
 // flags
 var regType, regUSN, regServer, regLocation string
+var regNoValidate, regAllowLoopback bool
 
 // registerCmd represents the register command
 var registerCmd = &cobra.Command{
@@ -35,20 +36,37 @@ var registerCmd = &cobra.Command{
 			fmt.Fprintln(os.Stderr, "All fields must be provided to register a new service, see help for fields")
 			os.Exit(3)
 		}
-		initClient()
-		err := client.Connect()
+		service := minissdpc.Service{
+			Type:     regType,
+			USN:      regUSN,
+			Server:   regServer,
+			Location: regLocation,
+		}
+		service, err := service.ResolveLocation(nil)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(3)
+		}
+
+		initLedger()
+		client.SkipValidation = regNoValidate
+		client.AllowLoopback = regAllowLoopback
+		err = client.Connect()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "could not connect to minissdpd: %v\n", err)
 			os.Exit(2)
 		}
 		defer client.Close()
 
-		err = client.RegisterService(minissdpc.Service{
-			Type:     regType,
-			USN:      regUSN,
-			Server:   regServer,
-			Location: regLocation,
-		})
+		err = client.RegisterService(service)
+		if _, ok := err.(*minissdpc.LedgerError); ok {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+			err = nil
+		}
+		if _, ok := err.(*minissdpc.ValidationError); ok {
+			fmt.Fprintf(os.Stderr, "%v (use --no-validate to register anyway)\n", err)
+			os.Exit(3)
+		}
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "could not register new service: %v\n", err)
 			os.Exit(2)
@@ -63,5 +81,7 @@ func init() {
 	registerCmd.Flags().StringVarP(&regType, "type", "t", "", "SSDP service/device type")
 	registerCmd.Flags().StringVarP(&regUSN, "usn", "u", "", "SSDP unique service name")
 	registerCmd.Flags().StringVarP(&regServer, "server", "s", "", "SSDP server identifier string")
-	registerCmd.Flags().StringVarP(&regLocation, "location", "l", "", "URL of the service being advertised")
+	registerCmd.Flags().StringVarP(&regLocation, "location", "l", "", "URL of the service being advertised, may use {iface:<name>} or {primary-ip} in place of an address")
+	registerCmd.Flags().BoolVar(&regNoValidate, "no-validate", false, "skip validation of the service before registering")
+	registerCmd.Flags().BoolVar(&regAllowLoopback, "allow-loopback", false, "accept a location on a loopback address, which only this host can reach")
 }
@@ -16,13 +16,14 @@ package cmd
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 
 	"github.com/forfuncsake/minissdpc"
 	"github.com/spf13/cobra"
 )
 
-var socket string
+var socket, stateDir string
 var client *minissdpc.Client
 
 func initClient() {
@@ -33,6 +34,31 @@ func initClient() {
 	}
 }
 
+// initLedger makes the client record the services it registers in
+// the ownership ledger, warning instead if the ledger is not writable
+func initLedger() {
+	initClient()
+	if err := checkWritable(stateDir); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: registrations will not be recorded as ours: %v\n", err)
+		return
+	}
+	client.Ledger = minissdpc.NewLedger(stateDir)
+}
+
+// checkWritable creates dir if needed, and checks that files can be
+// created in it
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, ".check")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "minissdpc",
@@ -50,14 +76,5 @@ func Execute() {
 
 func init() {
 	rootCmd.PersistentFlags().StringVar(&socket, "socket", minissdpc.DefaultSocket, "minissdpd's unix socket `path`")
-}
-
-func printServices(services []minissdpc.Service) {
-	if len(services) == 0 {
-		fmt.Println("No matching services returned")
-		return
-	}
-	for _, s := range services {
-		fmt.Printf("Type: %s\nUSN: %s\nLocation: %s\n\n", s.Type, s.USN, s.Location)
-	}
+	rootCmd.PersistentFlags().StringVar(&stateDir, "state-dir", minissdpc.DefaultStateDir, "`directory` of the ledger recording which services are ours")
 }
@@ -0,0 +1,95 @@
+// Copyright © 2018 Dave Russell <forfuncsake@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/forfuncsake/minissdpc"
+	"github.com/forfuncsake/minissdpc/cmd/minissdpc/logging"
+	"github.com/forfuncsake/minissdpc/mock"
+	"github.com/spf13/cobra"
+)
+
+// flags
+var mockFixture, mockVersion, mockLogFormat string
+
+// serveMockCmd represents the serve-mock command
+var serveMockCmd = &cobra.Command{
+	Use:   "serve-mock",
+	Short: "Run a fake minissdpd on the socket, for development without minissdpd",
+	Long: `Listens on the socket given by --socket and answers requests as minissdpd
+would, from an in-memory table of services. Nothing is advertised on the
+network. Every request received is logged to stderr.
+
+The table can be seeded from a JSON or YAML fixture holding a list of
+services, such as the output of "minissdpc ls -o json".`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, err := logging.New(os.Stderr, mockLogFormat)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(3)
+		}
+
+		var services []minissdpc.Service
+		if mockFixture != "" {
+			services, err = mock.LoadFixture(mockFixture)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(3)
+			}
+		}
+
+		s := mock.NewServer(services...)
+		s.Version = mockVersion
+		s.Log = func(r minissdpc.Request) {
+			attrs := []interface{}{"type", r.Name()}
+			switch r.Type {
+			case minissdpc.RequestTypeByType, minissdpc.RequestTypeByUSN:
+				attrs = append(attrs, "filter", r.Filter)
+			case minissdpc.RequestTypeRegister:
+				attrs = append(attrs, "usn", r.Service.USN, "nt", r.Service.Type,
+					"server", r.Service.Server, "location", r.Service.Location)
+			}
+			logger.Info("request", attrs...)
+		}
+
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sig
+			s.Close()
+		}()
+
+		logger.Info("starting", "socket", socket, "services", len(services), "version", mockVersion)
+		err = s.ListenAndServe(socket)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not serve on %s: %v\n", socket, err)
+			os.Exit(2)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveMockCmd)
+
+	serveMockCmd.Flags().StringVarP(&mockFixture, "fixture", "f", "", "JSON or YAML `file` of services to start with")
+	serveMockCmd.Flags().StringVar(&mockVersion, "daemon-version", mock.DefaultVersion, "minissdpd version to report, empty to behave as a version without notifications")
+	serveMockCmd.Flags().StringVar(&mockLogFormat, "log-format", "text", "log `format`: text or json")
+}
@@ -0,0 +1,354 @@
+// Copyright © 2018 Dave Russell <forfuncsake@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/forfuncsake/minissdpc"
+	"github.com/forfuncsake/minissdpc/cmd/minissdpc/output"
+	"github.com/forfuncsake/minissdpc/cmd/minissdpc/shell"
+	"github.com/spf13/cobra"
+)
+
+// flags
+var shellHistory string
+
+// shellCommands is filled in by init, as the help command refers to it
+var shellCommands []shell.Command
+
+// shellCmd represents the shell command
+var shellCmd = &cobra.Command{
+	Use:   "shell",
+	Short: "Explore minissdpd interactively over a single connection",
+	Long: `Starts an interactive shell that runs ls, type, usn, register, version and
+watch over one connection to minissdpd, reconnecting only if a command fails.
+Types and USNs are completed with tab from the services minissdpd advertises,
+and the command history is kept between sessions. Type help for the list of
+commands.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		initLedger()
+		err := client.Connect()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not connect to minissdpd: %v\n", err)
+			os.Exit(2)
+		}
+		defer client.Close()
+
+		rl, err := readline.NewEx(&readline.Config{
+			Prompt:          "minissdpc> ",
+			HistoryFile:     shellHistory,
+			AutoComplete:    shellCompleter(),
+			InterruptPrompt: "^C",
+			EOFPrompt:       "exit",
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not start the shell: %v\n", err)
+			os.Exit(2)
+		}
+		defer rl.Close()
+
+		for {
+			line, err := rl.Readline()
+			if err == readline.ErrInterrupt {
+				continue
+			}
+			if err != nil {
+				return
+			}
+
+			args, err := shell.SplitArgs(line)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				continue
+			}
+			if len(args) == 0 {
+				continue
+			}
+			if args[0] == "exit" || args[0] == "quit" {
+				return
+			}
+			shell.Run(shellCommands, args, os.Stderr, reconnect)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(shellCmd)
+
+	history := ""
+	if home := os.Getenv("HOME"); home != "" {
+		history = filepath.Join(home, ".minissdpc_history")
+	}
+	shellCmd.Flags().StringVar(&shellHistory, "history", history, "`file` to keep the command history in, empty to keep none")
+
+	shellCommands = []shell.Command{
+		{Name: "ls", Usage: "ls", Help: "list all advertised services", Run: shellList},
+		{Name: "type", Usage: "type PREFIX", Help: "list the services whose type starts with PREFIX", Run: shellType},
+		{Name: "usn", Usage: "usn PREFIX", Help: "list the services whose USN starts with PREFIX", Run: shellUSN},
+		{Name: "register", Usage: "register TYPE USN SERVER LOCATION", Help: "register a service, quoting fields with spaces", Run: shellRegister},
+		{Name: "version", Usage: "version", Help: "show the version of minissdpd", Run: shellVersion},
+		{Name: "watch", Usage: "watch [TYPE-PREFIX [USN-PREFIX]]", Help: "show changes to the services until interrupted with ^C", Run: shellWatch},
+		{Name: "output", Usage: "output FORMAT [TEMPLATE]", Help: "set the output format: text, json, yaml, table, csv or template", Run: shellOutput},
+		{Name: "help", Usage: "help", Help: "show this help", Run: shellHelp},
+		{Name: "exit", Usage: "exit", Help: "leave the shell"},
+	}
+}
+
+// reconnect replaces the connection to minissdpd, which may be broken
+func reconnect() error {
+	client.Close()
+	return client.Connect()
+}
+
+func usage(name string) error {
+	return shell.Usage(shellCommands, name)
+}
+
+func shellList(args []string) error {
+	if len(args) != 0 {
+		return usage("ls")
+	}
+	services, err := client.GetServicesAll()
+	if err != nil {
+		return fmt.Errorf("could not list all services: %v", err)
+	}
+	return shellPrint(services)
+}
+
+func shellType(args []string) error {
+	if len(args) != 1 {
+		return usage("type")
+	}
+	services, err := client.GetServicesByType(args[0])
+	if err != nil {
+		return fmt.Errorf("could not list services by type: %v", err)
+	}
+	return shellPrint(services)
+}
+
+func shellUSN(args []string) error {
+	if len(args) != 1 {
+		return usage("usn")
+	}
+	services, err := client.GetServicesByUSN(args[0])
+	if err != nil {
+		return fmt.Errorf("could not list services by USN: %v", err)
+	}
+	return shellPrint(services)
+}
+
+func shellPrint(services []minissdpc.Service) error {
+	t, err := checkOutputFlags()
+	if err != nil {
+		return shell.UsageError(err.Error())
+	}
+	if err := writeServices(os.Stdout, services, t); err != nil {
+		return shell.UsageError(fmt.Sprintf("could not write services: %v", err))
+	}
+	return nil
+}
+
+func shellRegister(args []string) error {
+	if len(args) != 4 {
+		return usage("register")
+	}
+	service := minissdpc.Service{Type: args[0], USN: args[1], Server: args[2], Location: args[3]}
+	service, err := service.ResolveLocation(nil)
+	if err != nil {
+		return shell.UsageError(err.Error())
+	}
+	err = client.RegisterService(service)
+	switch err.(type) {
+	case nil:
+	case *minissdpc.ValidationError:
+		return shell.UsageError(err.Error())
+	case *minissdpc.LedgerError:
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	default:
+		return fmt.Errorf("could not register new service: %v", err)
+	}
+	fmt.Printf("service %s successfully registered\n", service.USN)
+	return nil
+}
+
+func shellVersion(args []string) error {
+	if len(args) != 0 {
+		return usage("version")
+	}
+	v, err := client.Version()
+	if err != nil {
+		return fmt.Errorf("could not query minissdpd version: %v", err)
+	}
+	if v == "" {
+		// The daemon may have dropped the connection
+		if err := reconnect(); err != nil {
+			return fmt.Errorf("could not reconnect to minissdpd: %v", err)
+		}
+		v = "before 1.5, which does not report its version"
+	}
+	fmt.Printf("minissdpd %s\n", v)
+	return nil
+}
+
+// shellWatch watches on connections of its own, as a connection
+// that receives notifications cannot be used for anything else
+func shellWatch(args []string) error {
+	if len(args) > 2 {
+		return usage("watch")
+	}
+	var typePrefix, usnPrefix string
+	if len(args) > 0 {
+		typePrefix = args[0]
+	}
+	if len(args) > 1 {
+		usnPrefix = args[1]
+	}
+	t, err := checkOutputFlags()
+	if err != nil {
+		return shell.UsageError(err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	w := &minissdpc.Watcher{SocketPath: client.SocketPath}
+	changes := make(chan minissdpc.Change, 64)
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Watch(ctx, changes)
+	}()
+
+	matches := func(s minissdpc.Service) bool {
+		return strings.HasPrefix(s.Type, typePrefix) && strings.HasPrefix(s.USN, usnPrefix)
+	}
+	p := output.NewChangeWriter(os.Stdout, outputFormat, t)
+	for {
+		select {
+		case c := <-changes:
+			for _, c := range toChanges(receiveBatch(c, changes, matches)) {
+				if err := p.Write(c); err != nil {
+					return shell.UsageError(fmt.Sprintf("could not write change: %v", err))
+				}
+			}
+		case err := <-done:
+			if err == context.Canceled {
+				return nil
+			}
+			return shell.UsageError(fmt.Sprintf("stopped watching minissdpd: %v", err))
+		}
+	}
+}
+
+func shellOutput(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return usage("output")
+	}
+	format, text := outputFormat, outputTemplateText
+	outputFormat = args[0]
+	outputTemplateText = ""
+	if len(args) == 2 {
+		outputTemplateText = args[1]
+	}
+	if _, err := checkOutputFlags(); err != nil {
+		outputFormat, outputTemplateText = format, text
+		return shell.UsageError(err.Error())
+	}
+	return nil
+}
+
+func shellHelp(args []string) error {
+	for _, c := range shellCommands {
+		fmt.Printf("  %-36s %s\n", c.Usage, c.Help)
+	}
+	return nil
+}
+
+// shellCompleter completes command names, and the types and USNs
+// of the services advertised by minissdpd
+func shellCompleter() *readline.PrefixCompleter {
+	typeNames := func(string) []string {
+		return shellServiceNames(func(s minissdpc.Service) string { return s.Type })
+	}
+	usns := readline.PcItemDynamic(func(string) []string {
+		return shellServiceNames(func(s minissdpc.Service) string { return s.USN })
+	})
+	types := readline.PcItemDynamic(typeNames)
+
+	var items []readline.PrefixCompleterInterface
+	for _, c := range shellCommands {
+		switch c.Name {
+		case "type", "register":
+			items = append(items, readline.PcItem(c.Name, types))
+		case "watch":
+			items = append(items, readline.PcItem(c.Name, readline.PcItemDynamic(typeNames, usns)))
+		case "usn":
+			items = append(items, readline.PcItem(c.Name, usns))
+		case "output":
+			items = append(items, readline.PcItem(c.Name,
+				readline.PcItem(output.Text), readline.PcItem(output.JSON), readline.PcItem(output.YAML),
+				readline.PcItem(output.Table), readline.PcItem(output.CSV), readline.PcItem(output.Template)))
+		default:
+			items = append(items, readline.PcItem(c.Name))
+		}
+	}
+	return readline.NewPrefixCompleter(items...)
+}
+
+// shellServiceNames returns the sorted, distinct values of field
+// for the advertised services. It queries minissdpd on a connection
+// of its own, so that a failure cannot break the connection used by
+// the commands. An error cannot be reported while a line is being
+// edited, so a failure leaves nothing to complete.
+func shellServiceNames(field func(minissdpc.Service) string) []string {
+	c := &minissdpc.Client{SocketPath: client.SocketPath}
+	if err := c.Connect(); err != nil {
+		return nil
+	}
+	defer c.Close()
+
+	services, err := c.GetServicesAll()
+	if err != nil {
+		return nil
+	}
+	seen := make(map[string]bool, len(services))
+	var names []string
+	for _, s := range services {
+		if name := field(s); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -31,8 +31,14 @@ var typeCmd = &cobra.Command{
 			fmt.Fprintln(os.Stderr, "a single type filter string must be provided")
 			os.Exit(3)
 		}
+		t, err := checkOutputFlags()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(3)
+		}
+
 		initClient()
-		err := client.Connect()
+		err = client.Connect()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "could not connect to minissdpd: %v\n", err)
 			os.Exit(2)
@@ -45,7 +51,7 @@ var typeCmd = &cobra.Command{
 			os.Exit(2)
 		}
 
-		printServices(services)
+		printServices(services, t)
 		os.Exit(0)
 	},
 }
@@ -30,8 +30,14 @@ var usnCmd = &cobra.Command{
 			fmt.Fprintln(os.Stderr, "a single USN filter string must be provided")
 			os.Exit(3)
 		}
+		t, err := checkOutputFlags()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(3)
+		}
+
 		initClient()
-		err := client.Connect()
+		err = client.Connect()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "could not connect to minissdpd: %v\n", err)
 			os.Exit(2)
@@ -44,7 +50,7 @@ var usnCmd = &cobra.Command{
 			os.Exit(2)
 		}
 
-		printServices(services)
+		printServices(services, t)
 		os.Exit(0)
 	},
 }
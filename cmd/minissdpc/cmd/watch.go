@@ -0,0 +1,173 @@
+// Copyright © 2018 Dave Russell <forfuncsake@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/forfuncsake/minissdpc"
+	"github.com/forfuncsake/minissdpc/cmd/minissdpc/output"
+	"github.com/spf13/cobra"
+)
+
+// flags
+var watchType, watchUSN string
+var watchInterval time.Duration
+var watchPoll, watchLive bool
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "show services as they appear, disappear and change",
+	Long: `Prints a timestamped event for every service that appears, disappears or
+changes, starting with those currently advertised. With --live, the list of
+services is redrawn in place instead.
+
+Notifications are used if minissdpd supports them (version 1.5 and later),
+otherwise the list of services is polled.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		t, err := checkOutputFlags()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(3)
+		}
+
+		initClient()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sig
+			cancel()
+		}()
+
+		w := &minissdpc.Watcher{
+			SocketPath: client.SocketPath,
+			Interval:   watchInterval,
+			Poll:       watchPoll,
+			OnStart: func(version string) {
+				if version == "" {
+					fmt.Fprintf(os.Stderr, "polling minissdpd every %s\n", watchInterval)
+				} else {
+					fmt.Fprintf(os.Stderr, "watching minissdpd %s for notifications\n", version)
+				}
+			},
+		}
+		// Buffered, so that the changes found together can be
+		// written as a batch
+		changes := make(chan minissdpc.Change, 64)
+		done := make(chan error, 1)
+		go func() {
+			done <- w.Watch(ctx, changes)
+		}()
+
+		var write func([]output.Change) error
+		if watchLive {
+			view := output.NewLiveView(os.Stdout, outputFormat, t)
+			write = func(batch []output.Change) error {
+				return view.Update(batch...)
+			}
+		} else {
+			p := output.NewChangeWriter(os.Stdout, outputFormat, t)
+			write = func(batch []output.Change) error {
+				for _, c := range batch {
+					if err := p.Write(c); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+		}
+
+		for {
+			select {
+			case c := <-changes:
+				batch := receiveBatch(c, changes, watchMatches)
+				if len(batch) == 0 {
+					continue
+				}
+				if err := write(toChanges(batch)); err != nil {
+					fmt.Fprintf(os.Stderr, "could not write change: %v\n", err)
+					os.Exit(2)
+				}
+			case err := <-done:
+				if err == context.Canceled {
+					os.Exit(0)
+				}
+				fmt.Fprintf(os.Stderr, "stopped watching minissdpd: %v\n", err)
+				os.Exit(2)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	watchCmd.Flags().StringVarP(&watchType, "type", "t", "", "only show services whose type starts with `prefix`, as ls type does")
+	watchCmd.Flags().StringVarP(&watchUSN, "usn", "u", "", "only show services whose USN starts with `prefix`, as ls usn does")
+	watchCmd.Flags().DurationVarP(&watchInterval, "interval", "n", minissdpc.DefaultWatchInterval, "time between polls when notifications are not used")
+	watchCmd.Flags().BoolVar(&watchPoll, "poll", false, "poll even if minissdpd supports notifications")
+	watchCmd.Flags().BoolVar(&watchLive, "live", false, "redraw the list of services in place instead of printing events")
+	watchCmd.Flags().StringVarP(&outputFormat, "output", "o", output.Text, "output `format`: text, json, yaml, table, csv or template")
+	watchCmd.Flags().StringVar(&outputTemplateText, "template", "", "Go text/template executed for each event, with the fields of ls --template and .Time and .Change")
+}
+
+// watchMatches applies the --type and --usn filters, which match
+// prefixes as minissdpd's own filters do
+func watchMatches(s minissdpc.Service) bool {
+	return strings.HasPrefix(s.Type, watchType) && strings.HasPrefix(s.USN, watchUSN)
+}
+
+// receiveBatch returns those of c and the changes already waiting
+// after it whose service matches
+func receiveBatch(c minissdpc.Change, changes <-chan minissdpc.Change, matches func(minissdpc.Service) bool) []minissdpc.Change {
+	var batch []minissdpc.Change
+	for {
+		if matches(c.Service) {
+			batch = append(batch, c)
+		}
+		select {
+		case c = <-changes:
+		default:
+			return batch
+		}
+	}
+}
+
+// toChanges marks the services of the changes found in the ledger
+// as ours, reading it once for the whole batch
+func toChanges(batch []minissdpc.Change) []output.Change {
+	if len(batch) == 0 {
+		return nil
+	}
+	services := make([]minissdpc.Service, len(batch))
+	for i, c := range batch {
+		services[i] = c.Service
+	}
+	out := make([]output.Change, len(batch))
+	for i, s := range markOwned(services, ledgerEntries()) {
+		out[i] = output.NewChange(batch[i], s)
+	}
+	return out
+}
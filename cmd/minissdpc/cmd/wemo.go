@@ -0,0 +1,140 @@
+// Copyright © 2018 Dave Russell <forfuncsake@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/forfuncsake/minissdpc"
+	"github.com/forfuncsake/minissdpc/wemo"
+	"github.com/spf13/cobra"
+)
+
+// flags
+var wemoNames []string
+var wemoIP, wemoOnCmd, wemoOffCmd string
+var wemoPort int
+
+// wemoCmd represents the wemo command
+var wemoCmd = &cobra.Command{
+	Use:   "wemo",
+	Short: "run one or more virtual Belkin Wemo switches",
+	Long: `Starts a virtual Wemo switch for each --name, serving it on consecutive
+ports from --port and registering it with minissdpd. When a client switches
+a device, --on-cmd or --off-cmd is run with WEMO_NAME set in its environment.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(wemoNames) == 0 {
+			fmt.Fprintln(os.Stderr, "at least one --name must be provided")
+			os.Exit(3)
+		}
+		if wemoIP == "" {
+			ip, err := lanIP()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "could not find an IP address to advertise, use --ip: %v\n", err)
+				os.Exit(3)
+			}
+			wemoIP = ip
+		}
+
+		initLedger()
+		err := client.Connect()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not connect to minissdpd: %v\n", err)
+			os.Exit(2)
+		}
+		defer client.Close()
+
+		for i, name := range wemoNames {
+			name := name
+			s, err := wemo.NewSwitch(name, "", func(on bool) error {
+				return runSwitchCommand(name, on)
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "could not create switch %q: %v\n", name, err)
+				os.Exit(2)
+			}
+
+			h, err := s.Handler()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "could not create switch %q: %v\n", name, err)
+				os.Exit(2)
+			}
+
+			port := strconv.Itoa(wemoPort + i)
+			l, err := net.Listen("tcp", net.JoinHostPort("", port))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "could not listen for switch %q: %v\n", name, err)
+				os.Exit(2)
+			}
+			go http.Serve(l, h)
+
+			baseURL := "http://" + net.JoinHostPort(wemoIP, port)
+			err = s.Register(client, baseURL, "")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "could not register switch %q: %v\n", name, err)
+				os.Exit(2)
+			}
+			fmt.Printf("switch %q (%s) running at %s\n", name, s.UDN(), baseURL+wemo.SetupPath)
+		}
+
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(wemoCmd)
+
+	wemoCmd.Flags().StringArrayVarP(&wemoNames, "name", "n", nil, "friendly `name` of a switch, may be repeated")
+	wemoCmd.Flags().StringVar(&wemoIP, "ip", "", "IP address to advertise (default: the address of the first interface that is up)")
+	wemoCmd.Flags().IntVarP(&wemoPort, "port", "p", 49153, "port for the first switch, incremented for each other switch")
+	wemoCmd.Flags().StringVar(&wemoOnCmd, "on-cmd", "", "shell command run when a switch is turned on")
+	wemoCmd.Flags().StringVar(&wemoOffCmd, "off-cmd", "", "shell command run when a switch is turned off")
+}
+
+// runSwitchCommand runs the on or off command for the named switch
+func runSwitchCommand(name string, on bool) error {
+	command := wemoOffCmd
+	if on {
+		command = wemoOnCmd
+	}
+	if command == "" {
+		return nil
+	}
+
+	c := exec.Command("sh", "-c", command)
+	c.Env = append(os.Environ(), "WEMO_NAME="+name)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	return c.Run()
+}
+
+// lanIP returns the address that {primary-ip} resolves to
+func lanIP() (string, error) {
+	ip, err := minissdpc.PrimaryIP(nil)
+	if err != nil {
+		return "", err
+	}
+	return ip.String(), nil
+}
@@ -0,0 +1,120 @@
+// Copyright © 2018 Dave Russell <forfuncsake@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package daemon runs the loop of the minissdpc daemon command,
+// which keeps the services of a manifest registered and reloads
+// them on request.
+package daemon
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/forfuncsake/minissdpc"
+)
+
+// A Loader returns the services to keep registered
+type Loader func() ([]minissdpc.Service, error)
+
+// Options are the settings of the Registrar run by the daemon
+type Options struct {
+	SocketPath string
+
+	// Interval is the time between checks. The Registrar's
+	// default is used if it is not positive.
+	Interval time.Duration
+
+	// Ledger, if set, records the services that are registered
+	Ledger *minissdpc.Ledger
+
+	// NoValidate skips validation of the services when they are
+	// registered, as well as when the manifest is loaded
+	NoValidate bool
+
+	// AllowLoopback accepts services with a Location on a loopback
+	// address when they are validated
+	AllowLoopback bool
+}
+
+// NewRegistrar returns a Registrar keeping services registered
+// with the settings of o
+func NewRegistrar(o Options, services []minissdpc.Service) *minissdpc.Registrar {
+	r := minissdpc.NewRegistrar(o.SocketPath, services...)
+	r.Client.Ledger = o.Ledger
+	r.Client.SkipValidation = o.NoValidate
+	r.Client.AllowLoopback = o.AllowLoopback
+	if o.Interval > 0 {
+		r.Interval = o.Interval
+	}
+	return r
+}
+
+// Run runs r until ctx is done, logging its events to logger. On
+// every receive from reload, the services are replaced with those
+// returned by load. If they cannot be loaded, the previous services
+// are kept. Run returns once r has stopped and its events are logged.
+func Run(ctx context.Context, r *minissdpc.Registrar, load Loader, reload <-chan struct{}, logger *slog.Logger) {
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		r.Run(ctx)
+	}()
+
+	for {
+		select {
+		case e := <-r.Events():
+			logEvent(logger, e)
+		case <-reload:
+			services, err := load()
+			if err != nil {
+				logger.Error("reload failed, keeping the previous manifest", "err", err)
+				continue
+			}
+			r.SetServices(services)
+			logger.Info("reloaded", "services", len(services))
+		case <-stopped:
+			// r sends no more events once stopped, so those
+			// still queued are the last ones
+			for {
+				select {
+				case e := <-r.Events():
+					logEvent(logger, e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// logEvent logs a Registrar event at a level matching its type
+func logEvent(logger *slog.Logger, e minissdpc.Event) {
+	var attrs []interface{}
+	if e.Service != nil {
+		attrs = append(attrs, "usn", e.Service.USN, "type", e.Service.Type, "location", e.Service.Location)
+	}
+	if e.Err != nil {
+		attrs = append(attrs, "err", e.Err)
+	}
+
+	switch e.Type {
+	case minissdpc.EventDisconnected:
+		logger.Warn(e.Type.String(), attrs...)
+	case minissdpc.EventError:
+		logger.Error(e.Type.String(), attrs...)
+	default:
+		logger.Info(e.Type.String(), attrs...)
+	}
+}
@@ -0,0 +1,211 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forfuncsake/minissdpc"
+	"github.com/forfuncsake/minissdpc/cmd/minissdpc/logging"
+	"github.com/forfuncsake/minissdpc/mock"
+)
+
+// syncBuffer is a log destination that can be read while written
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitFor polls cond until it holds, failing the test after a while
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func hasService(s *mock.Server, usn string) func() bool {
+	return func() bool {
+		for _, svc := range s.Services() {
+			if svc.USN == usn {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// startServer starts a mock server, returning its socket path and
+// a function that stops it
+func startServer(t *testing.T) (*mock.Server, string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "ssdpc-daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "minissdpd.sock")
+
+	// Listening before serving means the socket accepts
+	// connections as soon as this returns
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := mock.NewServer()
+	go s.Serve(l)
+	return s, path, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRun(t *testing.T) {
+	s, path, stop := startServer(t)
+	defer stop()
+
+	first := minissdpc.Service{Type: "urn:Dummy:device:controllee:1", USN: "uuid:1111::urn:Dummy:device:controllee:1",
+		Server: "Dummy 1.0", Location: "http://192.168.1.10/setup.xml"}
+	second := first
+	second.USN = "uuid:2222::urn:Dummy:device:controllee:1"
+
+	var mu sync.Mutex
+	next, loadErr := []minissdpc.Service{first, second}, error(nil)
+	load := func() ([]minissdpc.Service, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return next, loadErr
+	}
+
+	var logs syncBuffer
+	logger, err := logging.New(&logs, logging.Text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRegistrar(Options{SocketPath: path, Interval: time.Hour}, []minissdpc.Service{first})
+	ctx, cancel := context.WithCancel(context.Background())
+	reload := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		Run(ctx, r, load, reload, logger)
+		close(done)
+	}()
+
+	waitFor(t, "the first service", hasService(s, first.USN))
+
+	// A reload registers the new services
+	reload <- struct{}{}
+	waitFor(t, "the reloaded service", hasService(s, second.USN))
+
+	// A failed reload keeps the previous services
+	mu.Lock()
+	next, loadErr = nil, errors.New("bad manifest")
+	mu.Unlock()
+	reload <- struct{}{}
+	waitFor(t, "the reload failure", func() bool {
+		return strings.Contains(logs.String(), "reload failed")
+	})
+	if n := len(r.Services()); n != 2 {
+		t.Fatalf("expected the 2 previous services to be kept, got %d", n)
+	}
+
+	// Cancelling stops the daemon
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+	if !strings.Contains(logs.String(), "registered") {
+		t.Fatalf("registrations were not logged:\n%s", logs.String())
+	}
+	if n := len(r.Events()); n != 0 {
+		t.Fatalf("%d events were left unlogged", n)
+	}
+}
+
+func TestRunValidation(t *testing.T) {
+	s, path, stop := startServer(t)
+	defer stop()
+
+	loopback := minissdpc.Service{Type: "urn:Dummy:device:controllee:1", USN: "uuid:1111::urn:Dummy:device:controllee:1",
+		Server: "Dummy 1.0", Location: "http://127.0.0.1:8080/setup.xml"}
+	load := func() ([]minissdpc.Service, error) { return nil, nil }
+
+	tests := []struct {
+		name       string
+		options    Options
+		registered bool
+	}{
+		{"validated", Options{}, false},
+		{"no validate", Options{NoValidate: true}, true},
+		{"allow loopback", Options{AllowLoopback: true}, true},
+	}
+	for _, test := range tests {
+		var logs syncBuffer
+		logger, err := logging.New(&logs, logging.Text)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test.options.SocketPath = path
+		test.options.Interval = time.Hour
+		r := NewRegistrar(test.options, []minissdpc.Service{loopback})
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			Run(ctx, r, load, nil, logger)
+			close(done)
+		}()
+
+		if test.registered {
+			waitFor(t, test.name+": the loopback service", hasService(s, loopback.USN))
+		} else {
+			waitFor(t, test.name+": the validation error", func() bool {
+				return strings.Contains(logs.String(), "loopback")
+			})
+			if hasService(s, loopback.USN)() {
+				t.Fatalf("%s: the loopback service was registered despite validation", test.name)
+			}
+		}
+		cancel()
+		<-done
+		s.Remove(loopback)
+	}
+}
+
+func TestLogEvent(t *testing.T) {
+	var b bytes.Buffer
+	logger, err := logging.New(&b, logging.JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logEvent(logger, minissdpc.Event{Type: minissdpc.EventDisconnected, Err: errors.New("gone")})
+	if out := b.String(); !strings.Contains(out, `"level":"WARN"`) || !strings.Contains(out, `"err":"gone"`) {
+		t.Fatalf("unexpected log %s", out)
+	}
+}
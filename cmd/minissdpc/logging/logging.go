@@ -0,0 +1,48 @@
+// Copyright © 2018 Dave Russell <forfuncsake@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging creates the structured loggers of the minissdpc
+// commands that take a --log-format flag.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// Log formats
+const (
+	Text = "text"
+	JSON = "json"
+)
+
+// CheckFormat checks that format is Text or JSON
+func CheckFormat(format string) error {
+	if format != Text && format != JSON {
+		return fmt.Errorf("unknown log format %q, must be %s or %s", format, Text, JSON)
+	}
+	return nil
+}
+
+// New returns a logger writing to w in format, Text or JSON
+func New(w io.Writer, format string) (*slog.Logger, error) {
+	if err := CheckFormat(format); err != nil {
+		return nil, err
+	}
+	if format == JSON {
+		return slog.New(slog.NewJSONHandler(w, nil)), nil
+	}
+	return slog.New(slog.NewTextHandler(w, nil)), nil
+}
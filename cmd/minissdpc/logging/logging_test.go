@@ -0,0 +1,32 @@
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		format string
+		expect string
+	}{
+		{Text, `level=INFO msg=started services=2`},
+		{JSON, `"level":"INFO","msg":"started","services":2}`},
+	}
+	for _, test := range tests {
+		var b bytes.Buffer
+		logger, err := New(&b, test.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger.Info("started", "services", 2)
+		if out := b.String(); !strings.Contains(out, test.expect) {
+			t.Errorf("%s: expected %s in %q", test.format, test.expect, out)
+		}
+	}
+
+	if _, err := New(&bytes.Buffer{}, "xml"); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright © 2018 Dave Russell <forfuncsake@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/forfuncsake/minissdpc/description"
+	"github.com/forfuncsake/minissdpc/soap"
+	"gopkg.in/yaml.v2"
+)
+
+// DocumentFormats lists the formats in which the describe and
+// invoke commands write a single document
+var DocumentFormats = []string{Text, JSON, YAML}
+
+// CheckDocumentFormat checks that format is one of DocumentFormats
+func CheckDocumentFormat(format string) error {
+	for _, f := range DocumentFormats {
+		if format == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown output format %q, must be one of %s", format, strings.Join(DocumentFormats, ", "))
+}
+
+// Description is a device description as written by describe.
+// Its field names are the stable interface for scripts.
+type Description struct {
+	Location string `json:"location" yaml:"location"`
+	Device   `yaml:",inline"`
+}
+
+// Device is a root or embedded device of a Description
+type Device struct {
+	Type         string        `json:"type" yaml:"type"`
+	FriendlyName string        `json:"friendly_name" yaml:"friendly_name"`
+	Manufacturer string        `json:"manufacturer" yaml:"manufacturer"`
+	ModelName    string        `json:"model_name" yaml:"model_name"`
+	ModelNumber  string        `json:"model_number,omitempty" yaml:"model_number,omitempty"`
+	SerialNumber string        `json:"serial_number,omitempty" yaml:"serial_number,omitempty"`
+	UDN          string        `json:"udn" yaml:"udn"`
+	Services     []UPnPService `json:"services,omitempty" yaml:"services,omitempty"`
+	Devices      []Device      `json:"devices,omitempty" yaml:"devices,omitempty"`
+}
+
+// UPnPService is a service offered by a Device, with absolute URLs
+type UPnPService struct {
+	Type        string   `json:"type" yaml:"type"`
+	ID          string   `json:"id" yaml:"id"`
+	SCPDURL     string   `json:"scpd_url" yaml:"scpd_url"`
+	ControlURL  string   `json:"control_url" yaml:"control_url"`
+	EventSubURL string   `json:"event_sub_url" yaml:"event_sub_url"`
+	Actions     []Action `json:"actions,omitempty" yaml:"actions,omitempty"`
+}
+
+// Action is an action of a UPnPService, listed when its SCPD was fetched
+type Action struct {
+	Name string   `json:"name" yaml:"name"`
+	In   []string `json:"in,omitempty" yaml:"in,omitempty"`
+	Out  []string `json:"out,omitempty" yaml:"out,omitempty"`
+}
+
+// NewDescription converts root, resolving the URLs of its services
+// against the location that it was fetched from
+func NewDescription(root *description.Root, location string) Description {
+	return Description{
+		Location: location,
+		Device:   newDevice(root, location, root.Device),
+	}
+}
+
+func newDevice(root *description.Root, location string, d description.Device) Device {
+	out := Device{
+		Type:         d.DeviceType,
+		FriendlyName: d.FriendlyName,
+		Manufacturer: d.Manufacturer,
+		ModelName:    d.ModelName,
+		ModelNumber:  d.ModelNumber,
+		SerialNumber: d.SerialNumber,
+		UDN:          d.UDN,
+	}
+	resolve := func(ref string) string {
+		if u, err := root.URL(location, ref); err == nil {
+			return u
+		}
+		return ref
+	}
+
+	for _, s := range d.Services {
+		so := UPnPService{
+			Type:        s.ServiceType,
+			ID:          s.ServiceID,
+			SCPDURL:     resolve(s.SCPDURL),
+			ControlURL:  resolve(s.ControlURL),
+			EventSubURL: resolve(s.EventSubURL),
+		}
+		if s.SCPD != nil {
+			for _, a := range s.SCPD.Actions {
+				ao := Action{Name: a.Name}
+				for _, arg := range a.Arguments {
+					if arg.Direction == description.DirectionOut {
+						ao.Out = append(ao.Out, arg.Name)
+					} else {
+						ao.In = append(ao.In, arg.Name)
+					}
+				}
+				so.Actions = append(so.Actions, ao)
+			}
+		}
+		out.Services = append(out.Services, so)
+	}
+	for _, e := range d.Devices {
+		out.Devices = append(out.Devices, newDevice(root, location, e))
+	}
+	return out
+}
+
+// WriteDescription writes d to w in format, one of DocumentFormats
+func WriteDescription(w io.Writer, format string, d Description) error {
+	switch format {
+	case JSON:
+		return writeJSON(w, d)
+	case YAML:
+		return writeYAML(w, d)
+	}
+
+	fmt.Fprintf(w, "Location: %s\n", d.Location)
+	return writeDevice(w, d.Device, "")
+}
+
+// WriteArgs writes the arguments of an action to w in format, one of
+// DocumentFormats. Text is written as NAME=VALUE lines, so that out
+// arguments may be given back to the invoke command.
+func WriteArgs(w io.Writer, format string, args []soap.Arg) error {
+	if format == Text {
+		for _, a := range args {
+			if _, err := fmt.Fprintf(w, "%s=%s\n", a.Name, a.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	m := make(map[string]string, len(args))
+	for _, a := range args {
+		m[a.Name] = a.Value
+	}
+	if format == JSON {
+		return writeJSON(w, m)
+	}
+	return writeYAML(w, m)
+}
+
+func writeDevice(w io.Writer, d Device, indent string) error {
+	fmt.Fprintf(w, "%s%s (%s)\n", indent, d.FriendlyName, d.Type)
+	indent += "  "
+	fmt.Fprintf(w, "%sUDN:          %s\n", indent, d.UDN)
+	fmt.Fprintf(w, "%sManufacturer: %s\n", indent, d.Manufacturer)
+	fmt.Fprintf(w, "%sModel:        %s\n", indent, strings.TrimSpace(d.ModelName+" "+d.ModelNumber))
+	if d.SerialNumber != "" {
+		fmt.Fprintf(w, "%sSerial:       %s\n", indent, d.SerialNumber)
+	}
+
+	for _, s := range d.Services {
+		fmt.Fprintf(w, "%sService %s (%s)\n", indent, s.Type, s.ID)
+		fmt.Fprintf(w, "%s  Control: %s\n", indent, s.ControlURL)
+		fmt.Fprintf(w, "%s  Events:  %s\n", indent, s.EventSubURL)
+		for _, a := range s.Actions {
+			fmt.Fprintf(w, "%s  %s(%s)", indent, a.Name, strings.Join(a.In, ", "))
+			if len(a.Out) > 0 {
+				fmt.Fprintf(w, " -> %s", strings.Join(a.Out, ", "))
+			}
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+	}
+	for _, e := range d.Devices {
+		if err := writeDevice(w, e, indent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeYAML(w io.Writer, v interface{}) error {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
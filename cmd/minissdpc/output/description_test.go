@@ -0,0 +1,160 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/forfuncsake/minissdpc/description"
+	"github.com/forfuncsake/minissdpc/soap"
+)
+
+// serveDevice serves a device with an embedded device and one service
+func serveDevice(t *testing.T) *httptest.Server {
+	svc, err := (&description.ServiceDefinition{
+		ServiceType: "urn:Belkin:service:basicevent:1",
+		ServiceID:   "urn:Belkin:serviceId:basicevent1",
+		SCPDURL:     "/eventservice.xml",
+		ControlURL:  "/upnp/control/basicevent1",
+		EventSubURL: "/upnp/event/basicevent1",
+		Actions: []description.ActionDefinition{
+			{Name: "GetBinaryState", Out: []description.Arg{{Name: "BinaryState"}}},
+			{Name: "SetBinaryState", In: []description.Arg{{Name: "BinaryState"}}},
+		},
+		Variables: []description.StateVariable{
+			{SendEvents: description.SendEventsYes, Name: "BinaryState", DataType: "boolean"},
+		},
+	}).Service()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := description.New(description.Device{
+		DeviceType:   "urn:Belkin:device:controllee:1",
+		FriendlyName: "Lamp",
+		Manufacturer: "Belkin International Inc.",
+		ModelName:    "Socket",
+		ModelNumber:  "1.0",
+		UDN:          "uuid:Socket-1",
+		Services:     []description.Service{svc},
+		Devices: []description.Device{{
+			DeviceType:   "urn:Belkin:device:sensor:1",
+			FriendlyName: "Lamp Sensor",
+			Manufacturer: "Belkin International Inc.",
+			ModelName:    "Sensor",
+			UDN:          "uuid:Sensor-1",
+		}},
+	})
+	root.Path = "/setup.xml"
+	mux, err := root.ServeMux()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(mux)
+}
+
+// describe fetches the description served by srv, as describe does
+func describe(t *testing.T, srv *httptest.Server, scpds bool) Description {
+	location := srv.URL + "/setup.xml"
+	root, err := description.Fetch(nil, location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scpds {
+		if err := root.FetchSCPDs(nil, location); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewDescription(root, location)
+}
+
+func TestWriteDescription(t *testing.T) {
+	srv := serveDevice(t)
+	defer srv.Close()
+
+	var b bytes.Buffer
+	if err := WriteDescription(&b, Text, describe(t, srv, true)); err != nil {
+		t.Fatal(err)
+	}
+	expect := `Location: URL/setup.xml
+Lamp (urn:Belkin:device:controllee:1)
+  UDN:          uuid:Socket-1
+  Manufacturer: Belkin International Inc.
+  Model:        Socket 1.0
+  Service urn:Belkin:service:basicevent:1 (urn:Belkin:serviceId:basicevent1)
+    Control: URL/upnp/control/basicevent1
+    Events:  URL/upnp/event/basicevent1
+    GetBinaryState() -> BinaryState
+    SetBinaryState(BinaryState)
+  Lamp Sensor (urn:Belkin:device:sensor:1)
+    UDN:          uuid:Sensor-1
+    Manufacturer: Belkin International Inc.
+    Model:        Sensor
+`
+	if out := strings.Replace(b.String(), srv.URL, "URL", -1); out != expect {
+		t.Fatalf("unexpected text output:\n%s", out)
+	}
+
+	// Without the SCPDs, no actions are listed
+	b.Reset()
+	if err := WriteDescription(&b, JSON, describe(t, srv, false)); err != nil {
+		t.Fatal(err)
+	}
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if parsed["location"] != srv.URL+"/setup.xml" || parsed["friendly_name"] != "Lamp" {
+		t.Fatalf("unexpected json output:\n%s", b.String())
+	}
+	services := parsed["services"].([]interface{})
+	svc := services[0].(map[string]interface{})
+	if svc["scpd_url"] != srv.URL+"/eventservice.xml" || svc["actions"] != nil {
+		t.Fatalf("unexpected json service %v", svc)
+	}
+
+	b.Reset()
+	if err := WriteDescription(&b, YAML, describe(t, srv, true)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(b.String(), "location: "+srv.URL+"/setup.xml\ntype: urn:Belkin:device:controllee:1\n") ||
+		!strings.Contains(b.String(), "- name: SetBinaryState\n") {
+		t.Fatalf("unexpected yaml output:\n%s", b.String())
+	}
+}
+
+func TestCheckDocumentFormat(t *testing.T) {
+	for _, format := range DocumentFormats {
+		if err := CheckDocumentFormat(format); err != nil {
+			t.Errorf("%s: %v", format, err)
+		}
+	}
+	for _, format := range []string{Table, CSV, Template, "xml"} {
+		if err := CheckDocumentFormat(format); err == nil {
+			t.Errorf("%s: expected an error", format)
+		}
+	}
+}
+
+func TestWriteArgs(t *testing.T) {
+	args := []soap.Arg{{Name: "BinaryState", Value: "1"}, {Name: "CountdownEndTime", Value: "0"}}
+
+	tests := []struct {
+		format string
+		expect string
+	}{
+		{Text, "BinaryState=1\nCountdownEndTime=0\n"},
+		{JSON, "{\n  \"BinaryState\": \"1\",\n  \"CountdownEndTime\": \"0\"\n}\n"},
+		{YAML, "BinaryState: \"1\"\nCountdownEndTime: \"0\"\n"},
+	}
+	for _, test := range tests {
+		var b bytes.Buffer
+		if err := WriteArgs(&b, test.format, args); err != nil {
+			t.Fatalf("%s: %v", test.format, err)
+		}
+		if b.String() != test.expect {
+			t.Errorf("%s: expected %q, got %q", test.format, test.expect, b.String())
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright © 2018 Dave Russell <forfuncsake@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package output writes services in the formats accepted by the
+// --output flag of the minissdpc commands. The field names of Service
+// are the stable interface for scripts and templates.
+package output
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+)
+
+// Output formats
+const (
+	Text     = "text"
+	JSON     = "json"
+	YAML     = "yaml"
+	Table    = "table"
+	CSV      = "csv"
+	Template = "template"
+)
+
+// Formats lists every output format, in the order they are documented
+var Formats = []string{Text, JSON, YAML, Table, CSV, Template}
+
+// Service is a service as written by the ls commands
+type Service struct {
+	Type         string     `json:"type" yaml:"type"`
+	USN          string     `json:"usn" yaml:"usn"`
+	Location     string     `json:"location" yaml:"location"`
+	Ours         bool       `json:"ours" yaml:"ours"`
+	Owner        string     `json:"owner,omitempty" yaml:"owner,omitempty"`
+	RegisteredAt *time.Time `json:"registered_at,omitempty" yaml:"registered_at,omitempty"`
+}
+
+// Parse checks format and the text of a template. Giving a template
+// with the text format selects the template format. It returns the
+// selected format, and the parsed template if that is Template.
+func Parse(format, text string) (string, *template.Template, error) {
+	if text != "" && format == Text {
+		format = Template
+	}
+
+	switch format {
+	case Text, JSON, YAML, Table, CSV:
+		return format, nil, nil
+	case Template:
+		if text == "" {
+			return format, nil, fmt.Errorf("--template must be provided with --output %s", Template)
+		}
+		t, err := template.New("service").Parse(text)
+		if err != nil {
+			return format, nil, fmt.Errorf("invalid template: %v", err)
+		}
+		return format, t, nil
+	}
+	return format, nil, fmt.Errorf("unknown output format %q, must be one of %s", format, strings.Join(Formats, ", "))
+}
+
+// WriteServices writes services to w in the given format. t is
+// the template returned by Parse, and is only used by Template.
+// No services are written as an empty list, or as nothing at all
+// in the text and template formats.
+func WriteServices(w io.Writer, format string, services []Service, t *template.Template) error {
+	if services == nil {
+		services = []Service{}
+	}
+
+	switch format {
+	case JSON:
+		return writeJSON(w, services)
+
+	case YAML:
+		return writeYAML(w, services)
+
+	case Table:
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "TYPE\tUSN\tLOCATION\tOWNER")
+		for _, s := range services {
+			owner := "-"
+			if s.Ours {
+				owner = s.Owner
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Type, s.USN, s.Location, owner)
+		}
+		return tw.Flush()
+
+	case CSV:
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"type", "usn", "location", "ours", "owner", "registered_at"})
+		for _, s := range services {
+			registered := ""
+			if s.RegisteredAt != nil {
+				registered = s.RegisteredAt.Format(time.RFC3339)
+			}
+			cw.Write([]string{s.Type, s.USN, s.Location, fmt.Sprint(s.Ours), s.Owner, registered})
+		}
+		cw.Flush()
+		return cw.Error()
+
+	case Template:
+		for _, s := range services {
+			if err := t.Execute(w, s); err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, s := range services {
+		fmt.Fprintf(w, "Type: %s\nUSN: %s\nLocation: %s\n", s.Type, s.USN, s.Location)
+		var err error
+		if s.Ours {
+			_, err = fmt.Fprintf(w, "Owner: %s (registered %s)\n\n", s.Owner, s.RegisteredAt.Local().Format("2006-01-02 15:04:05"))
+		} else {
+			_, err = fmt.Fprintf(w, "Owner: none (discovered)\n\n")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
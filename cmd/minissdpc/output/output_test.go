@@ -0,0 +1,144 @@
+package output
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testServices() []Service {
+	registered := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+	return []Service{
+		{
+			Type:         "urn:Belkin:device:controllee:1",
+			USN:          "uuid:Socket-1::urn:Belkin:device:controllee:1",
+			Location:     "http://192.168.1.10:49153/setup.xml",
+			Ours:         true,
+			Owner:        "wemo",
+			RegisteredAt: &registered,
+		},
+		{
+			Type:     "upnp:rootdevice",
+			USN:      "uuid:Bridge-1::upnp:rootdevice",
+			Location: "http://192.168.1.11/description.xml",
+		},
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		format, text string
+		expect       string
+		template     bool
+		err          bool
+	}{
+		{format: Text, expect: Text},
+		{format: JSON, expect: JSON},
+		{format: CSV, expect: CSV},
+		{format: Text, text: "{{.USN}}", expect: Template, template: true},
+		{format: Template, text: "{{.USN}}", expect: Template, template: true},
+		{format: Template, expect: Template, err: true},
+		{format: Template, text: "{{.USN", expect: Template, err: true},
+		{format: "xml", expect: "xml", err: true},
+	}
+
+	for _, test := range tests {
+		format, tmpl, err := Parse(test.format, test.text)
+		if format != test.expect || (tmpl != nil) != test.template || (err != nil) != test.err {
+			t.Errorf("Parse(%q, %q): expected (%s, template %v, error %v), got (%s, %v, %v)",
+				test.format, test.text, test.expect, test.template, test.err, format, tmpl, err)
+		}
+	}
+}
+
+func TestWriteServices(t *testing.T) {
+	local := testServices()[0].RegisteredAt.Local().Format("2006-01-02 15:04:05")
+
+	tests := []struct {
+		name     string
+		format   string
+		template string
+		services []Service
+		expect   string
+	}{
+		{"text", Text, "", testServices(), "Type: urn:Belkin:device:controllee:1\n" +
+			"USN: uuid:Socket-1::urn:Belkin:device:controllee:1\n" +
+			"Location: http://192.168.1.10:49153/setup.xml\n" +
+			"Owner: wemo (registered " + local + ")\n\n" +
+			"Type: upnp:rootdevice\n" +
+			"USN: uuid:Bridge-1::upnp:rootdevice\n" +
+			"Location: http://192.168.1.11/description.xml\n" +
+			"Owner: none (discovered)\n\n"},
+		{"empty text", Text, "", nil, ""},
+
+		{"json", JSON, "", testServices(), `[
+  {
+    "type": "urn:Belkin:device:controllee:1",
+    "usn": "uuid:Socket-1::urn:Belkin:device:controllee:1",
+    "location": "http://192.168.1.10:49153/setup.xml",
+    "ours": true,
+    "owner": "wemo",
+    "registered_at": "2026-10-18T09:30:00Z"
+  },
+  {
+    "type": "upnp:rootdevice",
+    "usn": "uuid:Bridge-1::upnp:rootdevice",
+    "location": "http://192.168.1.11/description.xml",
+    "ours": false
+  }
+]
+`},
+		{"empty json", JSON, "", nil, "[]\n"},
+		{"empty json slice", JSON, "", []Service{}, "[]\n"},
+
+		{"yaml", YAML, "", testServices()[1:], `- type: upnp:rootdevice
+  usn: uuid:Bridge-1::upnp:rootdevice
+  location: http://192.168.1.11/description.xml
+  ours: false
+`},
+		{"empty yaml", YAML, "", nil, "[]\n"},
+
+		{"table", Table, "", testServices(), "" +
+			"TYPE                            USN                                            LOCATION                             OWNER\n" +
+			"urn:Belkin:device:controllee:1  uuid:Socket-1::urn:Belkin:device:controllee:1  http://192.168.1.10:49153/setup.xml  wemo\n" +
+			"upnp:rootdevice                 uuid:Bridge-1::upnp:rootdevice                 http://192.168.1.11/description.xml  -\n"},
+		{"empty table", Table, "", nil, "TYPE  USN  LOCATION  OWNER\n"},
+
+		{"csv", CSV, "", testServices(), "type,usn,location,ours,owner,registered_at\n" +
+			"urn:Belkin:device:controllee:1,uuid:Socket-1::urn:Belkin:device:controllee:1,http://192.168.1.10:49153/setup.xml,true,wemo,2026-10-18T09:30:00Z\n" +
+			"upnp:rootdevice,uuid:Bridge-1::upnp:rootdevice,http://192.168.1.11/description.xml,false,,\n"},
+		{"empty csv", CSV, "", nil, "type,usn,location,ours,owner,registered_at\n"},
+
+		{"template", Template, "{{.USN}} {{.Ours}}", testServices(),
+			"uuid:Socket-1::urn:Belkin:device:controllee:1 true\nuuid:Bridge-1::upnp:rootdevice false\n"},
+		{"empty template", Template, "{{.USN}}", nil, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			format, tmpl, err := Parse(test.format, test.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := WriteServices(&buf, format, test.services, tmpl); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != test.expect {
+				t.Errorf("expected:\n%s\ngot:\n%s", test.expect, buf.String())
+			}
+		})
+	}
+}
+
+func TestWriteServicesTemplateError(t *testing.T) {
+	_, tmpl, err := Parse(Template, "{{.Missing}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = WriteServices(&bytes.Buffer{}, Template, testServices(), tmpl)
+	if err == nil || !strings.Contains(err.Error(), "Missing") {
+		t.Fatalf("expected template execution error, got %v", err)
+	}
+}
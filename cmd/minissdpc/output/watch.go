@@ -0,0 +1,153 @@
+// Copyright © 2018 Dave Russell <forfuncsake@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/template"
+	"time"
+
+	"github.com/forfuncsake/minissdpc"
+	"gopkg.in/yaml.v2"
+)
+
+// Change is a service appearing, disappearing or changing,
+// as written by the watch command
+type Change struct {
+	Time    time.Time `json:"time" yaml:"time"`
+	Change  string    `json:"change" yaml:"change"`
+	Service `yaml:",inline"`
+}
+
+// NewChange returns c as written, with s holding c.Service
+func NewChange(c minissdpc.Change, s Service) Change {
+	return Change{Time: c.Time, Change: c.Type.String(), Service: s}
+}
+
+// A ChangeWriter writes each change as an event in a format
+type ChangeWriter struct {
+	w      io.Writer
+	format string
+	t      *template.Template
+	csv    *csv.Writer
+	header bool
+}
+
+// NewChangeWriter returns a ChangeWriter for one of Formats. t is
+// the template returned by Parse, and is only used by Template.
+func NewChangeWriter(w io.Writer, format string, t *template.Template) *ChangeWriter {
+	return &ChangeWriter{w: w, format: format, t: t}
+}
+
+// Write writes c. The table and CSV formats start with a header.
+func (p *ChangeWriter) Write(c Change) error {
+	switch p.format {
+	case JSON:
+		// One object per line, for jq and friends
+		return json.NewEncoder(p.w).Encode(c)
+
+	case YAML:
+		b, err := yaml.Marshal(c)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(p.w, "---\n%s", b)
+		return err
+
+	case CSV:
+		if p.csv == nil {
+			p.csv = csv.NewWriter(p.w)
+			p.csv.Write([]string{"time", "change", "type", "usn", "location", "ours", "owner"})
+		}
+		p.csv.Write([]string{c.Time.Format(time.RFC3339), c.Change, c.Type, c.USN, c.Location,
+			fmt.Sprint(c.Ours), c.Owner})
+		p.csv.Flush()
+		return p.csv.Error()
+
+	case Template:
+		if err := p.t.Execute(p.w, c); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintln(p.w)
+		return err
+
+	case Table:
+		if !p.header {
+			p.header = true
+			fmt.Fprintf(p.w, "%-25s  %-7s  %s\n", "TIME", "CHANGE", "TYPE / USN / LOCATION")
+		}
+	}
+
+	ours := ""
+	if c.Ours {
+		ours = " (ours)"
+	}
+	_, err := fmt.Fprintf(p.w, "%-25s  %-7s  %s %s %s%s\n", c.Time.Format(time.RFC3339), c.Change,
+		c.Type, c.USN, c.Location, ours)
+	return err
+}
+
+// A LiveView keeps the set of services up to date and redraws it in
+// place, as the watch --live command does
+type LiveView struct {
+	w        io.Writer
+	format   string
+	t        *template.Template
+	services []Service
+}
+
+// NewLiveView returns a LiveView that writes the services in one of
+// Formats, as WriteServices does
+func NewLiveView(w io.Writer, format string, t *template.Template) *LiveView {
+	return &LiveView{w: w, format: format, t: t}
+}
+
+// Update applies the changes, in order, then clears the screen
+// and writes the services
+func (v *LiveView) Update(changes ...Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	for _, c := range changes {
+		v.apply(c)
+	}
+
+	last := changes[len(changes)-1]
+	// Clear the screen and move the cursor home
+	fmt.Fprint(v.w, "\033[H\033[2J")
+	fmt.Fprintf(v.w, "%d services, last change %s at %s\n\n", len(v.services), last.Change, last.Time.Format(time.RFC3339))
+	return WriteServices(v.w, v.format, v.services, v.t)
+}
+
+func (v *LiveView) apply(c Change) {
+	i := 0
+	for ; i < len(v.services); i++ {
+		if v.services[i].USN == c.USN && v.services[i].Type == c.Type {
+			break
+		}
+	}
+	switch {
+	case c.Change == minissdpc.ChangeRemoved.String() && i < len(v.services):
+		v.services = append(v.services[:i], v.services[i+1:]...)
+	case c.Change == minissdpc.ChangeRemoved.String():
+	case i < len(v.services):
+		v.services[i] = c.Service
+	default:
+		v.services = append(v.services, c.Service)
+	}
+}
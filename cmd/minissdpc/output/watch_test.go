@@ -0,0 +1,130 @@
+package output
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testChanges() []Change {
+	at := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+	services := testServices()
+	return []Change{
+		{Time: at, Change: "added", Service: services[0]},
+		{Time: at.Add(time.Second), Change: "removed", Service: services[1]},
+	}
+}
+
+func TestChangeWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		template string
+		expect   string
+	}{
+		{"text", Text, "", "" +
+			"2026-10-18T09:30:00Z       added    urn:Belkin:device:controllee:1 uuid:Socket-1::urn:Belkin:device:controllee:1 http://192.168.1.10:49153/setup.xml (ours)\n" +
+			"2026-10-18T09:30:01Z       removed  upnp:rootdevice uuid:Bridge-1::upnp:rootdevice http://192.168.1.11/description.xml\n"},
+		{"table", Table, "", "" +
+			"TIME                       CHANGE   TYPE / USN / LOCATION\n" +
+			"2026-10-18T09:30:00Z       added    urn:Belkin:device:controllee:1 uuid:Socket-1::urn:Belkin:device:controllee:1 http://192.168.1.10:49153/setup.xml (ours)\n" +
+			"2026-10-18T09:30:01Z       removed  upnp:rootdevice uuid:Bridge-1::upnp:rootdevice http://192.168.1.11/description.xml\n"},
+		{"json", JSON, "", "" +
+			`{"time":"2026-10-18T09:30:00Z","change":"added","type":"urn:Belkin:device:controllee:1","usn":"uuid:Socket-1::urn:Belkin:device:controllee:1","location":"http://192.168.1.10:49153/setup.xml","ours":true,"owner":"wemo","registered_at":"2026-10-18T09:30:00Z"}` + "\n" +
+			`{"time":"2026-10-18T09:30:01Z","change":"removed","type":"upnp:rootdevice","usn":"uuid:Bridge-1::upnp:rootdevice","location":"http://192.168.1.11/description.xml","ours":false}` + "\n"},
+		{"yaml", YAML, "", "" +
+			"---\ntime: 2026-10-18T09:30:00Z\nchange: added\ntype: urn:Belkin:device:controllee:1\n" +
+			"usn: uuid:Socket-1::urn:Belkin:device:controllee:1\nlocation: http://192.168.1.10:49153/setup.xml\n" +
+			"ours: true\nowner: wemo\nregistered_at: 2026-10-18T09:30:00Z\n" +
+			"---\ntime: 2026-10-18T09:30:01Z\nchange: removed\ntype: upnp:rootdevice\n" +
+			"usn: uuid:Bridge-1::upnp:rootdevice\nlocation: http://192.168.1.11/description.xml\nours: false\n"},
+		{"csv", CSV, "", "time,change,type,usn,location,ours,owner\n" +
+			"2026-10-18T09:30:00Z,added,urn:Belkin:device:controllee:1,uuid:Socket-1::urn:Belkin:device:controllee:1,http://192.168.1.10:49153/setup.xml,true,wemo\n" +
+			"2026-10-18T09:30:01Z,removed,upnp:rootdevice,uuid:Bridge-1::upnp:rootdevice,http://192.168.1.11/description.xml,false,\n"},
+		{"template", Template, "{{.Change}} {{.USN}}", "" +
+			"added uuid:Socket-1::urn:Belkin:device:controllee:1\n" +
+			"removed uuid:Bridge-1::upnp:rootdevice\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			format, tmpl, err := Parse(test.format, test.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			p := NewChangeWriter(&buf, format, tmpl)
+			for _, c := range testChanges() {
+				if err := p.Write(c); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if buf.String() != test.expect {
+				t.Errorf("expected:\n%s\ngot:\n%s", test.expect, buf.String())
+			}
+		})
+	}
+}
+
+func TestLiveView(t *testing.T) {
+	var buf bytes.Buffer
+	format, tmpl, err := Parse(Template, "{{.USN}} {{.Location}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := NewLiveView(&buf, format, tmpl)
+
+	services := testServices()
+	at := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+	moved := services[1]
+	moved.Location = "http://192.168.1.12/description.xml"
+
+	steps := []struct {
+		changes []Change
+		expect  string
+	}{
+		{
+			[]Change{
+				{Time: at, Change: "added", Service: services[0]},
+				{Time: at, Change: "added", Service: services[1]},
+			},
+			"2 services, last change added at 2026-10-18T09:30:00Z\n\n" +
+				"uuid:Socket-1::urn:Belkin:device:controllee:1 http://192.168.1.10:49153/setup.xml\n" +
+				"uuid:Bridge-1::upnp:rootdevice http://192.168.1.11/description.xml\n",
+		},
+		{
+			[]Change{{Time: at.Add(time.Second), Change: "updated", Service: moved}},
+			"2 services, last change updated at 2026-10-18T09:30:01Z\n\n" +
+				"uuid:Socket-1::urn:Belkin:device:controllee:1 http://192.168.1.10:49153/setup.xml\n" +
+				"uuid:Bridge-1::upnp:rootdevice http://192.168.1.12/description.xml\n",
+		},
+		{
+			// Removing a service that is not listed changes nothing
+			[]Change{
+				{Time: at.Add(2 * time.Second), Change: "removed", Service: services[0]},
+				{Time: at.Add(3 * time.Second), Change: "removed", Service: services[0]},
+			},
+			"1 services, last change removed at 2026-10-18T09:30:03Z\n\n" +
+				"uuid:Bridge-1::upnp:rootdevice http://192.168.1.12/description.xml\n",
+		},
+	}
+	for i, step := range steps {
+		buf.Reset()
+		if err := v.Update(step.changes...); err != nil {
+			t.Fatal(err)
+		}
+		out := buf.String()
+		if !strings.HasPrefix(out, "\033[H\033[2J") {
+			t.Fatalf("step %d: expected the screen to be cleared, got %q", i, out)
+		}
+		if out = strings.TrimPrefix(out, "\033[H\033[2J"); out != step.expect {
+			t.Errorf("step %d: expected:\n%s\ngot:\n%s", i, step.expect, out)
+		}
+	}
+
+	buf.Reset()
+	if err := v.Update(); err != nil || buf.Len() != 0 {
+		t.Fatalf("expected an empty update to write nothing, got %q, %v", buf.String(), err)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright © 2018 Dave Russell <forfuncsake@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package shell parses and runs the command lines of the minissdpc
+// shell command, independently of the terminal and of minissdpd.
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var errUnterminatedQuote = errors.New("unterminated quote")
+
+// A Command is a command understood by the shell
+type Command struct {
+	Name  string
+	Usage string
+	Help  string
+
+	// Run runs the command with its arguments. It is nil for
+	// commands handled by the caller, such as exit.
+	Run func(args []string) error
+}
+
+// A UsageError reports a command used wrongly, rather than a failure
+// of the connection to minissdpd
+type UsageError string
+
+func (e UsageError) Error() string {
+	return string(e)
+}
+
+// Usage returns the UsageError for the named command
+func Usage(commands []Command, name string) error {
+	for _, c := range commands {
+		if c.Name == name {
+			return UsageError("usage: " + c.Usage)
+		}
+	}
+	return UsageError("usage: " + name)
+}
+
+// Run runs the command named by args[0] with the rest of args,
+// writing any error to w. If the command fails other than with a
+// UsageError, the connection may be broken, and reconnect is called.
+func Run(commands []Command, args []string, w io.Writer, reconnect func() error) {
+	for _, c := range commands {
+		if c.Name != args[0] || c.Run == nil {
+			continue
+		}
+		err := c.Run(args[1:])
+		if err == nil {
+			return
+		}
+		fmt.Fprintln(w, err)
+		if _, usage := err.(UsageError); usage {
+			return
+		}
+		if err := reconnect(); err != nil {
+			fmt.Fprintf(w, "could not reconnect to minissdpd: %v\n", err)
+		}
+		return
+	}
+	fmt.Fprintf(w, "unknown command %q, type help for the list of commands\n", args[0])
+}
+
+// SplitArgs splits a command line into words, keeping the text
+// between single or double quotes together
+func SplitArgs(line string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errUnterminatedQuote
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
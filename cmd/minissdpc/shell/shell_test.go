@@ -0,0 +1,98 @@
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line   string
+		expect []string
+	}{
+		{"", nil},
+		{"   \t ", nil},
+		{"ls", []string{"ls"}},
+		{"  type  urn:Belkin:\t", []string{"type", "urn:Belkin:"}},
+		{`register a b "Linux UPnP/1.0" http://x/`, []string{"register", "a", "b", "Linux UPnP/1.0", "http://x/"}},
+		{`output template '{{.USN}} "{{.Type}}"'`, []string{"output", "template", `{{.USN}} "{{.Type}}"`}},
+		{`a""b`, []string{"ab"}},
+		{`""`, []string{""}},
+		{`x "" y`, []string{"x", "", "y"}},
+	}
+	for _, test := range tests {
+		got, err := SplitArgs(test.line)
+		if err != nil {
+			t.Fatalf("%q: %v", test.line, err)
+		}
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Fatalf("%q: expected %q, got %q", test.line, test.expect, got)
+		}
+	}
+
+	for _, line := range []string{`"abc`, `register 'a b`} {
+		if _, err := SplitArgs(line); err != errUnterminatedQuote {
+			t.Fatalf("%q: expected errUnterminatedQuote, got %v", line, err)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	var ran []string
+	commands := []Command{
+		{Name: "ok", Usage: "ok", Run: func(args []string) error {
+			ran = append(ran, args...)
+			return nil
+		}},
+		{Name: "misused", Usage: "misused ARG", Run: func([]string) error {
+			return Usage(nil, "misused")
+		}},
+		{Name: "broken", Usage: "broken", Run: func([]string) error {
+			return errors.New("connection reset")
+		}},
+		{Name: "exit", Usage: "exit"},
+	}
+
+	tests := []struct {
+		args       []string
+		reconnect  error
+		output     string
+		reconnects int
+	}{
+		{[]string{"ok", "a", "b"}, nil, "", 0},
+		{[]string{"misused"}, nil, "usage: misused\n", 0},
+		{[]string{"broken"}, nil, "connection reset\n", 1},
+		{[]string{"broken"}, errors.New("no socket"), "connection reset\ncould not reconnect to minissdpd: no socket\n", 1},
+		{[]string{"exit"}, nil, "unknown command \"exit\", type help for the list of commands\n", 0},
+		{[]string{"nope"}, nil, "unknown command \"nope\", type help for the list of commands\n", 0},
+	}
+	for _, test := range tests {
+		var w bytes.Buffer
+		reconnects := 0
+		Run(commands, test.args, &w, func() error {
+			reconnects++
+			return test.reconnect
+		})
+		if w.String() != test.output {
+			t.Errorf("%q: expected output %q, got %q", test.args, test.output, w.String())
+		}
+		if reconnects != test.reconnects {
+			t.Errorf("%q: expected %d reconnects, got %d", test.args, test.reconnects, reconnects)
+		}
+	}
+	if !reflect.DeepEqual(ran, []string{"a", "b"}) {
+		t.Fatalf("unexpected arguments %q", ran)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	commands := []Command{{Name: "type", Usage: "type PREFIX"}}
+	if err := Usage(commands, "type"); err != UsageError("usage: type PREFIX") {
+		t.Fatalf("unexpected usage %v", err)
+	}
+	if err := Usage(commands, "other"); err != UsageError("usage: other") {
+		t.Fatalf("unexpected usage %v", err)
+	}
+}
@@ -0,0 +1,319 @@
+// Package description models the UPnP Device Description document
+// that is served from the Location of an advertised SSDP service,
+// and produces the minissdpc.Service entries that advertise it.
+// The service descriptions (SCPD) referenced by a device can be
+// declared in Go and served alongside it.
+package description
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/forfuncsake/minissdpc"
+)
+
+// DeviceNamespace is the XML namespace of a device description
+const DeviceNamespace = "urn:schemas-upnp-org:device-1-0"
+
+// DefaultPath is the path a document is served at if Root.Path is empty
+const DefaultPath = "/description.xml"
+
+var (
+	errInvalidUDN   = errors.New("device UDN is not of the form uuid:<id>")
+	errNoDeviceType = errors.New("device has no deviceType")
+
+	errRelativeSCPDURL = errors.New("SCPDURL must be an absolute path to be served")
+	errDuplicatePath   = errors.New("path is already being served")
+)
+
+// SpecVersion is the version of the UPnP Device Architecture
+// that a document conforms to
+type SpecVersion struct {
+	Major int `xml:"major"`
+	Minor int `xml:"minor"`
+}
+
+// Root is the root element of a device description document
+type Root struct {
+	XMLName     xml.Name    `xml:"urn:schemas-upnp-org:device-1-0 root"`
+	SpecVersion SpecVersion `xml:"specVersion"`
+	URLBase     string      `xml:"URLBase,omitempty"`
+	Device      Device      `xml:"device"`
+
+	// Path is the path the document is served at by ServeMux, and
+	// the path of the Location advertised by Services, so that the
+	// two cannot differ. DefaultPath is used if it is empty.
+	Path string `xml:"-"`
+}
+
+// Device describes a root or embedded UPnP device
+type Device struct {
+	DeviceType       string `xml:"deviceType"`
+	FriendlyName     string `xml:"friendlyName"`
+	Manufacturer     string `xml:"manufacturer"`
+	ManufacturerURL  string `xml:"manufacturerURL,omitempty"`
+	ModelDescription string `xml:"modelDescription,omitempty"`
+	ModelName        string `xml:"modelName"`
+	ModelNumber      string `xml:"modelNumber,omitempty"`
+	ModelURL         string `xml:"modelURL,omitempty"`
+	SerialNumber     string `xml:"serialNumber,omitempty"`
+	UDN              string `xml:"UDN"`
+	UPC              string `xml:"UPC,omitempty"`
+
+	Icons    []Icon    `xml:"iconList>icon,omitempty"`
+	Services []Service `xml:"serviceList>service,omitempty"`
+	Devices  []Device  `xml:"deviceList>device,omitempty"`
+
+	PresentationURL string `xml:"presentationURL,omitempty"`
+
+	// Extra holds vendor specific elements of the device,
+	// such as the macAddress and binaryState of a Wemo
+	Extra []Element `xml:",any"`
+}
+
+// Icon describes an image that a control point may display
+// for the device
+type Icon struct {
+	Mimetype string `xml:"mimetype"`
+	Width    int    `xml:"width"`
+	Height   int    `xml:"height"`
+	Depth    int    `xml:"depth"`
+	URL      string `xml:"url"`
+}
+
+// Service describes a service offered by a device
+type Service struct {
+	ServiceType string `xml:"serviceType"`
+	ServiceID   string `xml:"serviceId"`
+	SCPDURL     string `xml:"SCPDURL"`
+	ControlURL  string `xml:"controlURL"`
+	EventSubURL string `xml:"eventSubURL"`
+
+	// SCPD describes the actions and state of the service.
+	// If set, it is served at SCPDURL by Root.ServeMux.
+	SCPD *SCPD `xml:"-"`
+}
+
+// Element is a simple XML element with text content
+type Element struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+// New returns a UPnP 1.0 device description for the given device
+func New(d Device) *Root {
+	return &Root{
+		SpecVersion: SpecVersion{Major: 1, Minor: 0},
+		Device:      d,
+	}
+}
+
+// Parse decodes a device description document
+func Parse(b []byte) (*Root, error) {
+	r := &Root{}
+	err := xml.Unmarshal(b, r)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse device description: %v", err)
+	}
+	return r, nil
+}
+
+// Marshal renders the document as XML, including the XML declaration
+func (r *Root) Marshal() ([]byte, error) {
+	b, err := xml.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("could not render device description: %v", err)
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+// ServeHTTP serves the rendered document, so that the Root can be
+// registered as the handler for the path in the advertised Location
+func (r *Root) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	serveXML(w, req, r.Marshal)
+}
+
+// ServeMux returns a mux that serves the document at its Path and
+// the SCPD of every service that has one at its SCPDURL. Further
+// handlers, such as those for control and eventing, may be added
+// to the returned mux.
+func (r *Root) ServeMux() (*http.ServeMux, error) {
+	path := r.path()
+	mux := http.NewServeMux()
+	mux.Handle(path, r)
+
+	err := r.Device.handleSCPDs(mux, map[string]bool{path: true})
+	if err != nil {
+		return nil, err
+	}
+	return mux, nil
+}
+
+func (d *Device) handleSCPDs(mux *http.ServeMux, seen map[string]bool) error {
+	for _, s := range d.Services {
+		if s.SCPD == nil {
+			continue
+		}
+		if !strings.HasPrefix(s.SCPDURL, "/") {
+			return fmt.Errorf("%v: %q", errRelativeSCPDURL, s.SCPDURL)
+		}
+		if seen[s.SCPDURL] {
+			return fmt.Errorf("%v: %q", errDuplicatePath, s.SCPDURL)
+		}
+		seen[s.SCPDURL] = true
+		mux.Handle(s.SCPDURL, s.SCPD)
+	}
+	for i := range d.Devices {
+		if err := d.Devices[i].handleSCPDs(mux, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func serveXML(w http.ResponseWriter, req *http.Request, marshal func() ([]byte, error)) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	b, err := marshal()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(b))
+}
+
+// Location returns the URL of the document when it is served at
+// its Path on baseURL, the scheme and host of the server
+func (r *Root) Location(baseURL string) string {
+	return strings.TrimSuffix(baseURL, "/") + r.path()
+}
+
+func (r *Root) path() string {
+	if r.Path == "" {
+		return DefaultPath
+	}
+	return r.Path
+}
+
+// Advertisement returns the DeviceAdvertisement describing the root
+// device and all embedded devices, with the Location of the document
+// served on baseURL
+func (r *Root) Advertisement(baseURL, server string) (minissdpc.DeviceAdvertisement, error) {
+	d, err := r.Device.advertisement()
+	if err != nil {
+		return d, err
+	}
+	d.Location = r.Location(baseURL)
+	d.Server = server
+	return d, nil
+}
+
+// Services returns the full set of SSDP entries that advertise the
+// document being served at its Path on baseURL
+func (r *Root) Services(baseURL, server string) ([]minissdpc.Service, error) {
+	d, err := r.Advertisement(baseURL, server)
+	if err != nil {
+		return nil, err
+	}
+	return d.Services(), nil
+}
+
+// deviceXML mirrors Device for marshalling, but holds the lists by
+// pointer so that empty lists are omitted rather than rendered empty
+type deviceXML struct {
+	DeviceType       string `xml:"deviceType"`
+	FriendlyName     string `xml:"friendlyName"`
+	Manufacturer     string `xml:"manufacturer"`
+	ManufacturerURL  string `xml:"manufacturerURL,omitempty"`
+	ModelDescription string `xml:"modelDescription,omitempty"`
+	ModelName        string `xml:"modelName"`
+	ModelNumber      string `xml:"modelNumber,omitempty"`
+	ModelURL         string `xml:"modelURL,omitempty"`
+	SerialNumber     string `xml:"serialNumber,omitempty"`
+	UDN              string `xml:"UDN"`
+	UPC              string `xml:"UPC,omitempty"`
+
+	Icons    *iconList    `xml:"iconList"`
+	Services *serviceList `xml:"serviceList"`
+	Devices  *deviceList  `xml:"deviceList"`
+
+	PresentationURL string    `xml:"presentationURL,omitempty"`
+	Extra           []Element `xml:",any"`
+}
+
+type iconList struct {
+	Icon []Icon `xml:"icon"`
+}
+
+type serviceList struct {
+	Service []Service `xml:"service"`
+}
+
+type deviceList struct {
+	Device []Device `xml:"device"`
+}
+
+// MarshalXML implements xml.Marshaler
+func (d Device) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	out := deviceXML{
+		DeviceType:       d.DeviceType,
+		FriendlyName:     d.FriendlyName,
+		Manufacturer:     d.Manufacturer,
+		ManufacturerURL:  d.ManufacturerURL,
+		ModelDescription: d.ModelDescription,
+		ModelName:        d.ModelName,
+		ModelNumber:      d.ModelNumber,
+		ModelURL:         d.ModelURL,
+		SerialNumber:     d.SerialNumber,
+		UDN:              d.UDN,
+		UPC:              d.UPC,
+		PresentationURL:  d.PresentationURL,
+		Extra:            d.Extra,
+	}
+	if len(d.Icons) > 0 {
+		out.Icons = &iconList{d.Icons}
+	}
+	if len(d.Services) > 0 {
+		out.Services = &serviceList{d.Services}
+	}
+	if len(d.Devices) > 0 {
+		out.Devices = &deviceList{d.Devices}
+	}
+	return e.EncodeElement(out, start)
+}
+
+func (d *Device) advertisement() (minissdpc.DeviceAdvertisement, error) {
+	a := minissdpc.DeviceAdvertisement{
+		UUID:       d.UDN,
+		DeviceType: d.DeviceType,
+	}
+	if !strings.HasPrefix(d.UDN, "uuid:") || len(d.UDN) == len("uuid:") {
+		return a, fmt.Errorf("%v: %q", errInvalidUDN, d.FriendlyName)
+	}
+	if d.DeviceType == "" {
+		return a, fmt.Errorf("%v: %q", errNoDeviceType, d.FriendlyName)
+	}
+
+	for _, s := range d.Services {
+		a.ServiceTypes = append(a.ServiceTypes, s.ServiceType)
+	}
+	for i := range d.Devices {
+		e, err := d.Devices[i].advertisement()
+		if err != nil {
+			return a, err
+		}
+		a.Devices = append(a.Devices, e)
+	}
+	return a, nil
+}
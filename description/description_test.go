@@ -0,0 +1,201 @@
+package description
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/forfuncsake/minissdpc"
+)
+
+func testRoot() *Root {
+	r := New(Device{
+		DeviceType:   "urn:Belkin:device:controllee:1",
+		FriendlyName: "Lamp",
+		Manufacturer: "Belkin International Inc.",
+		ModelName:    "Socket",
+		ModelNumber:  "1.0",
+		SerialNumber: "221517K0101769",
+		UDN:          "uuid:Socket-1_0-221517K0101769",
+		Services: []Service{
+			{
+				ServiceType: "urn:Belkin:service:basicevent:1",
+				ServiceID:   "urn:Belkin:serviceId:basicevent1",
+				SCPDURL:     "/eventservice.xml",
+				ControlURL:  "/upnp/control/basicevent1",
+				EventSubURL: "/upnp/event/basicevent1",
+			},
+		},
+		Devices: []Device{
+			{
+				DeviceType:   "urn:Belkin:device:sensor:1",
+				FriendlyName: "Lamp Sensor",
+				UDN:          "uuid:Sensor-1_0-221517K0101770",
+			},
+		},
+		Extra: []Element{
+			{XMLName: xml.Name{Local: "macAddress"}, Value: "94103E000000"},
+			{XMLName: xml.Name{Local: "binaryState"}, Value: "0"},
+		},
+	})
+	r.Path = "/setup.xml"
+	return r
+}
+
+func TestMarshalParse(t *testing.T) {
+	root := testRoot()
+
+	b, err := root.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := string(b)
+	for _, expect := range []string{
+		xml.Header,
+		`<root xmlns="urn:schemas-upnp-org:device-1-0">`,
+		"<specVersion>\n    <major>1</major>\n    <minor>0</minor>\n  </specVersion>",
+		"<serviceList>\n      <service>\n        <serviceType>urn:Belkin:service:basicevent:1</serviceType>",
+		"<SCPDURL>/eventservice.xml</SCPDURL>",
+		"<deviceList>\n      <device>",
+		"<macAddress>94103E000000</macAddress>",
+	} {
+		if !strings.Contains(doc, expect) {
+			t.Errorf("expected document to contain %q", expect)
+		}
+	}
+	if strings.Contains(doc, "iconList") {
+		t.Error("empty iconList should be omitted")
+	}
+
+	parsed, err := Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The parsed XMLName has the namespace populated, and the
+	// path is not part of the document
+	parsed.XMLName = xml.Name{}
+	parsed.Path = root.Path
+	for i := range parsed.Device.Extra {
+		parsed.Device.Extra[i].XMLName.Space = ""
+	}
+	if !reflect.DeepEqual(parsed, root) {
+		t.Logf("expected: %#v\n", root)
+		t.Logf("     got: %#v\n", parsed)
+		t.Fatal("mismatched document after round trip")
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	root := testRoot()
+	srv := httptest.NewServer(root)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/setup.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %s", resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/xml") {
+		t.Fatalf("unexpected content type: %s", ct)
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Device.UDN != root.Device.UDN {
+		t.Fatalf("served document has UDN %q", parsed.Device.UDN)
+	}
+
+	resp, err = http.Post(srv.URL+"/setup.xml", "text/xml", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected POST to be rejected, got %s", resp.Status)
+	}
+}
+
+func TestServices(t *testing.T) {
+	const (
+		baseURL  = "http://192.168.1.10:49153/"
+		location = "http://192.168.1.10:49153/setup.xml"
+		server   = "Linux/3.10 UPnP/1.0 minissdpc/1.0"
+	)
+
+	services, err := testRoot().Services(baseURL, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := "uuid:Socket-1_0-221517K0101769"
+	sensor := "uuid:Sensor-1_0-221517K0101770"
+	expect := []minissdpc.Service{
+		{Type: minissdpc.NTRootDevice, USN: root + "::upnp:rootdevice", Server: server, Location: location},
+		{Type: root, USN: root, Server: server, Location: location},
+		{Type: "urn:Belkin:device:controllee:1", USN: root + "::urn:Belkin:device:controllee:1", Server: server, Location: location},
+		{Type: "urn:Belkin:service:basicevent:1", USN: root + "::urn:Belkin:service:basicevent:1", Server: server, Location: location},
+		{Type: sensor, USN: sensor, Server: server, Location: location},
+		{Type: "urn:Belkin:device:sensor:1", USN: sensor + "::urn:Belkin:device:sensor:1", Server: server, Location: location},
+	}
+	if !reflect.DeepEqual(services, expect) {
+		t.Logf("expected: %v\n", expect)
+		t.Logf("     got: %v\n", services)
+		t.Fatal("mismatched services")
+	}
+
+	bad := testRoot()
+	bad.Device.Devices[0].UDN = "Sensor-1_0-221517K0101770"
+	if _, err := bad.Services(baseURL, server); err == nil {
+		t.Fatal("expected error for embedded device without uuid: UDN")
+	}
+}
+
+func TestLocation(t *testing.T) {
+	root := testRoot()
+	for _, baseURL := range []string{"http://192.168.1.10:49153", "http://192.168.1.10:49153/"} {
+		if loc := root.Location(baseURL); loc != "http://192.168.1.10:49153/setup.xml" {
+			t.Errorf("%s: unexpected location %s", baseURL, loc)
+		}
+	}
+
+	// The mux serves the document at the advertised Location
+	mux, err := root.ServeMux()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	services, err := root.Services(srv.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(services[0].Location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: %s", services[0].Location, resp.Status)
+	}
+
+	root.Path = ""
+	if loc := root.Location("http://192.168.1.10"); loc != "http://192.168.1.10"+DefaultPath {
+		t.Errorf("expected the default path, got %s", loc)
+	}
+}
@@ -0,0 +1,181 @@
+package description
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/forfuncsake/minissdpc"
+)
+
+// maxDocumentSize limits the size of a fetched description, so that
+// a misbehaving device cannot exhaust memory
+const maxDocumentSize = 1 << 20
+
+var (
+	errTooLarge   = errors.New("document is larger than 1MiB")
+	errNoLocation = errors.New("no service matches that USN")
+)
+
+// DefaultClient is used to fetch documents when no client is given
+var DefaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// FindLocation returns the Location of the services whose USN starts
+// with usn, such as those returned by minissdpd for a query by usn.
+// Several services share a Location, but usn must not match services
+// at different ones, unless one of them has exactly that USN.
+func FindLocation(usn string, services []minissdpc.Service) (string, error) {
+	seen := make(map[string]bool)
+	var locations []string
+	for _, s := range services {
+		if s.USN == usn {
+			return s.Location, nil
+		}
+		if strings.HasPrefix(s.USN, usn) && !seen[s.Location] {
+			seen[s.Location] = true
+			locations = append(locations, s.Location)
+		}
+	}
+	switch len(locations) {
+	case 0:
+		return "", fmt.Errorf("%v: %s", errNoLocation, usn)
+	case 1:
+		return locations[0], nil
+	}
+	sort.Strings(locations)
+	return "", fmt.Errorf("USN %s matches services at %d locations: %s", usn, len(locations), strings.Join(locations, ", "))
+}
+
+// FindService returns the service of the given type of d or its
+// embedded devices, preferring one of the device with the given UDN
+// when several devices have a service of that type. It returns nil
+// if there is no such service.
+func (d *Device) FindService(serviceType, udn string) *Service {
+	var found *Service
+	for i := range d.Services {
+		if d.Services[i].ServiceType != serviceType {
+			continue
+		}
+		if d.UDN == udn {
+			return &d.Services[i]
+		}
+		if found == nil {
+			found = &d.Services[i]
+		}
+	}
+	for i := range d.Devices {
+		s := d.Devices[i].FindService(serviceType, udn)
+		if s == nil {
+			continue
+		}
+		if d.Devices[i].UDN == udn || found == nil {
+			found = s
+		}
+	}
+	return found
+}
+
+// Fetch retrieves and parses the device description at location,
+// using c or DefaultClient if c is nil. The SCPDs of the services
+// are not fetched; see FetchSCPDs.
+func Fetch(c *http.Client, location string) (*Root, error) {
+	b, err := get(c, location)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// FetchSCPDs retrieves the SCPD of every service of the root and
+// embedded devices, setting Service.SCPD. It carries on past a service
+// whose SCPD cannot be fetched, returning the first such error.
+func (r *Root) FetchSCPDs(c *http.Client, location string) error {
+	return r.Device.fetchSCPDs(c, r, location)
+}
+
+// FetchSCPD retrieves the SCPD of s, a service of the root or of an
+// embedded device, and sets s.SCPD
+func (r *Root) FetchSCPD(c *http.Client, location string, s *Service) error {
+	if err := s.fetchSCPD(c, r, location); err != nil {
+		return fmt.Errorf("could not fetch SCPD of %s: %v", s.ServiceID, err)
+	}
+	return nil
+}
+
+func (d *Device) fetchSCPDs(c *http.Client, r *Root, location string) error {
+	var first error
+	for i := range d.Services {
+		err := r.FetchSCPD(c, location, &d.Services[i])
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	for i := range d.Devices {
+		err := d.Devices[i].fetchSCPDs(c, r, location)
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (s *Service) fetchSCPD(c *http.Client, r *Root, location string) error {
+	u, err := r.URL(location, s.SCPDURL)
+	if err != nil {
+		return err
+	}
+	b, err := get(c, u)
+	if err != nil {
+		return err
+	}
+	s.SCPD, err = ParseSCPD(b)
+	return err
+}
+
+// URL resolves ref, such as a SCPDURL or controlURL, against the
+// URLBase of the document or, if it has none, the location that the
+// document was fetched from
+func (r *Root) URL(location, ref string) (string, error) {
+	base := r.URLBase
+	if base == "" {
+		base = location
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid base URL %q: %v", base, err)
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %q: %v", ref, err)
+	}
+	return b.ResolveReference(u).String(), nil
+}
+
+func get(c *http.Client, u string) ([]byte, error) {
+	if c == nil {
+		c = DefaultClient
+	}
+	resp, err := c.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDocumentSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("GET %s: %v", u, err)
+	}
+	if len(b) > maxDocumentSize {
+		return nil, fmt.Errorf("GET %s: %v", u, errTooLarge)
+	}
+	return b, nil
+}
@@ -0,0 +1,214 @@
+package description
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/forfuncsake/minissdpc"
+)
+
+func TestFetch(t *testing.T) {
+	svc, err := basicEvent().Service()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := testRoot()
+	root.Device.Services = []Service{svc}
+
+	mux, err := root.ServeMux()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	location := srv.URL + "/setup.xml"
+	fetched, err := Fetch(nil, location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetched.Device.FriendlyName != "Lamp" {
+		t.Fatalf("fetched device is named %q", fetched.Device.FriendlyName)
+	}
+	if fetched.Device.Services[0].SCPD != nil {
+		t.Fatal("Fetch should not fetch SCPDs")
+	}
+
+	// The embedded device refers to an SCPD that is not served
+	fetched.Device.Devices[0].Services = []Service{{ServiceID: "urn:Belkin:serviceId:missing1", SCPDURL: "/missing.xml"}}
+	err = fetched.FetchSCPDs(nil, location)
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected 404 error for missing SCPD, got %v", err)
+	}
+	scpd := fetched.Device.Services[0].SCPD
+	if scpd == nil {
+		t.Fatal("SCPD of root service was not fetched")
+	}
+	if a := scpd.Action("SetBinaryState"); a == nil || len(a.Arguments) != 2 {
+		t.Fatalf("unexpected SetBinaryState action: %#v", a)
+	}
+
+	if _, err := Fetch(nil, srv.URL+"/nothing.xml"); err == nil {
+		t.Fatal("expected error fetching missing document")
+	}
+}
+
+func TestFetchSCPD(t *testing.T) {
+	svc, err := basicEvent().Service()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := testRoot()
+	root.Device.Services = []Service{svc}
+	mux, err := root.ServeMux()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	location := srv.URL + "/setup.xml"
+	fetched, err := Fetch(nil, location)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the given service is fetched, whatever the others refer to
+	fetched.Device.Devices[0].Services = []Service{{ServiceID: "urn:Belkin:serviceId:missing1", SCPDURL: "/missing.xml"}}
+	s := &fetched.Device.Services[0]
+	if err := fetched.FetchSCPD(nil, location, s); err != nil {
+		t.Fatal(err)
+	}
+	if s.SCPD == nil || s.SCPD.Action("SetBinaryState") == nil {
+		t.Fatalf("unexpected SCPD %#v", s.SCPD)
+	}
+
+	missing := &fetched.Device.Devices[0].Services[0]
+	err = fetched.FetchSCPD(nil, location, missing)
+	if err == nil || !strings.Contains(err.Error(), "missing1") || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected a 404 error naming the service, got %v", err)
+	}
+}
+
+func TestFetchTooLarge(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(make([]byte, maxDocumentSize+1))
+	}))
+	defer srv.Close()
+
+	_, err := Fetch(nil, srv.URL)
+	if err == nil || !strings.Contains(err.Error(), errTooLarge.Error()) {
+		t.Fatalf("expected errTooLarge, got %v", err)
+	}
+}
+
+func TestURL(t *testing.T) {
+	const location = "http://192.168.1.10:49153/setup.xml"
+
+	for _, tc := range []struct {
+		base, ref, expect string
+	}{
+		{"", "/upnp/control/basicevent1", "http://192.168.1.10:49153/upnp/control/basicevent1"},
+		{"", "eventservice.xml", "http://192.168.1.10:49153/eventservice.xml"},
+		{"", "http://192.168.1.11/x.xml", "http://192.168.1.11/x.xml"},
+		{"http://192.168.1.12:80/upnp/", "control", "http://192.168.1.12:80/upnp/control"},
+	} {
+		r := &Root{URLBase: tc.base}
+		u, err := r.URL(location, tc.ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u != tc.expect {
+			t.Errorf("URL(%q) with base %q: expected %q, got %q", tc.ref, tc.base, tc.expect, u)
+		}
+	}
+
+	if _, err := (&Root{}).URL("%zz", "x"); err == nil {
+		t.Fatal("expected error for invalid location")
+	}
+}
+
+func TestFindLocation(t *testing.T) {
+	services := []minissdpc.Service{
+		{USN: "uuid:Socket-1", Location: "http://192.168.1.10/setup.xml"},
+		{USN: "uuid:Socket-1::urn:Belkin:device:controllee:1", Location: "http://192.168.1.10/setup.xml"},
+		{USN: "uuid:Socket-10", Location: "http://192.168.1.11/setup.xml"},
+		{USN: "uuid:Other-1", Location: "http://192.168.1.12/desc.xml"},
+	}
+
+	tests := []struct {
+		usn    string
+		expect string
+		err    string
+	}{
+		{"uuid:Socket-1", "http://192.168.1.10/setup.xml", ""},
+		{"uuid:Socket-1::", "http://192.168.1.10/setup.xml", ""},
+		{"uuid:Socket-10", "http://192.168.1.11/setup.xml", ""},
+		{"uuid:Other", "http://192.168.1.12/desc.xml", ""},
+		{"uuid:Socket", "", "matches services at 2 locations: http://192.168.1.10/setup.xml, http://192.168.1.11/setup.xml"},
+		{"uuid:Missing", "", errNoLocation.Error()},
+	}
+	for _, test := range tests {
+		location, err := FindLocation(test.usn, services)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected error %q, got %q, %v", test.usn, test.err, location, err)
+			}
+			continue
+		}
+		if err != nil || location != test.expect {
+			t.Errorf("%s: expected %s, got %q, %v", test.usn, test.expect, location, err)
+		}
+	}
+}
+
+func TestFindService(t *testing.T) {
+	const switchPower = "urn:schemas-upnp-org:service:SwitchPower:1"
+	root := New(Device{
+		UDN: "uuid:root",
+		Services: []Service{
+			{ServiceType: switchPower, ServiceID: "root"},
+		},
+		Devices: []Device{
+			{
+				UDN: "uuid:light-1",
+				Services: []Service{
+					{ServiceType: switchPower, ServiceID: "light-1"},
+					{ServiceType: "urn:schemas-upnp-org:service:Dimming:1", ServiceID: "dimming"},
+				},
+			},
+			{
+				UDN: "uuid:light-2",
+				Services: []Service{
+					{ServiceType: switchPower, ServiceID: "light-2"},
+				},
+			},
+		},
+	})
+
+	tests := []struct {
+		serviceType string
+		udn         string
+		expect      string
+	}{
+		{switchPower, "uuid:root", "root"},
+		{switchPower, "uuid:light-1", "light-1"},
+		{switchPower, "uuid:light-2", "light-2"},
+		{switchPower, "uuid:other", "root"},
+		{switchPower, "", "root"},
+		{"urn:schemas-upnp-org:service:Dimming:1", "uuid:root", "dimming"},
+		{"urn:schemas-upnp-org:service:Missing:1", "uuid:root", ""},
+	}
+	for _, test := range tests {
+		s := root.Device.FindService(test.serviceType, test.udn)
+		var id string
+		if s != nil {
+			id = s.ServiceID
+		}
+		if id != test.expect {
+			t.Errorf("%s of %q: expected service %q, got %q", test.serviceType, test.udn, test.expect, id)
+		}
+	}
+}
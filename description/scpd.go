@@ -0,0 +1,341 @@
+package description
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ServiceNamespace is the XML namespace of a service description (SCPD)
+const ServiceNamespace = "urn:schemas-upnp-org:service-1-0"
+
+// Argument directions
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+// Values for the sendEvents attribute of a state variable
+const (
+	SendEventsYes = "yes"
+	SendEventsNo  = "no"
+)
+
+// dataTypes lists the state variable types defined by the
+// UPnP Device Architecture
+var dataTypes = map[string]bool{
+	"ui1": true, "ui2": true, "ui4": true, "ui8": true,
+	"i1": true, "i2": true, "i4": true, "i8": true, "int": true,
+	"r4": true, "r8": true, "number": true, "fixed.14.4": true, "float": true,
+	"char": true, "string": true,
+	"date": true, "dateTime": true, "dateTime.tz": true, "time": true, "time.tz": true,
+	"boolean": true, "bin.base64": true, "bin.hex": true, "uri": true, "uuid": true,
+}
+
+var (
+	errNoName             = errors.New("name must not be empty")
+	errDuplicateName      = errors.New("name is declared more than once")
+	errUnknownDataType    = errors.New("unknown dataType")
+	errUnknownVariable    = errors.New("argument refers to an undeclared state variable")
+	errInvalidDirection   = errors.New("argument direction must be in or out")
+	errArgumentOrder      = errors.New("out arguments must follow all in arguments")
+	errInvalidSendEvents  = errors.New("sendEvents must be yes or no")
+	errMissingServiceType = errors.New("service definition has no ServiceType")
+)
+
+// SCPD is the root element of a service description document,
+// listing the actions and state variables of a service
+type SCPD struct {
+	XMLName        xml.Name        `xml:"urn:schemas-upnp-org:service-1-0 scpd"`
+	SpecVersion    SpecVersion     `xml:"specVersion"`
+	Actions        []Action        `xml:"actionList>action"`
+	StateVariables []StateVariable `xml:"serviceStateTable>stateVariable"`
+}
+
+// Action is an action that can be invoked on a service
+type Action struct {
+	Name      string     `xml:"name"`
+	Arguments []Argument `xml:"argumentList>argument"`
+}
+
+// Argument is an in or out argument of an action
+type Argument struct {
+	Name                 string `xml:"name"`
+	Direction            string `xml:"direction"`
+	RelatedStateVariable string `xml:"relatedStateVariable"`
+}
+
+// StateVariable describes a variable of the service's state,
+// and the type of any arguments that relate to it
+type StateVariable struct {
+	SendEvents    string        `xml:"sendEvents,attr,omitempty"`
+	Name          string        `xml:"name"`
+	DataType      string        `xml:"dataType"`
+	DefaultValue  string        `xml:"defaultValue,omitempty"`
+	AllowedValues []string      `xml:"allowedValueList>allowedValue"`
+	AllowedRange  *AllowedRange `xml:"allowedValueRange,omitempty"`
+}
+
+// AllowedRange restricts the values of a numeric state variable
+type AllowedRange struct {
+	Minimum string `xml:"minimum"`
+	Maximum string `xml:"maximum"`
+	Step    string `xml:"step,omitempty"`
+}
+
+// ParseSCPD decodes a service description document
+func ParseSCPD(b []byte) (*SCPD, error) {
+	s := &SCPD{}
+	err := xml.Unmarshal(b, s)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse service description: %v", err)
+	}
+	return s, nil
+}
+
+// Marshal renders the document as XML, including the XML declaration
+func (s *SCPD) Marshal() ([]byte, error) {
+	b, err := xml.MarshalIndent(scpdXML(s), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("could not render service description: %v", err)
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+// ServeHTTP serves the rendered document
+func (s *SCPD) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	serveXML(w, req, s.Marshal)
+}
+
+// Validate checks that the document is self consistent: names are
+// present and unique, data types are known and every argument
+// refers to a declared state variable.
+func (s *SCPD) Validate() error {
+	vars := make(map[string]bool, len(s.StateVariables))
+	for _, v := range s.StateVariables {
+		if v.Name == "" {
+			return fmt.Errorf("state variable: %v", errNoName)
+		}
+		if vars[v.Name] {
+			return fmt.Errorf("state variable %q: %v", v.Name, errDuplicateName)
+		}
+		vars[v.Name] = true
+		if !dataTypes[v.DataType] {
+			return fmt.Errorf("state variable %q: %v %q", v.Name, errUnknownDataType, v.DataType)
+		}
+		if v.SendEvents != "" && v.SendEvents != SendEventsYes && v.SendEvents != SendEventsNo {
+			return fmt.Errorf("state variable %q: %v", v.Name, errInvalidSendEvents)
+		}
+	}
+
+	actions := make(map[string]bool, len(s.Actions))
+	for _, a := range s.Actions {
+		if a.Name == "" {
+			return fmt.Errorf("action: %v", errNoName)
+		}
+		if actions[a.Name] {
+			return fmt.Errorf("action %q: %v", a.Name, errDuplicateName)
+		}
+		actions[a.Name] = true
+
+		args := make(map[string]bool, len(a.Arguments))
+		out := false
+		for _, arg := range a.Arguments {
+			if arg.Name == "" {
+				return fmt.Errorf("action %q argument: %v", a.Name, errNoName)
+			}
+			// Vendors such as Belkin re-use a name for an in and
+			// an out argument, so names need only be unique per direction
+			if args[arg.Direction+" "+arg.Name] {
+				return fmt.Errorf("action %q argument %q: %v", a.Name, arg.Name, errDuplicateName)
+			}
+			args[arg.Direction+" "+arg.Name] = true
+
+			switch arg.Direction {
+			case DirectionIn:
+				if out {
+					return fmt.Errorf("action %q argument %q: %v", a.Name, arg.Name, errArgumentOrder)
+				}
+			case DirectionOut:
+				out = true
+			default:
+				return fmt.Errorf("action %q argument %q: %v", a.Name, arg.Name, errInvalidDirection)
+			}
+
+			if !vars[arg.RelatedStateVariable] {
+				return fmt.Errorf("action %q argument %q: %v %q",
+					a.Name, arg.Name, errUnknownVariable, arg.RelatedStateVariable)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Action returns the named action, or nil if the service has none
+func (s *SCPD) Action(name string) *Action {
+	for i := range s.Actions {
+		if s.Actions[i].Name == name {
+			return &s.Actions[i]
+		}
+	}
+	return nil
+}
+
+// StateVariable returns the named state variable, or nil
+// if the service has none
+func (s *SCPD) StateVariable(name string) *StateVariable {
+	for i := range s.StateVariables {
+		if s.StateVariables[i].Name == name {
+			return &s.StateVariables[i]
+		}
+	}
+	return nil
+}
+
+// scpdXML returns a copy of s for marshalling, in which lists that
+// may be empty are held by pointer so that they are omitted
+func scpdXML(s *SCPD) interface{} {
+	type argumentList struct {
+		Argument []Argument `xml:"argument"`
+	}
+	type action struct {
+		Name      string        `xml:"name"`
+		Arguments *argumentList `xml:"argumentList"`
+	}
+	type allowedValueList struct {
+		AllowedValue []string `xml:"allowedValue"`
+	}
+	type stateVariable struct {
+		SendEvents    string            `xml:"sendEvents,attr,omitempty"`
+		Name          string            `xml:"name"`
+		DataType      string            `xml:"dataType"`
+		DefaultValue  string            `xml:"defaultValue,omitempty"`
+		AllowedValues *allowedValueList `xml:"allowedValueList"`
+		AllowedRange  *AllowedRange     `xml:"allowedValueRange"`
+	}
+	type actionList struct {
+		Action []action `xml:"action"`
+	}
+	type doc struct {
+		XMLName        xml.Name        `xml:"urn:schemas-upnp-org:service-1-0 scpd"`
+		SpecVersion    SpecVersion     `xml:"specVersion"`
+		Actions        *actionList     `xml:"actionList"`
+		StateVariables []stateVariable `xml:"serviceStateTable>stateVariable"`
+	}
+
+	out := doc{SpecVersion: s.SpecVersion}
+	if len(s.Actions) > 0 {
+		out.Actions = &actionList{}
+		for _, a := range s.Actions {
+			x := action{Name: a.Name}
+			if len(a.Arguments) > 0 {
+				x.Arguments = &argumentList{a.Arguments}
+			}
+			out.Actions.Action = append(out.Actions.Action, x)
+		}
+	}
+	for _, v := range s.StateVariables {
+		x := stateVariable{
+			SendEvents:   v.SendEvents,
+			Name:         v.Name,
+			DataType:     v.DataType,
+			DefaultValue: v.DefaultValue,
+			AllowedRange: v.AllowedRange,
+		}
+		if len(v.AllowedValues) > 0 {
+			x.AllowedValues = &allowedValueList{v.AllowedValues}
+		}
+		out.StateVariables = append(out.StateVariables, x)
+	}
+	return out
+}
+
+// A ServiceDefinition declares a service in Go, from which its SCPD
+// and its entry in the device description are generated
+type ServiceDefinition struct {
+	ServiceType string
+	ServiceID   string
+
+	// Paths at which the service is served by the device
+	SCPDURL     string
+	ControlURL  string
+	EventSubURL string
+
+	Actions   []ActionDefinition
+	Variables []StateVariable
+}
+
+// ActionDefinition declares an action and its arguments
+type ActionDefinition struct {
+	Name string
+	In   []Arg
+	Out  []Arg
+}
+
+// Arg declares an argument of an action. Variable names the related
+// state variable, and defaults to the argument's Name.
+type Arg struct {
+	Name     string
+	Variable string
+}
+
+// SCPD generates and validates the service description document
+func (d *ServiceDefinition) SCPD() (*SCPD, error) {
+	s := &SCPD{
+		SpecVersion:    SpecVersion{Major: 1, Minor: 0},
+		StateVariables: d.Variables,
+	}
+
+	for _, a := range d.Actions {
+		action := Action{Name: a.Name}
+		for _, dir := range []struct {
+			direction string
+			args      []Arg
+		}{
+			{DirectionIn, a.In},
+			{DirectionOut, a.Out},
+		} {
+			for _, arg := range dir.args {
+				v := arg.Variable
+				if v == "" {
+					v = arg.Name
+				}
+				action.Arguments = append(action.Arguments, Argument{
+					Name:                 arg.Name,
+					Direction:            dir.direction,
+					RelatedStateVariable: v,
+				})
+			}
+		}
+		s.Actions = append(s.Actions, action)
+	}
+
+	if err := s.Validate(); err != nil {
+		return nil, fmt.Errorf("service %q: %v", d.ServiceType, err)
+	}
+	return s, nil
+}
+
+// Service generates the service's entry in the device description,
+// with its SCPD attached to be served at SCPDURL
+func (d *ServiceDefinition) Service() (Service, error) {
+	if d.ServiceType == "" {
+		return Service{}, errMissingServiceType
+	}
+
+	scpd, err := d.SCPD()
+	if err != nil {
+		return Service{}, err
+	}
+
+	return Service{
+		ServiceType: d.ServiceType,
+		ServiceID:   d.ServiceID,
+		SCPDURL:     d.SCPDURL,
+		ControlURL:  d.ControlURL,
+		EventSubURL: d.EventSubURL,
+		SCPD:        scpd,
+	}, nil
+}
@@ -0,0 +1,197 @@
+package description
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func basicEvent() *ServiceDefinition {
+	return &ServiceDefinition{
+		ServiceType: "urn:Belkin:service:basicevent:1",
+		ServiceID:   "urn:Belkin:serviceId:basicevent1",
+		SCPDURL:     "/eventservice.xml",
+		ControlURL:  "/upnp/control/basicevent1",
+		EventSubURL: "/upnp/event/basicevent1",
+		Actions: []ActionDefinition{
+			{Name: "GetBinaryState", Out: []Arg{{Name: "BinaryState"}}},
+			{
+				Name: "SetBinaryState",
+				In:   []Arg{{Name: "BinaryState"}},
+				Out:  []Arg{{Name: "CountdownEndTime", Variable: "A_ARG_TYPE_Time"}},
+			},
+			{Name: "Ping"},
+		},
+		Variables: []StateVariable{
+			{SendEvents: SendEventsYes, Name: "BinaryState", DataType: "boolean", DefaultValue: "0"},
+			{SendEvents: SendEventsNo, Name: "A_ARG_TYPE_Time", DataType: "ui4"},
+			{Name: "Level", DataType: "ui1", AllowedRange: &AllowedRange{Minimum: "0", Maximum: "100"}},
+			{Name: "Mode", DataType: "string", AllowedValues: []string{"Off", "On"}},
+		},
+	}
+}
+
+func TestServiceDefinition(t *testing.T) {
+	svc, err := basicEvent().Service()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if svc.ServiceType != "urn:Belkin:service:basicevent:1" || svc.SCPDURL != "/eventservice.xml" {
+		t.Fatalf("unexpected service entry: %#v", svc)
+	}
+
+	b, err := svc.SCPD.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := string(b)
+	for _, expect := range []string{
+		`<scpd xmlns="urn:schemas-upnp-org:service-1-0">`,
+		"<action>\n      <name>GetBinaryState</name>\n      <argumentList>\n        <argument>\n" +
+			"          <name>BinaryState</name>\n          <direction>out</direction>\n" +
+			"          <relatedStateVariable>BinaryState</relatedStateVariable>",
+		"<name>CountdownEndTime</name>\n          <direction>out</direction>\n" +
+			"          <relatedStateVariable>A_ARG_TYPE_Time</relatedStateVariable>",
+		"<action>\n      <name>Ping</name>\n    </action>",
+		`<stateVariable sendEvents="yes">`,
+		"<allowedValueRange>\n        <minimum>0</minimum>\n        <maximum>100</maximum>\n      </allowedValueRange>",
+		"<allowedValueList>\n        <allowedValue>Off</allowedValue>",
+	} {
+		if !strings.Contains(doc, expect) {
+			t.Errorf("expected document to contain %q", expect)
+		}
+	}
+	if strings.Count(doc, "allowedValueList") != 2 {
+		t.Error("empty allowedValueList should be omitted")
+	}
+
+	parsed, err := ParseSCPD(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed.XMLName = xml.Name{}
+	if !reflect.DeepEqual(parsed, svc.SCPD) {
+		t.Logf("expected: %#v\n", svc.SCPD)
+		t.Logf("     got: %#v\n", parsed)
+		t.Fatal("mismatched document after round trip")
+	}
+	if err := parsed.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Action("SetBinaryState") == nil || parsed.StateVariable("BinaryState") == nil {
+		t.Fatal("could not find declared action and variable")
+	}
+	if parsed.Action("Missing") != nil || parsed.StateVariable("Missing") != nil {
+		t.Fatal("found undeclared action or variable")
+	}
+}
+
+func TestServiceDefinitionInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(d *ServiceDefinition)
+		err    error
+	}{
+		{"no type", func(d *ServiceDefinition) { d.ServiceType = "" }, errMissingServiceType},
+		{"unknown variable", func(d *ServiceDefinition) {
+			d.Actions[0].Out[0].Variable = "State"
+		}, errUnknownVariable},
+		{"unknown data type", func(d *ServiceDefinition) { d.Variables[0].DataType = "bool" }, errUnknownDataType},
+		{"duplicate action", func(d *ServiceDefinition) { d.Actions[1].Name = "GetBinaryState" }, errDuplicateName},
+		{"duplicate variable", func(d *ServiceDefinition) { d.Variables[1].Name = "BinaryState" }, errDuplicateName},
+		{"duplicate argument", func(d *ServiceDefinition) {
+			d.Actions[1].In = append(d.Actions[1].In, Arg{Name: "BinaryState"})
+		}, errDuplicateName},
+		{"send events", func(d *ServiceDefinition) { d.Variables[0].SendEvents = "true" }, errInvalidSendEvents},
+		{"unnamed action", func(d *ServiceDefinition) { d.Actions[2].Name = "" }, errNoName},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := basicEvent()
+			test.modify(d)
+			_, err := d.Service()
+			if err == nil || !strings.Contains(err.Error(), test.err.Error()) {
+				t.Fatalf("expected error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+
+	// Hand written documents are checked for argument order too
+	s := &SCPD{
+		Actions: []Action{{Name: "Set", Arguments: []Argument{
+			{Name: "Out", Direction: DirectionOut, RelatedStateVariable: "V"},
+			{Name: "In", Direction: DirectionIn, RelatedStateVariable: "V"},
+		}}},
+		StateVariables: []StateVariable{{Name: "V", DataType: "string"}},
+	}
+	if err := s.Validate(); err == nil || !strings.Contains(err.Error(), errArgumentOrder.Error()) {
+		t.Fatalf("expected argument order error, got %v", err)
+	}
+	s.Actions[0].Arguments[1].Direction = "inout"
+	if err := s.Validate(); err == nil || !strings.Contains(err.Error(), errInvalidDirection.Error()) {
+		t.Fatalf("expected direction error, got %v", err)
+	}
+}
+
+func TestServeMux(t *testing.T) {
+	svc, err := basicEvent().Service()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := testRoot()
+	root.Device.Services = []Service{svc}
+
+	mux, err := root.ServeMux()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for path, parse := range map[string]func([]byte) error{
+		"/setup.xml": func(b []byte) error {
+			_, err := Parse(b)
+			return err
+		},
+		"/eventservice.xml": func(b []byte) error {
+			_, err := ParseSCPD(b)
+			return err
+		},
+	} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: unexpected status: %s", path, resp.Status)
+		}
+		if err := parse(b); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+	}
+
+	// Every SCPD must have its own path
+	root.Device.Devices[0].Services = []Service{svc}
+	if _, err := root.ServeMux(); err == nil {
+		t.Fatal("expected error for duplicate SCPDURL")
+	}
+
+	svc.SCPDURL = "eventservice.xml"
+	root.Device.Services = []Service{svc}
+	root.Device.Devices[0].Services = nil
+	if _, err := root.ServeMux(); err == nil {
+		t.Fatal("expected error for relative SCPDURL")
+	}
+}
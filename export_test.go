@@ -0,0 +1,7 @@
+package minissdpc
+
+// Errors checked by the tests of package minissdpc_test
+var (
+	ErrNotSupported  = errNotSupported
+	ErrNotSubscribed = errNotSubscribed
+)
@@ -0,0 +1,501 @@
+// Package gena implements the server side of UPnP eventing (GENA),
+// accepting SUBSCRIBE, renewal and UNSUBSCRIBE requests on a service's
+// eventSubURL and sending NOTIFY callbacks when its state changes.
+package gena
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/forfuncsake/minissdpc/internal/xmlname"
+)
+
+// EventNamespace is the XML namespace of a property set
+const EventNamespace = "urn:schemas-upnp-org:event-1-0"
+
+// DefaultTimeout is the subscription duration granted when
+// the subscriber does not request one
+const DefaultTimeout = 1800 * time.Second
+
+var (
+	errNoCallback  = errors.New("no valid http callback URL")
+	errTimeout     = errors.New("invalid TIMEOUT header")
+	errInvalidName = errors.New("not a valid XML element name")
+)
+
+// A Property is the value of an evented state variable
+type Property struct {
+	Name  string
+	Value string
+}
+
+// Server handles subscriptions to the evented state variables
+// of a single service. It must be created with NewServer.
+type Server struct {
+	// Client is used to send NOTIFY requests
+	Client *http.Client
+
+	// MaxTimeout limits the duration of subscriptions
+	MaxTimeout time.Duration
+
+	// ErrorFunc, if set, is called when a NOTIFY cannot be
+	// delivered. It is not called with the Server locked, so it
+	// may use the Server.
+	ErrorFunc func(sid string, err error)
+
+	mu    sync.Mutex
+	state []Property
+	subs  map[string]*subscription
+	now   func() time.Time
+}
+
+type subscription struct {
+	sid       string
+	callbacks []string
+	expires   time.Time
+	seq       uint32
+
+	// pending holds the latest value of each variable changed
+	// since the last NOTIFY was sent. It is guarded by the
+	// Server's mu, and wake is signalled when it is set.
+	pending []Property
+	wake    chan struct{}
+
+	// ready is closed once the SUBSCRIBE response has been sent,
+	// and done once the subscription is cancelled
+	ready chan struct{}
+	done  chan struct{}
+}
+
+// NewServer returns a Server for a service whose evented state
+// variables have the given initial values. Their names must be valid
+// XML names, or the NOTIFY requests will fail.
+func NewServer(initial ...Property) *Server {
+	return &Server{
+		Client:     &http.Client{Timeout: 5 * time.Second},
+		MaxTimeout: 24 * time.Hour,
+		state:      append([]Property(nil), initial...),
+		subs:       make(map[string]*subscription),
+		now:        time.Now,
+	}
+}
+
+// State returns the current values of the evented state variables
+func (s *Server) State() []Property {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Property(nil), s.state...)
+}
+
+// Set updates the value of one or more state variables and sends
+// a NOTIFY with the changed values to every current subscriber. A
+// subscriber that is still being sent an earlier NOTIFY is sent the
+// latest value of each variable changed since then, once it is done.
+// An error is returned, and nothing is changed, if a name is not a
+// valid XML name.
+func (s *Server) Set(props ...Property) error {
+	for _, p := range props {
+		if !xmlname.Valid(p.Name) {
+			return fmt.Errorf("property %q: %v", p.Name, errInvalidName)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = merge(s.state, props)
+	s.expire()
+	for _, sub := range s.subs {
+		s.queue(sub, props)
+	}
+	return nil
+}
+
+// merge sets the values of props in set, appending the variables
+// that it does not have yet
+func merge(set, props []Property) []Property {
+	for _, p := range props {
+		found := false
+		for i := range set {
+			if set[i].Name == p.Name {
+				set[i].Value = p.Value
+				found = true
+				break
+			}
+		}
+		if !found {
+			set = append(set, p)
+		}
+	}
+	return set
+}
+
+// Subscribers returns the number of current subscriptions
+func (s *Server) Subscribers() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+	return len(s.subs)
+}
+
+// Close cancels all subscriptions
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sid := range s.subs {
+		s.remove(sid)
+	}
+}
+
+// ServeHTTP implements http.Handler for the eventSubURL
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "SUBSCRIBE":
+		s.subscribe(w, req)
+	case "UNSUBSCRIBE":
+		s.unsubscribe(w, req)
+	default:
+		w.Header().Set("Allow", "SUBSCRIBE, UNSUBSCRIBE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) subscribe(w http.ResponseWriter, req *http.Request) {
+	sid := req.Header.Get("SID")
+	callback := req.Header.Get("CALLBACK")
+	nt := req.Header.Get("NT")
+
+	if sid != "" && (callback != "" || nt != "") {
+		http.Error(w, "SID must not be sent with CALLBACK or NT", http.StatusBadRequest)
+		return
+	}
+
+	timeout, err := s.timeout(req.Header.Get("TIMEOUT"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.expire()
+
+	var sub *subscription
+	if sid != "" {
+		// Renewal of an existing subscription
+		sub = s.subs[sid]
+		if sub == nil {
+			s.mu.Unlock()
+			http.Error(w, "unknown SID", http.StatusPreconditionFailed)
+			return
+		}
+		sub.expires = s.now().Add(timeout)
+		s.mu.Unlock()
+		writeSubscribed(w, sub.sid, timeout)
+		return
+	}
+
+	if nt != "upnp:event" {
+		s.mu.Unlock()
+		http.Error(w, "NT must be upnp:event", http.StatusPreconditionFailed)
+		return
+	}
+	callbacks, err := parseCallback(callback)
+	if err != nil {
+		s.mu.Unlock()
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+
+	sub = &subscription{
+		sid:       "uuid:" + newUUID(),
+		callbacks: callbacks,
+		expires:   s.now().Add(timeout),
+		wake:      make(chan struct{}, 1),
+		ready:     make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	s.subs[sub.sid] = sub
+	s.queue(sub, s.state)
+	go s.deliver(sub)
+	s.mu.Unlock()
+
+	// The initial event must not arrive before the subscriber
+	// has received its SID, so flush the response first
+	writeSubscribed(w, sub.sid, timeout)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	close(sub.ready)
+}
+
+func (s *Server) unsubscribe(w http.ResponseWriter, req *http.Request) {
+	sid := req.Header.Get("SID")
+	if sid == "" {
+		http.Error(w, "missing SID", http.StatusPreconditionFailed)
+		return
+	}
+	if req.Header.Get("CALLBACK") != "" || req.Header.Get("NT") != "" {
+		http.Error(w, "SID must not be sent with CALLBACK or NT", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subs[sid] == nil {
+		http.Error(w, "unknown SID", http.StatusPreconditionFailed)
+		return
+	}
+	s.remove(sid)
+	w.WriteHeader(http.StatusOK)
+}
+
+// timeout parses a TIMEOUT header of the form Second-N or Second-infinite
+func (s *Server) timeout(header string) (time.Duration, error) {
+	max := s.MaxTimeout
+	if max <= 0 {
+		max = DefaultTimeout
+	}
+	if header == "" {
+		if DefaultTimeout < max {
+			return DefaultTimeout, nil
+		}
+		return max, nil
+	}
+
+	if !strings.HasPrefix(header, "Second-") {
+		return 0, errTimeout
+	}
+	v := strings.TrimPrefix(header, "Second-")
+	if v == "infinite" {
+		return max, nil
+	}
+	n, err := strconv.ParseUint(v, 10, 32)
+	if err != nil || n == 0 {
+		return 0, errTimeout
+	}
+	d := time.Duration(n) * time.Second
+	if d > max {
+		d = max
+	}
+	return d, nil
+}
+
+// expire removes subscriptions that were not renewed in time.
+// s.mu must be held.
+func (s *Server) expire() {
+	now := s.now()
+	for sid, sub := range s.subs {
+		if now.After(sub.expires) {
+			s.remove(sid)
+		}
+	}
+}
+
+// remove cancels a subscription, so that nothing more is sent to
+// it. s.mu must be held.
+func (s *Server) remove(sid string) {
+	close(s.subs[sid].done)
+	delete(s.subs, sid)
+}
+
+// queue adds changed variables to those pending for the subscriber,
+// replacing the values not sent yet, and wakes its delivery
+// goroutine. s.mu must be held.
+func (s *Server) queue(sub *subscription, props []Property) {
+	sub.pending = merge(sub.pending, props)
+	select {
+	case sub.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver sends the pending variables to the subscriber, one NOTIFY
+// at a time so that SEQ numbers arrive in sequence, until the
+// subscription is cancelled
+func (s *Server) deliver(sub *subscription) {
+	<-sub.ready
+	for {
+		select {
+		case <-sub.wake:
+		case <-sub.done:
+			return
+		}
+
+		s.mu.Lock()
+		props := sub.pending
+		sub.pending = nil
+		s.mu.Unlock()
+		if cancelled(sub) {
+			return
+		}
+		if len(props) == 0 {
+			// Woken again for changes that were sent already
+			continue
+		}
+
+		err := s.notify(sub, props)
+		if err != nil {
+			s.error(sub.sid, err)
+		}
+
+		// SEQ counts events sent, wrapping to 1 rather than 0,
+		// which only identifies the initial event
+		sub.seq++
+		if sub.seq == 0 {
+			sub.seq = 1
+		}
+	}
+}
+
+// cancelled reports whether the subscription has been cancelled
+func cancelled(sub *subscription) bool {
+	select {
+	case <-sub.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Server) notify(sub *subscription, props []Property) error {
+	body, err := EncodePropertySet(props)
+	if err != nil {
+		return err
+	}
+
+	for _, cb := range sub.callbacks {
+		// No NOTIFY may be sent once the subscription is cancelled
+		if cancelled(sub) {
+			return nil
+		}
+		var req *http.Request
+		req, err = http.NewRequest("NOTIFY", cb, bytes.NewReader(body))
+		if err != nil {
+			continue
+		}
+		req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+		req.Header.Set("NT", "upnp:event")
+		req.Header.Set("NTS", "upnp:propchange")
+		req.Header.Set("SID", sub.sid)
+		req.Header.Set("SEQ", strconv.FormatUint(uint64(sub.seq), 10))
+
+		var resp *http.Response
+		resp, err = s.Client.Do(req)
+		if err != nil {
+			continue
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("callback %s returned %s", cb, resp.Status)
+			continue
+		}
+		return nil
+	}
+	return err
+}
+
+func (s *Server) error(sid string, err error) {
+	if s.ErrorFunc != nil {
+		s.ErrorFunc(sid, err)
+	}
+}
+
+func writeSubscribed(w http.ResponseWriter, sid string, timeout time.Duration) {
+	w.Header().Set("SID", sid)
+	w.Header().Set("TIMEOUT", fmt.Sprintf("Second-%d", int(timeout/time.Second)))
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusOK)
+}
+
+// parseCallback returns the http URLs from a CALLBACK header
+// of the form <url1><url2>...
+func parseCallback(header string) ([]string, error) {
+	var urls []string
+	for _, part := range strings.Split(header, "<") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.HasSuffix(part, ">") {
+			return nil, errNoCallback
+		}
+		u, err := url.Parse(strings.TrimSuffix(part, ">"))
+		if err != nil || u.Scheme != "http" || u.Host == "" {
+			continue
+		}
+		urls = append(urls, u.String())
+	}
+	if len(urls) == 0 {
+		return nil, errNoCallback
+	}
+	return urls, nil
+}
+
+// EncodePropertySet renders the body of a NOTIFY request. The names
+// of the properties become element names, so an error is returned
+// if one is not a valid XML name.
+func EncodePropertySet(props []Property) ([]byte, error) {
+	for _, p := range props {
+		if !xmlname.Valid(p.Name) {
+			return nil, fmt.Errorf("property %q: %v", p.Name, errInvalidName)
+		}
+	}
+
+	b := &bytes.Buffer{}
+	b.WriteString(xml.Header)
+	b.WriteString(`<e:propertyset xmlns:e="` + EventNamespace + `">`)
+	for _, p := range props {
+		b.WriteString("<e:property><" + p.Name + ">")
+		xml.EscapeText(b, []byte(p.Value))
+		b.WriteString("</" + p.Name + "></e:property>")
+	}
+	b.WriteString("</e:propertyset>\n")
+	return b.Bytes(), nil
+}
+
+// DecodePropertySet parses the body of a NOTIFY request
+func DecodePropertySet(r io.Reader) ([]Property, error) {
+	var set struct {
+		XMLName    xml.Name `xml:"urn:schemas-upnp-org:event-1-0 propertyset"`
+		Properties []struct {
+			Vars []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:"urn:schemas-upnp-org:event-1-0 property"`
+	}
+	err := xml.NewDecoder(r).Decode(&set)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode property set: %v", err)
+	}
+
+	var props []Property
+	for _, p := range set.Properties {
+		for _, v := range p.Vars {
+			props = append(props, Property{v.XMLName.Local, v.Value})
+		}
+	}
+	return props, nil
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("gena: could not read random bytes: " + err.Error())
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,339 @@
+package gena
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type notification struct {
+	sid, seq, nt, nts string
+	props             []Property
+}
+
+// newCallback returns a server that records the NOTIFY requests it receives
+func newCallback(t *testing.T) (*httptest.Server, chan notification) {
+	notifications := make(chan notification, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "NOTIFY" {
+			t.Errorf("unexpected callback method %s", req.Method)
+		}
+		props, err := DecodePropertySet(req.Body)
+		if err != nil {
+			t.Errorf("callback: %v", err)
+		}
+		notifications <- notification{
+			sid:   req.Header.Get("SID"),
+			seq:   req.Header.Get("SEQ"),
+			nt:    req.Header.Get("NT"),
+			nts:   req.Header.Get("NTS"),
+			props: props,
+		}
+	}))
+	return srv, notifications
+}
+
+func next(t *testing.T, notifications chan notification) notification {
+	select {
+	case n := <-notifications:
+		return n
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for NOTIFY")
+	}
+	return notification{}
+}
+
+func request(t *testing.T, method, url string, headers map[string]string) *http.Response {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestSubscribeNotify(t *testing.T) {
+	gena := NewServer(Property{"BinaryState", "0"})
+	defer gena.Close()
+	srv := httptest.NewServer(gena)
+	defer srv.Close()
+	callback, notifications := newCallback(t)
+	defer callback.Close()
+
+	resp := request(t, "SUBSCRIBE", srv.URL, map[string]string{
+		"CALLBACK": "<" + callback.URL + "/notify>",
+		"NT":       "upnp:event",
+		"TIMEOUT":  "Second-300",
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("subscribe failed: %s", resp.Status)
+	}
+	sid := resp.Header.Get("SID")
+	if !strings.HasPrefix(sid, "uuid:") {
+		t.Fatalf("unexpected SID %q", sid)
+	}
+	if resp.Header.Get("TIMEOUT") != "Second-300" {
+		t.Fatalf("unexpected TIMEOUT %q", resp.Header.Get("TIMEOUT"))
+	}
+
+	// The initial event carries all evented variables
+	n := next(t, notifications)
+	expect := notification{sid, "0", "upnp:event", "upnp:propchange", []Property{{"BinaryState", "0"}}}
+	if !reflect.DeepEqual(n, expect) {
+		t.Fatalf("expected initial event %#v, got %#v", expect, n)
+	}
+
+	gena.Set(Property{"BinaryState", "1"})
+	n = next(t, notifications)
+	if n.seq != "1" || !reflect.DeepEqual(n.props, []Property{{"BinaryState", "1"}}) {
+		t.Fatalf("unexpected first change event %#v", n)
+	}
+	gena.Set(Property{"BinaryState", "0"}, Property{"Brightness", "<50>"})
+	n = next(t, notifications)
+	if n.seq != "2" || !reflect.DeepEqual(n.props, []Property{{"BinaryState", "0"}, {"Brightness", "<50>"}}) {
+		t.Fatalf("unexpected second change event %#v", n)
+	}
+
+	state := gena.State()
+	if !reflect.DeepEqual(state, []Property{{"BinaryState", "0"}, {"Brightness", "<50>"}}) {
+		t.Fatalf("unexpected state %v", state)
+	}
+
+	// Renewal keeps the same SID
+	resp = request(t, "SUBSCRIBE", srv.URL, map[string]string{"SID": sid, "TIMEOUT": "Second-infinite"})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("SID") != sid {
+		t.Fatalf("renewal failed: %s %s", resp.Status, resp.Header.Get("SID"))
+	}
+	if resp.Header.Get("TIMEOUT") != "Second-86400" {
+		t.Fatalf("expected infinite timeout to be limited, got %s", resp.Header.Get("TIMEOUT"))
+	}
+
+	resp = request(t, "UNSUBSCRIBE", srv.URL, map[string]string{"SID": sid})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unsubscribe failed: %s", resp.Status)
+	}
+	if gena.Subscribers() != 0 {
+		t.Fatal("subscription remains after unsubscribe")
+	}
+
+	gena.Set(Property{"BinaryState", "1"})
+	select {
+	case n := <-notifications:
+		t.Fatalf("unexpected NOTIFY after unsubscribe: %#v", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	resp = request(t, "UNSUBSCRIBE", srv.URL, map[string]string{"SID": sid})
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("expected unknown SID to fail, got %s", resp.Status)
+	}
+}
+
+func TestSubscriptionExpiry(t *testing.T) {
+	gena := NewServer(Property{"BinaryState", "0"})
+	defer gena.Close()
+	now := time.Now()
+	gena.now = func() time.Time { return now }
+
+	srv := httptest.NewServer(gena)
+	defer srv.Close()
+	callback, notifications := newCallback(t)
+	defer callback.Close()
+
+	resp := request(t, "SUBSCRIBE", srv.URL, map[string]string{
+		"CALLBACK": "<" + callback.URL + ">",
+		"NT":       "upnp:event",
+	})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("TIMEOUT") != "Second-1800" {
+		t.Fatalf("subscribe failed: %s %s", resp.Status, resp.Header.Get("TIMEOUT"))
+	}
+	next(t, notifications)
+
+	now = now.Add(DefaultTimeout + time.Second)
+	if gena.Subscribers() != 0 {
+		t.Fatal("subscription did not expire")
+	}
+
+	resp = request(t, "SUBSCRIBE", srv.URL, map[string]string{"SID": resp.Header.Get("SID")})
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("expected renewal of expired subscription to fail, got %s", resp.Status)
+	}
+}
+
+// newHeldCallback returns a callback that holds the first NOTIFY until
+// release is closed, so that later events are pending meanwhile
+func newHeldCallback(t *testing.T) (*httptest.Server, chan notification, chan struct{}) {
+	release := make(chan struct{})
+	notifications := make(chan notification, 10)
+	var once sync.Once
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		once.Do(func() { <-release })
+		props, err := DecodePropertySet(req.Body)
+		if err != nil {
+			t.Errorf("callback: %v", err)
+		}
+		notifications <- notification{sid: req.Header.Get("SID"), seq: req.Header.Get("SEQ"), props: props}
+	}))
+	return srv, notifications, release
+}
+
+func TestCoalesce(t *testing.T) {
+	gena := NewServer(Property{"BinaryState", "0"})
+	defer gena.Close()
+	srv := httptest.NewServer(gena)
+	defer srv.Close()
+	callback, notifications, release := newHeldCallback(t)
+	defer callback.Close()
+
+	var mu sync.Mutex
+	var errs []error
+	gena.ErrorFunc = func(sid string, err error) {
+		// Using the Server must not deadlock
+		gena.Subscribers()
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	}
+
+	resp := request(t, "SUBSCRIBE", srv.URL, map[string]string{
+		"CALLBACK": "<" + callback.URL + ">",
+		"NT":       "upnp:event",
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("subscribe failed: %s", resp.Status)
+	}
+
+	// However many changes are made while the subscriber is busy,
+	// none is lost and only the latest values are sent
+	for i := 0; i < 100; i++ {
+		gena.Set(Property{"BinaryState", strconv.Itoa(i % 2)})
+		gena.Set(Property{"Brightness", strconv.Itoa(i)})
+	}
+	close(release)
+
+	n := next(t, notifications)
+	if n.seq != "0" {
+		t.Fatalf("expected the initial event first, got %#v", n)
+	}
+	n = next(t, notifications)
+	expect := []Property{{"BinaryState", "1"}, {"Brightness", "99"}}
+	if n.seq != "1" || !reflect.DeepEqual(n.props, expect) {
+		t.Fatalf("expected the latest values %v in event 1, got %#v", expect, n)
+	}
+	select {
+	case n := <-notifications:
+		t.Fatalf("unexpected NOTIFY %#v", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+}
+
+func TestUnsubscribePending(t *testing.T) {
+	gena := NewServer(Property{"BinaryState", "0"})
+	defer gena.Close()
+	srv := httptest.NewServer(gena)
+	defer srv.Close()
+	callback, notifications, release := newHeldCallback(t)
+	defer callback.Close()
+
+	resp := request(t, "SUBSCRIBE", srv.URL, map[string]string{
+		"CALLBACK": "<" + callback.URL + ">",
+		"NT":       "upnp:event",
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("subscribe failed: %s", resp.Status)
+	}
+	gena.Set(Property{"BinaryState", "1"})
+
+	// The change is pending when the subscription is cancelled,
+	// so it must never be sent
+	resp = request(t, "UNSUBSCRIBE", srv.URL, map[string]string{"SID": resp.Header.Get("SID")})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unsubscribe failed: %s", resp.Status)
+	}
+	close(release)
+
+	if n := next(t, notifications); n.seq != "0" {
+		t.Fatalf("expected the initial event, got %#v", n)
+	}
+	select {
+	case n := <-notifications:
+		t.Fatalf("unexpected NOTIFY after unsubscribe: %#v", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestInvalidName(t *testing.T) {
+	gena := NewServer(Property{"BinaryState", "0"})
+	defer gena.Close()
+
+	if err := gena.Set(Property{"BinaryState", "1"}, Property{"a><b", "1"}); err == nil || !strings.Contains(err.Error(), errInvalidName.Error()) {
+		t.Fatalf("expected an invalid name error, got %v", err)
+	}
+	if state := gena.State(); !reflect.DeepEqual(state, []Property{{"BinaryState", "0"}}) {
+		t.Fatalf("state changed by an invalid Set: %v", state)
+	}
+	if _, err := EncodePropertySet([]Property{{"e:property", "1"}}); err == nil {
+		t.Fatal("expected an error encoding a prefixed name")
+	}
+}
+
+func TestSubscribeInvalid(t *testing.T) {
+	gena := NewServer()
+	defer gena.Close()
+	srv := httptest.NewServer(gena)
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		status  int
+	}{
+		{"method", http.MethodGet, nil, http.StatusMethodNotAllowed},
+		{"no callback", "SUBSCRIBE", map[string]string{"NT": "upnp:event"}, http.StatusPreconditionFailed},
+		{"bad callback", "SUBSCRIBE", map[string]string{"NT": "upnp:event", "CALLBACK": "<ftp://x/>"}, http.StatusPreconditionFailed},
+		{"unterminated callback", "SUBSCRIBE", map[string]string{"NT": "upnp:event", "CALLBACK": "<http://x/"}, http.StatusPreconditionFailed},
+		{"bad nt", "SUBSCRIBE", map[string]string{"NT": "upnp:propchange", "CALLBACK": "<http://x/>"}, http.StatusPreconditionFailed},
+		{"sid and nt", "SUBSCRIBE", map[string]string{"NT": "upnp:event", "SID": "uuid:1"}, http.StatusBadRequest},
+		{"bad timeout", "SUBSCRIBE", map[string]string{"NT": "upnp:event", "CALLBACK": "<http://x/>", "TIMEOUT": "300"}, http.StatusBadRequest},
+		{"unknown sid", "SUBSCRIBE", map[string]string{"SID": "uuid:1"}, http.StatusPreconditionFailed},
+		{"unsubscribe no sid", "UNSUBSCRIBE", nil, http.StatusPreconditionFailed},
+		{"unsubscribe with nt", "UNSUBSCRIBE", map[string]string{"SID": "uuid:1", "NT": "upnp:event"}, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		resp := request(t, test.method, srv.URL, test.headers)
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: expected status %d, got %s", test.name, test.status, resp.Status)
+		}
+	}
+}
+
+func TestParseCallback(t *testing.T) {
+	urls, err := parseCallback("<http://192.168.1.2:8080/a> <ftp://x/> <http://192.168.1.3/b>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"http://192.168.1.2:8080/a", "http://192.168.1.3/b"}
+	if !reflect.DeepEqual(urls, expect) {
+		t.Fatalf("expected %v, got %v", expect, urls)
+	}
+}
@@ -0,0 +1,295 @@
+package hue
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Error types returned by the Hue API
+const (
+	typeUnauthorized     = 1
+	typeInvalidJSON      = 2
+	typeNotAvailable     = 3
+	typeMethod           = 4
+	typeMissingParams    = 5
+	typeParamUnavailable = 6
+	typeInvalidValue     = 7
+	typeDeviceOff        = 201
+	typeLinkButton       = 101
+	typeInternal         = 901
+)
+
+// apiError is an entry of an error response
+type apiError struct {
+	Type        int    `json:"type"`
+	Address     string `json:"address"`
+	Description string `json:"description"`
+}
+
+type lightJSON struct {
+	State            lightStateJSON `json:"state"`
+	Type             string         `json:"type"`
+	Name             string         `json:"name"`
+	ModelID          string         `json:"modelid"`
+	ManufacturerName string         `json:"manufacturername"`
+	ProductName      string         `json:"productname"`
+	UniqueID         string         `json:"uniqueid"`
+	SWVersion        string         `json:"swversion"`
+}
+
+type lightStateJSON struct {
+	On        bool   `json:"on"`
+	Bri       int    `json:"bri"`
+	Alert     string `json:"alert"`
+	Mode      string `json:"mode"`
+	Reachable bool   `json:"reachable"`
+}
+
+type configJSON struct {
+	Name       string `json:"name"`
+	BridgeID   string `json:"bridgeid"`
+	MAC        string `json:"mac"`
+	IPAddress  string `json:"ipaddress,omitempty"`
+	ModelID    string `json:"modelid"`
+	APIVersion string `json:"apiversion"`
+	SWVersion  string `json:"swversion"`
+}
+
+// serveAPI routes requests under /api. Like a real bridge, it reports
+// errors in the body of a 200 response.
+func (b *Bridge) serveAPI(w http.ResponseWriter, req *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(req.URL.Path, "/api"), "/")
+	if path == "" {
+		if req.Method != http.MethodPost {
+			writeError(w, typeMethod, "/", "method, "+req.Method+", not available for resource, /")
+			return
+		}
+		b.createUser(w, req)
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	user, parts := parts[0], parts[1:]
+	address := "/" + strings.Join(parts, "/")
+
+	// Clients read the config before pairing to identify the bridge
+	if len(parts) == 1 && parts[0] == "config" && req.Method == http.MethodGet {
+		writeJSON(w, b.config(req))
+		return
+	}
+
+	if !b.authorized(user) {
+		writeError(w, typeUnauthorized, address, "unauthorized user")
+		return
+	}
+
+	switch {
+	case len(parts) == 0 && req.Method == http.MethodGet:
+		writeJSON(w, map[string]interface{}{
+			"lights": b.lightsJSON(),
+			"config": b.config(req),
+		})
+	case len(parts) == 1 && parts[0] == "lights" && req.Method == http.MethodGet:
+		writeJSON(w, b.lightsJSON())
+	case len(parts) == 2 && parts[0] == "lights" && req.Method == http.MethodGet:
+		l := b.Light(parts[1])
+		if l == nil {
+			writeError(w, typeNotAvailable, address, "resource, "+address+", not available")
+			return
+		}
+		writeJSON(w, l.json())
+	case len(parts) == 3 && parts[0] == "lights" && parts[2] == "state":
+		l := b.Light(parts[1])
+		if l == nil {
+			writeError(w, typeNotAvailable, address, "resource, "+address+", not available")
+			return
+		}
+		if req.Method != http.MethodPut {
+			writeError(w, typeMethod, address, "method, "+req.Method+", not available for resource, "+address)
+			return
+		}
+		b.setState(w, req, l, address)
+	default:
+		writeError(w, typeNotAvailable, address, "resource, "+address+", not available")
+	}
+}
+
+// createUser pairs a client with the bridge
+func (b *Bridge) createUser(w http.ResponseWriter, req *http.Request) {
+	var body struct {
+		DeviceType string `json:"devicetype"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, typeInvalidJSON, "", "body contains invalid json")
+		return
+	}
+	if body.DeviceType == "" {
+		writeError(w, typeMissingParams, "/", "invalid/missing parameters in body")
+		return
+	}
+	if b.Pair != nil && !b.Pair(body.DeviceType) {
+		writeError(w, typeLinkButton, "", "link button not pressed")
+		return
+	}
+
+	user, err := newUsername()
+	if err != nil {
+		writeError(w, typeInternal, "", "internal error, "+err.Error())
+		return
+	}
+	b.mu.Lock()
+	b.users[user] = true
+	b.mu.Unlock()
+
+	writeJSON(w, []interface{}{
+		map[string]interface{}{"success": map[string]string{"username": user}},
+	})
+}
+
+func (b *Bridge) authorized(user string) bool {
+	if b.Pair == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.users[user]
+}
+
+// setState applies a state change to l, reporting the result
+// of each parameter as a real bridge does
+func (b *Bridge) setState(w http.ResponseWriter, req *http.Request, l *Light, address string) {
+	var params map[string]json.RawMessage
+	if err := json.NewDecoder(req.Body).Decode(&params); err != nil || params == nil {
+		writeError(w, typeInvalidJSON, address, "body contains invalid json")
+		return
+	}
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var results, errs []interface{}
+	success := func(name string, v interface{}) {
+		results = append(results, map[string]interface{}{
+			"success": map[string]interface{}{address + "/" + name: v},
+		})
+	}
+	fail := func(typ int, name, desc string) {
+		errs = append(errs, map[string]interface{}{
+			"error": apiError{typ, address + "/" + name, desc},
+		})
+	}
+
+	// The parameters are merged into the state while no other change
+	// can be made, so that concurrent requests do not undo each other
+	err := l.change(func(s *State) {
+		// on is applied first, so that a light can be turned on and
+		// dimmed in one request
+		if raw, ok := params["on"]; ok {
+			var on bool
+			if err := json.Unmarshal(raw, &on); err != nil {
+				fail(typeInvalidValue, "on", "invalid value, "+string(raw)+", for parameter, on")
+			} else {
+				s.On = on
+				success("on", on)
+			}
+		}
+
+		for _, name := range names {
+			raw := params[name]
+			switch name {
+			case "on":
+			case "bri":
+				var bri int
+				if err := json.Unmarshal(raw, &bri); err != nil || bri < MinBrightness || bri > MaxBrightness {
+					fail(typeInvalidValue, name, "invalid value, "+string(raw)+", for parameter, bri")
+					continue
+				}
+				if !s.On {
+					fail(typeDeviceOff, name, "parameter, bri, is not modifiable. Device is set to off.")
+					continue
+				}
+				s.Bri = bri
+				success(name, bri)
+			default:
+				fail(typeParamUnavailable, name, "parameter, "+name+", not available")
+			}
+		}
+	})
+	if err != nil {
+		writeError(w, typeInternal, address, "internal error, "+err.Error())
+		return
+	}
+	writeJSON(w, append(results, errs...))
+}
+
+func (b *Bridge) lightsJSON() map[string]lightJSON {
+	lights := make(map[string]lightJSON)
+	for _, l := range b.Lights() {
+		lights[l.ID] = l.json()
+	}
+	return lights
+}
+
+func (l *Light) json() lightJSON {
+	s := l.State()
+	return lightJSON{
+		State: lightStateJSON{
+			On:        s.On,
+			Bri:       s.Bri,
+			Alert:     "none",
+			Mode:      "homeautomation",
+			Reachable: true,
+		},
+		Type:             "Dimmable light",
+		Name:             l.Name,
+		ModelID:          "LWB010",
+		ManufacturerName: "Philips",
+		ProductName:      "Hue white lamp",
+		UniqueID:         l.UniqueID,
+		SWVersion:        "1.46.13_r26312",
+	}
+}
+
+func (b *Bridge) config(req *http.Request) configJSON {
+	host, _, err := net.SplitHostPort(req.Host)
+	if err != nil {
+		host = req.Host
+	}
+	return configJSON{
+		Name:       b.Name,
+		BridgeID:   b.BridgeID(),
+		MAC:        b.MAC(),
+		IPAddress:  host,
+		ModelID:    modelID,
+		APIVersion: apiVersion,
+		SWVersion:  swVersion,
+	}
+}
+
+// newUsername returns a random 40 character username
+func newUsername() (string, error) {
+	var b [20]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", b), nil
+}
+
+func writeError(w http.ResponseWriter, typ int, address, desc string) {
+	writeJSON(w, []interface{}{
+		map[string]interface{}{"error": apiError{typ, address, desc}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,268 @@
+package hue
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestBridge(t *testing.T) (*Bridge, *httptest.Server) {
+	b, err := NewBridge("Philips hue", testMAC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, httptest.NewServer(b.Handler())
+}
+
+// call makes an API request, decoding the response into v
+func call(t *testing.T, method, url, body string, v interface{}) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%s %s: unexpected status %s", method, url, resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("%s %s: unexpected content type %q", method, url, ct)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type result struct {
+	Success map[string]interface{} `json:"success"`
+	Error   *apiError              `json:"error"`
+}
+
+func TestLights(t *testing.T) {
+	b, srv := newTestBridge(t)
+	defer srv.Close()
+	b.AddLight("Lamp", nil)
+	b.AddLight("Fan", nil)
+
+	var lights map[string]lightJSON
+	call(t, http.MethodGet, srv.URL+"/api/anyone/lights", "", &lights)
+	if len(lights) != 2 || lights["1"].Name != "Lamp" || lights["2"].Name != "Fan" {
+		t.Fatalf("unexpected lights: %v", lights)
+	}
+	if lights["1"].UniqueID == lights["2"].UniqueID || !lights["1"].State.Reachable {
+		t.Fatalf("unexpected lights: %v", lights)
+	}
+
+	var light lightJSON
+	call(t, http.MethodGet, srv.URL+"/api/anyone/lights/2", "", &light)
+	if light.Name != "Fan" || light.State.Bri != MaxBrightness {
+		t.Fatalf("unexpected light: %v", light)
+	}
+
+	var results []result
+	call(t, http.MethodGet, srv.URL+"/api/anyone/lights/3", "", &results)
+	if len(results) != 1 || results[0].Error == nil || results[0].Error.Type != typeNotAvailable {
+		t.Fatalf("expected resource not available, got %v", results)
+	}
+
+	var full struct {
+		Lights map[string]lightJSON `json:"lights"`
+		Config configJSON           `json:"config"`
+	}
+	call(t, http.MethodGet, srv.URL+"/api/anyone", "", &full)
+	if len(full.Lights) != 2 || full.Config.BridgeID != "001788FFFE123456" {
+		t.Fatalf("unexpected full state: %v", full)
+	}
+	if full.Config.IPAddress != "127.0.0.1" {
+		t.Fatalf("unexpected IP address %q", full.Config.IPAddress)
+	}
+}
+
+func TestSetState(t *testing.T) {
+	b, srv := newTestBridge(t)
+	defer srv.Close()
+
+	var changes []State
+	fail := false
+	l := b.AddLight("Lamp", func(s State) error {
+		if fail {
+			return errors.New("bulb missing")
+		}
+		changes = append(changes, s)
+		return nil
+	})
+	url := srv.URL + "/api/anyone/lights/1/state"
+
+	var results []result
+	call(t, http.MethodPut, url, `{"on":true,"bri":100}`, &results)
+	expect := []result{
+		{Success: map[string]interface{}{"/lights/1/state/on": true}},
+		{Success: map[string]interface{}{"/lights/1/state/bri": float64(100)}},
+	}
+	if !reflect.DeepEqual(results, expect) {
+		t.Fatalf("unexpected results: %v", results)
+	}
+	if s := l.State(); s != (State{On: true, Bri: 100}) {
+		t.Fatalf("unexpected state %v", s)
+	}
+
+	// Unsupported and invalid parameters are reported,
+	// while the rest of the change is applied
+	results = nil
+	call(t, http.MethodPut, url, `{"bri":300,"hue":10,"on":false}`, &results)
+	if len(results) != 3 || results[0].Success == nil {
+		t.Fatalf("unexpected results: %v", results)
+	}
+	if results[1].Error.Type != typeInvalidValue || results[2].Error.Type != typeParamUnavailable {
+		t.Fatalf("unexpected errors: %v %v", results[1].Error, results[2].Error)
+	}
+	if s := l.State(); s != (State{On: false, Bri: 100}) {
+		t.Fatalf("unexpected state %v", s)
+	}
+
+	// Brightness cannot be changed while the light is off
+	results = nil
+	call(t, http.MethodPut, url, `{"bri":50}`, &results)
+	if len(results) != 1 || results[0].Error == nil || results[0].Error.Type != typeDeviceOff {
+		t.Fatalf("unexpected results: %v", results)
+	}
+
+	fail = true
+	results = nil
+	call(t, http.MethodPut, url, `{"on":true}`, &results)
+	if len(results) != 1 || results[0].Error == nil || results[0].Error.Type != typeInternal {
+		t.Fatalf("unexpected results: %v", results)
+	}
+	if l.State().On {
+		t.Fatal("state changed despite OnChange error")
+	}
+
+	expectChanges := []State{{On: true, Bri: 100}, {On: false, Bri: 100}}
+	if !reflect.DeepEqual(changes, expectChanges) {
+		t.Fatalf("unexpected OnChange calls: %v", changes)
+	}
+
+	results = nil
+	call(t, http.MethodPut, url, `{"on":`, &results)
+	if len(results) != 1 || results[0].Error == nil || results[0].Error.Type != typeInvalidJSON {
+		t.Fatalf("unexpected results: %v", results)
+	}
+
+	results = nil
+	call(t, http.MethodGet, url, "", &results)
+	if len(results) != 1 || results[0].Error == nil || results[0].Error.Type != typeMethod {
+		t.Fatalf("unexpected results: %v", results)
+	}
+}
+
+func TestSetStateConcurrent(t *testing.T) {
+	b, srv := newTestBridge(t)
+	defer srv.Close()
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	l := b.AddLight("Lamp", func(s State) error {
+		if !s.On {
+			started <- struct{}{}
+			<-release
+		}
+		return nil
+	})
+	l.Set(State{On: true, Bri: MaxBrightness})
+	url := srv.URL + "/api/anyone/lights/1/state"
+
+	put := func(body string, done chan<- []result) {
+		var results []result
+		req, err := http.NewRequest(http.MethodPut, url, strings.NewReader(body))
+		if err == nil {
+			var resp *http.Response
+			if resp, err = http.DefaultClient.Do(req); err == nil {
+				err = json.NewDecoder(resp.Body).Decode(&results)
+				resp.Body.Close()
+			}
+		}
+		if err != nil {
+			results = []result{{Error: &apiError{Description: err.Error()}}}
+		}
+		done <- results
+	}
+
+	// The light is dimmed while it is being switched off
+	off, dim := make(chan []result), make(chan []result)
+	go put(`{"on":false}`, off)
+	<-started
+	go put(`{"bri":100}`, dim)
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if results := <-off; len(results) != 1 || results[0].Success == nil {
+		t.Fatalf("unexpected results switching off: %v", results)
+	}
+	if results := <-dim; len(results) != 1 || results[0].Error == nil || results[0].Error.Type != typeDeviceOff {
+		t.Fatalf("unexpected results dimming: %v", results)
+	}
+	if s := l.State(); s != (State{On: false, Bri: MaxBrightness}) {
+		t.Fatalf("the light was switched back on by a stale state: %v", s)
+	}
+}
+
+func TestPairing(t *testing.T) {
+	b, srv := newTestBridge(t)
+	defer srv.Close()
+	b.AddLight("Lamp", nil)
+
+	pressed := false
+	b.Pair = func(deviceType string) bool {
+		return pressed && deviceType == "test#unit"
+	}
+
+	var results []result
+	call(t, http.MethodPost, srv.URL+"/api", `{"devicetype":"test#unit"}`, &results)
+	if len(results) != 1 || results[0].Error == nil || results[0].Error.Type != typeLinkButton {
+		t.Fatalf("expected link button error, got %v", results)
+	}
+
+	results = nil
+	call(t, http.MethodGet, srv.URL+"/api/stranger/lights", "", &results)
+	if len(results) != 1 || results[0].Error == nil || results[0].Error.Type != typeUnauthorized {
+		t.Fatalf("expected unauthorized error, got %v", results)
+	}
+
+	// The config is available before pairing
+	var config configJSON
+	call(t, http.MethodGet, srv.URL+"/api/stranger/config", "", &config)
+	if config.Name != "Philips hue" || config.MAC != "00:17:88:12:34:56" {
+		t.Fatalf("unexpected config: %v", config)
+	}
+
+	pressed = true
+	results = nil
+	call(t, http.MethodPost, srv.URL+"/api", `{"devicetype":"test#unit"}`, &results)
+	if len(results) != 1 || results[0].Success == nil {
+		t.Fatalf("expected success, got %v", results)
+	}
+	user, _ := results[0].Success["username"].(string)
+	if len(user) != 40 {
+		t.Fatalf("unexpected username %q", user)
+	}
+
+	var lights map[string]lightJSON
+	call(t, http.MethodGet, srv.URL+"/api/"+user+"/lights", "", &lights)
+	if len(lights) != 1 {
+		t.Fatalf("unexpected lights: %v", lights)
+	}
+
+	results = nil
+	call(t, http.MethodPost, srv.URL+"/api", `{}`, &results)
+	if len(results) != 1 || results[0].Error == nil || results[0].Error.Type != typeMissingParams {
+		t.Fatalf("expected missing parameters error, got %v", results)
+	}
+}
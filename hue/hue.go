@@ -0,0 +1,259 @@
+// Package hue emulates a Philips Hue bridge, so that lights controlled
+// from Go (or a shell command) can be switched and dimmed by anything
+// that speaks to a Hue bridge, such as Alexa or Harmony. The bridge is
+// advertised through minissdpd, serves the description.xml that Hue
+// clients probe and implements the part of the Hue REST API that
+// deals with lights.
+//
+// Real bridges also send a hue-bridgeid header in their SSDP responses.
+// minissdpd cannot add headers to its responses, so clients that
+// depend on it (such as the Hue app) will not find the emulated bridge.
+// Clients that read description.xml are unaffected.
+package hue
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/forfuncsake/minissdpc"
+	"github.com/forfuncsake/minissdpc/description"
+)
+
+// DeviceType is the UPnP device type advertised by Hue bridges
+const DeviceType = "urn:schemas-upnp-org:device:Basic:1"
+
+// DescriptionPath is the path at which the description is served
+const DescriptionPath = "/description.xml"
+
+// DefaultServer is the SERVER header advertised by real Hue bridges
+const DefaultServer = "Linux/3.14.0 UPnP/1.0 IpBridge/1.24.0"
+
+// Version information reported by the bridge's config
+const (
+	modelID    = "BSB002"
+	apiVersion = "1.24.0"
+	swVersion  = "1806051111"
+)
+
+// Brightness limits of a light
+const (
+	MinBrightness = 1
+	MaxBrightness = 254
+)
+
+var errInvalidMAC = errors.New("bridge MAC address must be 6 bytes")
+
+// A Bridge is a virtual Hue bridge. It must be created with NewBridge.
+type Bridge struct {
+	Name string
+
+	// Pair, if set, is called when a client asks to be paired with the
+	// bridge and reports whether the link button is pressed. Only paired
+	// clients may then use the API. If Pair is nil, pairing always
+	// succeeds and any username is accepted, as voice assistants expect.
+	Pair func(deviceType string) bool
+
+	mac    []byte
+	root   *description.Root
+	mu     sync.Mutex
+	lights []*Light
+	users  map[string]bool
+}
+
+// NewBridge returns a bridge with the given name. If mac is nil, one
+// is derived from the name so that the bridge keeps the same identity
+// across restarts.
+func NewBridge(name string, mac []byte) (*Bridge, error) {
+	if mac == nil {
+		sum := sha1.Sum([]byte(name))
+		mac = append([]byte{0x00, 0x17, 0x88}, sum[:3]...)
+	}
+	if len(mac) != 6 {
+		return nil, errInvalidMAC
+	}
+
+	b := &Bridge{
+		Name:  name,
+		mac:   append([]byte(nil), mac...),
+		users: make(map[string]bool),
+	}
+	serial := fmt.Sprintf("%x", b.mac)
+	b.root = description.New(description.Device{
+		DeviceType:       DeviceType,
+		FriendlyName:     name,
+		Manufacturer:     "Royal Philips Electronics",
+		ManufacturerURL:  "http://www.philips.com",
+		ModelDescription: "Philips hue Personal Wireless Lighting",
+		ModelName:        "Philips hue bridge 2015",
+		ModelNumber:      modelID,
+		ModelURL:         "http://www.meethue.com",
+		SerialNumber:     serial,
+		UDN:              "uuid:2f402f80-da50-11e1-9b23-" + serial,
+		PresentationURL:  "index.html",
+	})
+	b.root.Path = DescriptionPath
+	return b, nil
+}
+
+// UDN returns the unique device name of the bridge
+func (b *Bridge) UDN() string {
+	return b.root.Device.UDN
+}
+
+// BridgeID returns the identifier that real bridges send in the
+// hue-bridgeid header and report in their config
+func (b *Bridge) BridgeID() string {
+	return strings.ToUpper(fmt.Sprintf("%x", b.mac[:3]) + "fffe" + fmt.Sprintf("%x", b.mac[3:]))
+}
+
+// MAC returns the bridge's MAC address in colon separated form
+func (b *Bridge) MAC() string {
+	parts := make([]string, len(b.mac))
+	for i, v := range b.mac {
+		parts[i] = fmt.Sprintf("%02x", v)
+	}
+	return strings.Join(parts, ":")
+}
+
+// AddLight adds a dimmable light to the bridge. onChange is called
+// when a client changes the light's state, and may be nil.
+func (b *Bridge) AddLight(name string, onChange func(State) error) *Light {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sum := sha1.Sum([]byte(b.BridgeID() + name))
+	l := &Light{
+		ID:       strconv.Itoa(len(b.lights) + 1),
+		Name:     name,
+		UniqueID: fmt.Sprintf("00:17:88:01:00:%02x:%02x:%02x-0b", sum[0], sum[1], sum[2]),
+		OnChange: onChange,
+		state:    State{Bri: MaxBrightness},
+	}
+	b.lights = append(b.lights, l)
+	return l
+}
+
+// Lights returns the lights of the bridge in the order they were added
+func (b *Bridge) Lights() []*Light {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*Light(nil), b.lights...)
+}
+
+// Light returns the light with the given ID, or nil
+func (b *Bridge) Light(id string) *Light {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, l := range b.lights {
+		if l.ID == id {
+			return l
+		}
+	}
+	return nil
+}
+
+// Handler returns the handler for the description and the REST API
+func (b *Bridge) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(b.root.Path, b.serveDescription)
+	mux.HandleFunc("/api", b.serveAPI)
+	mux.HandleFunc("/api/", b.serveAPI)
+	return mux
+}
+
+// serveDescription serves the description with URLBase set to the
+// address the client used, which Hue clients use to find the API
+func (b *Bridge) serveDescription(w http.ResponseWriter, req *http.Request) {
+	root := *b.root
+	root.URLBase = "http://" + req.Host + "/"
+	root.ServeHTTP(w, req)
+}
+
+// Services returns the SSDP entries that advertise the bridge, with
+// baseURL being the scheme and host the bridge is served on
+func (b *Bridge) Services(baseURL, server string) ([]minissdpc.Service, error) {
+	if server == "" {
+		server = DefaultServer
+	}
+	return b.root.Services(baseURL, server)
+}
+
+// Register registers all of the bridge's SSDP entries with minissdpd
+func (b *Bridge) Register(c *minissdpc.Client, baseURL, server string) error {
+	services, err := b.Services(baseURL, server)
+	if err != nil {
+		return err
+	}
+	for _, svc := range services {
+		if err := c.RegisterService(svc); err != nil {
+			return fmt.Errorf("could not register %s: %v", svc.USN, err)
+		}
+	}
+	return nil
+}
+
+// State is the controllable state of a light
+type State struct {
+	On  bool
+	Bri int
+}
+
+// A Light is a dimmable light exposed by a Bridge
+type Light struct {
+	ID       string
+	Name     string
+	UniqueID string
+
+	// OnChange is called when a client changes the state of the light.
+	// If it returns an error, the client is told the change failed
+	// and the state is left unchanged.
+	OnChange func(State) error
+
+	// changing is held while a client changes the state, so that
+	// changes are made from the latest state and OnChange calls do
+	// not overlap. mu is never held while OnChange runs, so a slow
+	// hook does not block other requests.
+	changing sync.Mutex
+	mu       sync.Mutex
+	state    State
+}
+
+// State returns the current state of the light
+func (l *Light) State() State {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state
+}
+
+// Set changes the state of the light locally, without calling OnChange
+func (l *Light) Set(s State) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.state = s
+}
+
+// change applies update to the current state, calling OnChange
+// if the state then differs
+func (l *Light) change(update func(*State)) error {
+	l.changing.Lock()
+	defer l.changing.Unlock()
+
+	current := l.State()
+	s := current
+	update(&s)
+	if s == current {
+		return nil
+	}
+	if l.OnChange != nil {
+		if err := l.OnChange(s); err != nil {
+			return err
+		}
+	}
+	l.Set(s)
+	return nil
+}
@@ -0,0 +1,181 @@
+package hue
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/forfuncsake/minissdpc"
+	"github.com/forfuncsake/minissdpc/description"
+)
+
+var testMAC = []byte{0x00, 0x17, 0x88, 0x12, 0x34, 0x56}
+
+func TestIdentity(t *testing.T) {
+	b, err := NewBridge("Philips hue", testMAC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := b.BridgeID(); id != "001788FFFE123456" {
+		t.Errorf("unexpected bridge ID %q", id)
+	}
+	if mac := b.MAC(); mac != "00:17:88:12:34:56" {
+		t.Errorf("unexpected MAC %q", mac)
+	}
+	if udn := b.UDN(); udn != "uuid:2f402f80-da50-11e1-9b23-001788123456" {
+		t.Errorf("unexpected UDN %q", udn)
+	}
+
+	if _, err := NewBridge("Philips hue", []byte{1, 2, 3}); err != errInvalidMAC {
+		t.Errorf("expected errInvalidMAC, got %v", err)
+	}
+
+	x, _ := NewBridge("Kitchen", nil)
+	y, _ := NewBridge("Kitchen", nil)
+	z, _ := NewBridge("Lounge", nil)
+	if x.BridgeID() != y.BridgeID() || x.BridgeID() == z.BridgeID() {
+		t.Errorf("derived bridge IDs are not stable per name: %s %s %s", x.BridgeID(), y.BridgeID(), z.BridgeID())
+	}
+	if !strings.HasPrefix(x.MAC(), "00:17:88:") {
+		t.Errorf("derived MAC %s does not have the Philips prefix", x.MAC())
+	}
+}
+
+func TestDescription(t *testing.T) {
+	b, err := NewBridge("Philips hue", testMAC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(b.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + DescriptionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %s", resp.Status)
+	}
+
+	root, err := description.Parse(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.URLBase != srv.URL+"/" {
+		t.Errorf("expected URLBase %s/, got %s", srv.URL, root.URLBase)
+	}
+	d := root.Device
+	if d.DeviceType != DeviceType || d.UDN != b.UDN() || d.ModelName != "Philips hue bridge 2015" {
+		t.Errorf("unexpected device: %#v", d)
+	}
+	if d.SerialNumber != "001788123456" {
+		t.Errorf("unexpected serial number %q", d.SerialNumber)
+	}
+
+	// Serving the description must not modify the bridge's copy
+	if b.root.URLBase != "" {
+		t.Errorf("URLBase leaked into the bridge: %q", b.root.URLBase)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "minissdpd.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	received := make(chan []byte)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		b, _ := ioutil.ReadAll(conn)
+		received <- b
+	}()
+
+	b, err := NewBridge("Philips hue", testMAC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &minissdpc.Client{SocketPath: path}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Register(c, "http://192.168.1.20/", ""); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	sent := <-received
+	services, err := b.Services("http://192.168.1.20", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	types := []string{minissdpc.NTRootDevice, b.UDN(), DeviceType}
+	if len(services) != len(types) {
+		t.Fatalf("expected %d services, got %d", len(types), len(services))
+	}
+	for i, svc := range services {
+		if svc.Type != types[i] {
+			t.Errorf("expected type %s, got %s", types[i], svc.Type)
+		}
+		if svc.Location != "http://192.168.1.20/description.xml" || svc.Server != DefaultServer {
+			t.Errorf("unexpected service %v", svc)
+		}
+		if !bytes.Contains(sent, []byte(svc.USN)) {
+			t.Errorf("%s was not registered", svc.USN)
+		}
+	}
+}
+
+func TestLightSlowOnChange(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	l := &Light{OnChange: func(State) error {
+		close(started)
+		<-release
+		return nil
+	}}
+
+	done := make(chan error)
+	go func() {
+		done <- l.change(func(s *State) { s.On = true })
+	}()
+	<-started
+
+	// The state can be read while OnChange runs
+	if l.State().On {
+		t.Fatal("light is on before OnChange returned")
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if !l.State().On {
+		t.Fatal("light is not on after OnChange returned")
+	}
+}
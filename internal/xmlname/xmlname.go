@@ -0,0 +1,22 @@
+// Package xmlname checks the names that the UPnP packages write as
+// XML element names, such as action arguments and state variables.
+package xmlname
+
+import "unicode"
+
+// Valid reports whether name may be used as an element name.
+// Colons are not allowed, as a name may be written with a prefix.
+func Valid(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+		case i > 0 && (r == '-' || r == '.' || unicode.IsDigit(r)):
+		default:
+			return false
+		}
+	}
+	return true
+}
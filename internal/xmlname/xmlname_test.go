@@ -0,0 +1,26 @@
+package xmlname
+
+import "testing"
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"BinaryState", true},
+		{"_private", true},
+		{"New-Value.2", true},
+		{"État", true},
+		{"", false},
+		{"2Fast", false},
+		{"-dash", false},
+		{"u:Prefixed", false},
+		{"a b", false},
+		{"a><b", false},
+	}
+	for _, test := range tests {
+		if v := Valid(test.name); v != test.valid {
+			t.Errorf("%q: expected %v, got %v", test.name, test.valid, v)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package minissdpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultStateDir is where the ownership ledger is kept by default
+var DefaultStateDir = "/var/lib/minissdpc"
+
+// LedgerFile is the name of the ledger's state file in its directory
+const LedgerFile = "ledger.json"
+
+// ledgerLockFile is the file in the ledger's directory that is locked
+// while the state file is read, modified and replaced
+const ledgerLockFile = "ledger.lock"
+
+// ledgerVersion is the version of the state file format
+const ledgerVersion = 1
+
+// A LedgerEntry records the registration of a service
+type LedgerEntry struct {
+	Service      Service   `json:"service"`
+	Owner        string    `json:"owner"`
+	RegisteredAt time.Time `json:"registered_at"`
+}
+
+type ledgerState struct {
+	Version int           `json:"version"`
+	Entries []LedgerEntry `json:"entries"`
+}
+
+// A Ledger records which services were registered from this host,
+// as minissdpd itself has no notion of who registered what. Entries
+// are keyed by USN and Type, as minissdpd keys its services.
+//
+// The ledger is a JSON state file that is replaced atomically on
+// every change. A Ledger is safe for concurrent use, and updates by
+// separate processes are serialized by a lock on ledgerLockFile.
+type Ledger struct {
+	// Dir is the directory holding the state file.
+	// It is created when the ledger is first written.
+	Dir string
+
+	// Owner is recorded with each entry,
+	// and defaults to the name of the program
+	Owner string
+
+	// now is replaced in tests
+	now func() time.Time
+
+	mu sync.Mutex
+}
+
+// A LedgerError is returned by Client.RegisterService when the
+// service was registered, but could not be recorded in the ledger
+type LedgerError struct {
+	Err error
+}
+
+func (e *LedgerError) Error() string {
+	return fmt.Sprintf("service registered but not recorded in ledger: %v", e.Err)
+}
+
+// NewLedger returns a ledger kept in dir
+func NewLedger(dir string) *Ledger {
+	return &Ledger{
+		Dir:   dir,
+		Owner: filepath.Base(os.Args[0]),
+		now:   time.Now,
+	}
+}
+
+// Path returns the path of the state file
+func (l *Ledger) Path() string {
+	return filepath.Join(l.Dir, LedgerFile)
+}
+
+// Entries returns all of the recorded registrations. A ledger
+// whose state file does not exist yet has no entries.
+func (l *Ledger) Entries() ([]LedgerEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.load()
+}
+
+// Lookup returns the entry recorded for s, if there is one
+func (l *Ledger) Lookup(s Service) (LedgerEntry, bool, error) {
+	entries, err := l.Entries()
+	if err != nil {
+		return LedgerEntry{}, false, err
+	}
+	for _, e := range entries {
+		if sameService(e.Service, s) {
+			return e, true, nil
+		}
+	}
+	return LedgerEntry{}, false, nil
+}
+
+// Record adds or updates the entries for services,
+// marking them as registered now by the ledger's Owner
+func (l *Ledger) Record(services ...Service) error {
+	return l.update(func(entries []LedgerEntry) []LedgerEntry {
+		now := l.now().UTC()
+		for _, s := range services {
+			e := LedgerEntry{Service: s, Owner: l.Owner, RegisteredAt: now}
+			found := false
+			for i := range entries {
+				if sameService(entries[i].Service, s) {
+					entries[i] = e
+					found = true
+					break
+				}
+			}
+			if !found {
+				entries = append(entries, e)
+			}
+		}
+		return entries
+	})
+}
+
+// Forget removes the entries for services. minissdpd will continue
+// to advertise them until it is restarted.
+func (l *Ledger) Forget(services ...Service) error {
+	return l.update(func(entries []LedgerEntry) []LedgerEntry {
+		kept := entries[:0]
+		for _, e := range entries {
+			forget := false
+			for _, s := range services {
+				if sameService(e.Service, s) {
+					forget = true
+					break
+				}
+			}
+			if !forget {
+				kept = append(kept, e)
+			}
+		}
+		return kept
+	})
+}
+
+// update replaces the entries with those returned by modify, holding
+// the lock file so that no other process updates them in between
+func (l *Ledger) update(modify func([]LedgerEntry) []LedgerEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(l.Dir, 0755); err != nil {
+		return fmt.Errorf("could not create ledger directory: %v", err)
+	}
+	unlock, err := lockFile(filepath.Join(l.Dir, ledgerLockFile))
+	if err != nil {
+		return fmt.Errorf("could not lock ledger: %v", err)
+	}
+	defer unlock()
+
+	entries, err := l.load()
+	if err != nil {
+		return err
+	}
+	return l.save(modify(entries))
+}
+
+// owned returns a function reporting whether a service is in the ledger
+func (l *Ledger) owned() (func(Service) bool, error) {
+	entries, err := l.Entries()
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[[2]string]bool, len(entries))
+	for _, e := range entries {
+		keys[[2]string{e.Service.USN, e.Service.Type}] = true
+	}
+	return func(s Service) bool {
+		return keys[[2]string{s.USN, s.Type}]
+	}, nil
+}
+
+// load must be called with l.mu held
+func (l *Ledger) load() ([]LedgerEntry, error) {
+	b, err := ioutil.ReadFile(l.Path())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read ledger: %v", err)
+	}
+
+	var state ledgerState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("could not parse ledger %s: %v", l.Path(), err)
+	}
+	if state.Version != ledgerVersion {
+		return nil, fmt.Errorf("ledger %s has unsupported version %d", l.Path(), state.Version)
+	}
+	return state.Entries, nil
+}
+
+// save must be called by update
+func (l *Ledger) save(entries []LedgerEntry) error {
+	if entries == nil {
+		entries = []LedgerEntry{}
+	}
+	b, err := json.MarshalIndent(ledgerState{ledgerVersion, entries}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode ledger: %v", err)
+	}
+
+	f, err := ioutil.TempFile(l.Dir, LedgerFile+".tmp")
+	if err != nil {
+		return fmt.Errorf("could not write ledger: %v", err)
+	}
+	_, err = f.Write(append(b, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), l.Path())
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("could not write ledger: %v", err)
+	}
+	return nil
+}
+
+// sameService reports whether a and b are the same minissdpd entry
+func sameService(a, b Service) bool {
+	return a.USN == b.USN && a.Type == b.Type
+}
@@ -0,0 +1,133 @@
+package minissdpc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestLedger(t *testing.T) (*Ledger, func()) {
+	dir, err := ioutil.TempDir("", "ssdpc-ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewLedger(filepath.Join(dir, "state"))
+	l.Owner = "test"
+	l.now = func() time.Time {
+		return time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+	}
+	return l, func() { os.RemoveAll(dir) }
+}
+
+func TestLedger(t *testing.T) {
+	l, cleanup := newTestLedger(t)
+	defer cleanup()
+
+	entries, err := l.Entries()
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("expected an empty ledger, got %v, %v", entries, err)
+	}
+
+	services := testDevice("http://192.168.1.10/setup.xml")
+	if err := l.Record(services...); err != nil {
+		t.Fatal(err)
+	}
+
+	// Recording a service again replaces its entry
+	moved := services[1]
+	moved.Location = "http://192.168.1.11/setup.xml"
+	l.Owner = "other"
+	if err := l.Record(moved); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new Ledger reads the same state
+	entries, err = NewLedger(l.Dir).Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(services) {
+		t.Fatalf("expected %d entries, got %d", len(services), len(entries))
+	}
+	if entries[0].Owner != "test" || !entries[0].RegisteredAt.Equal(l.now()) || entries[0].Service != services[0] {
+		t.Fatalf("unexpected entry %+v", entries[0])
+	}
+	if entries[1].Owner != "other" || entries[1].Service != moved {
+		t.Fatalf("unexpected entry %+v", entries[1])
+	}
+
+	e, ok, err := l.Lookup(services[2])
+	if err != nil || !ok || e.Service != services[2] {
+		t.Fatalf("unexpected lookup result %+v, %v, %v", e, ok, err)
+	}
+
+	if err := l.Forget(services[0], services[2]); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := l.Lookup(services[2]); ok {
+		t.Fatal("forgotten service is still in the ledger")
+	}
+	entries, _ = l.Entries()
+	if len(entries) != len(services)-2 {
+		t.Fatalf("expected %d entries, got %d", len(services)-2, len(entries))
+	}
+}
+
+func TestLedgerInvalid(t *testing.T) {
+	l, cleanup := newTestLedger(t)
+	defer cleanup()
+
+	if err := os.MkdirAll(l.Dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"{", `{"version":2,"entries":[]}`} {
+		if err := ioutil.WriteFile(l.Path(), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := l.Entries(); err == nil {
+			t.Fatalf("expected an error reading %s", content)
+		}
+		if err := l.Record(testDevice("http://192.168.1.10/setup.xml")...); err == nil {
+			t.Fatalf("expected an error recording over %s", content)
+		}
+	}
+}
+
+func TestLedgerConcurrentWriters(t *testing.T) {
+	l, cleanup := newTestLedger(t)
+	defer cleanup()
+
+	// Each Ledger stands for a separate process, as they share
+	// nothing but the directory
+	const writers, records = 2, 50
+	errs := make(chan error, writers)
+	for w := 0; w < writers; w++ {
+		go func(w int) {
+			l := NewLedger(l.Dir)
+			for i := 0; i < records; i++ {
+				s := Service{Type: "upnp:rootdevice", USN: fmt.Sprintf("uuid:writer-%d-%d::upnp:rootdevice", w, i)}
+				if err := l.Record(s); err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}(w)
+	}
+	for w := 0; w < writers; w++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := l.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != writers*records {
+		t.Fatalf("expected %d entries, got %d: updates were lost", writers*records, len(entries))
+	}
+}
@@ -0,0 +1,206 @@
+package minissdpc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Placeholders that may be used in a Location template
+const (
+	// PlaceholderInterface is followed by an interface name, as in
+	// {iface:eth0}, and is replaced by that interface's address
+	PlaceholderInterface = "iface:"
+
+	// PlaceholderPrimaryIP is replaced by the address of the first
+	// interface that is up and not a loopback
+	PlaceholderPrimaryIP = "primary-ip"
+)
+
+var (
+	errUnterminated    = errors.New("unterminated placeholder")
+	errUnknownHolder   = errors.New("unknown placeholder")
+	errNoInterface     = errors.New("no such interface")
+	errNoAddress       = errors.New("interface has no usable address")
+	errNoPrimaryIP     = errors.New("no interface is up with a non-loopback address")
+	errInterfaceIsDown = errors.New("interface is down")
+)
+
+// An Interface is a network interface, as seen by a Resolver
+type Interface struct {
+	Name  string
+	Flags net.Flags
+	Addrs []net.IP
+}
+
+// A Resolver lists the network interfaces that Location templates
+// are resolved against
+type Resolver interface {
+	Interfaces() ([]Interface, error)
+}
+
+// ResolverFunc adapts a function to a Resolver
+type ResolverFunc func() ([]Interface, error)
+
+// Interfaces implements Resolver
+func (f ResolverFunc) Interfaces() ([]Interface, error) {
+	return f()
+}
+
+// SystemResolver resolves templates against the host's interfaces
+var SystemResolver Resolver = ResolverFunc(systemInterfaces)
+
+func systemInterfaces() ([]Interface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("could not list interfaces: %v", err)
+	}
+
+	out := make([]Interface, 0, len(ifaces))
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("could not list addresses of %s: %v", iface.Name, err)
+		}
+		i := Interface{Name: iface.Name, Flags: iface.Flags}
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok {
+				i.Addrs = append(i.Addrs, ipnet.IP)
+			}
+		}
+		out = append(out, i)
+	}
+	return out, nil
+}
+
+// IsTemplate reports whether location contains placeholders
+func IsTemplate(location string) bool {
+	return strings.ContainsRune(location, '{')
+}
+
+// ResolveLocation replaces the placeholders in a Location template
+// with addresses found by r, or by SystemResolver if r is nil.
+// IPv4 addresses are preferred, and IPv6 addresses are bracketed
+// so that they may be followed by a port.
+func ResolveLocation(template string, r Resolver) (string, error) {
+	if !IsTemplate(template) {
+		return template, nil
+	}
+	if r == nil {
+		r = SystemResolver
+	}
+	ifaces, err := r.Interfaces()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	rest := template
+	for {
+		i := strings.IndexByte(rest, '{')
+		if i < 0 {
+			b.WriteString(rest)
+			return b.String(), nil
+		}
+		b.WriteString(rest[:i])
+		rest = rest[i+1:]
+
+		j := strings.IndexByte(rest, '}')
+		if j < 0 {
+			return "", fmt.Errorf("%v in %q", errUnterminated, template)
+		}
+		holder := rest[:j]
+		rest = rest[j+1:]
+
+		var ip net.IP
+		switch {
+		case holder == PlaceholderPrimaryIP:
+			ip, err = primaryIP(ifaces)
+		case strings.HasPrefix(holder, PlaceholderInterface):
+			ip, err = interfaceIP(ifaces, strings.TrimPrefix(holder, PlaceholderInterface))
+		default:
+			err = fmt.Errorf("%v {%s}", errUnknownHolder, holder)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if ip.To4() == nil {
+			b.WriteString("[" + ip.String() + "]")
+		} else {
+			b.WriteString(ip.String())
+		}
+	}
+}
+
+// PrimaryIP returns the address that {primary-ip} resolves to,
+// using r or SystemResolver if r is nil
+func PrimaryIP(r Resolver) (net.IP, error) {
+	if r == nil {
+		r = SystemResolver
+	}
+	ifaces, err := r.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	return primaryIP(ifaces)
+}
+
+func primaryIP(ifaces []Interface) (net.IP, error) {
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		if ip := usableIP(iface.Addrs); ip != nil {
+			return ip, nil
+		}
+	}
+	return nil, errNoPrimaryIP
+}
+
+func interfaceIP(ifaces []Interface, name string) (net.IP, error) {
+	for _, iface := range ifaces {
+		if iface.Name != name {
+			continue
+		}
+		if iface.Flags&net.FlagUp == 0 {
+			return nil, fmt.Errorf("%v: %s", errInterfaceIsDown, name)
+		}
+		if ip := usableIP(iface.Addrs); ip != nil {
+			return ip, nil
+		}
+		return nil, fmt.Errorf("%v: %s", errNoAddress, name)
+	}
+	return nil, fmt.Errorf("%v: %s", errNoInterface, name)
+}
+
+// usableIP returns the first IPv4 address, or failing that the first
+// global IPv6 address. Link-local addresses are skipped, as they
+// cannot be used in a URL without a zone.
+func usableIP(addrs []net.IP) net.IP {
+	var v6 net.IP
+	for _, ip := range addrs {
+		if ip.IsLinkLocalUnicast() {
+			continue
+		}
+		if ip.To4() != nil {
+			return ip
+		}
+		if v6 == nil {
+			v6 = ip
+		}
+	}
+	return v6
+}
+
+// ResolveLocation returns a copy of s with its Location template
+// resolved by r, or by SystemResolver if r is nil
+func (s Service) ResolveLocation(r Resolver) (Service, error) {
+	loc, err := ResolveLocation(s.Location, r)
+	if err != nil {
+		return s, &ValidationError{"location", s.Location, err}
+	}
+	s.Location = loc
+	return s, nil
+}
@@ -0,0 +1,99 @@
+package minissdpc
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeInterfaces is a Resolver whose interfaces can be changed
+type fakeInterfaces struct {
+	mu     sync.Mutex
+	ifaces []Interface
+}
+
+func (f *fakeInterfaces) Interfaces() ([]Interface, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Interface(nil), f.ifaces...), nil
+}
+
+func (f *fakeInterfaces) set(ifaces ...Interface) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ifaces = ifaces
+}
+
+func testInterfaces() []Interface {
+	return []Interface{
+		{Name: "lo", Flags: net.FlagUp | net.FlagLoopback, Addrs: []net.IP{net.ParseIP("127.0.0.1")}},
+		{Name: "eth0", Flags: net.FlagUp, Addrs: []net.IP{net.ParseIP("fe80::1"), net.ParseIP("192.168.1.10")}},
+		{Name: "eth1", Flags: net.FlagUp, Addrs: []net.IP{net.ParseIP("fe80::2"), net.ParseIP("2001:db8::2")}},
+		{Name: "eth2", Flags: 0, Addrs: []net.IP{net.ParseIP("10.0.0.2")}},
+		{Name: "eth3", Flags: net.FlagUp, Addrs: []net.IP{net.ParseIP("fe80::3")}},
+	}
+}
+
+func TestResolveLocation(t *testing.T) {
+	r := &fakeInterfaces{ifaces: testInterfaces()}
+
+	tests := []struct {
+		template string
+		expect   string
+		err      error
+	}{
+		{"http://192.168.1.5/setup.xml", "http://192.168.1.5/setup.xml", nil},
+		{"http://{iface:eth0}:8080/setup.xml", "http://192.168.1.10:8080/setup.xml", nil},
+		{"http://{primary-ip}:8080/setup.xml", "http://192.168.1.10:8080/setup.xml", nil},
+		{"http://{iface:eth1}:8080/setup.xml", "http://[2001:db8::2]:8080/setup.xml", nil},
+		{"http://{iface:lo}/x/{iface:eth0}", "http://127.0.0.1/x/192.168.1.10", nil},
+		{"http://{iface:eth2}/setup.xml", "", errInterfaceIsDown},
+		{"http://{iface:eth3}/setup.xml", "", errNoAddress},
+		{"http://{iface:wlan0}/setup.xml", "", errNoInterface},
+		{"http://{hostname}/setup.xml", "", errUnknownHolder},
+		{"http://{iface:eth0/setup.xml", "", errUnterminated},
+	}
+
+	for _, test := range tests {
+		t.Run(test.template, func(t *testing.T) {
+			got, err := ResolveLocation(test.template, r)
+			if test.err != nil {
+				if err == nil || !strings.Contains(err.Error(), test.err.Error()) {
+					t.Fatalf("expected %v, got %q, %v", test.err, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.expect {
+				t.Fatalf("expected %s, got %s", test.expect, got)
+			}
+		})
+	}
+}
+
+func TestPrimaryIP(t *testing.T) {
+	r := &fakeInterfaces{ifaces: testInterfaces()[:1]}
+	if _, err := PrimaryIP(r); err != errNoPrimaryIP {
+		t.Fatalf("expected errNoPrimaryIP, got %v", err)
+	}
+
+	r.set(testInterfaces()[2:]...)
+	ip, err := PrimaryIP(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip.String() != "2001:db8::2" {
+		t.Fatalf("expected 2001:db8::2, got %s", ip)
+	}
+
+	failing := ResolverFunc(func() ([]Interface, error) {
+		return nil, errors.New("no interfaces here")
+	})
+	if _, err := ResolveLocation("http://{primary-ip}/", failing); err == nil {
+		t.Fatal("expected resolver error")
+	}
+}
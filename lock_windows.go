@@ -0,0 +1,7 @@
+package minissdpc
+
+// lockFile does nothing on Windows, where updates of the ledger by
+// separate processes are not serialized
+func lockFile(path string) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,202 @@
+// Package manifest reads a declarative list of the devices and
+// services that minissdpd should advertise. Devices are expanded
+// into the full set of SSDP advertisements from their UUID, as
+// minissdpc.DeviceAdvertisement does.
+//
+// A manifest is YAML:
+//
+//	server: Linux/4.14 UPnP/1.0 nas/1.0
+//	location: http://{primary-ip}:5000/description.xml
+//	devices:
+//	  - uuid: 4d696e69-444c-164e-9d41-b827eb96c6c2
+//	    type: urn:schemas-upnp-org:device:MediaServer:1
+//	    services:
+//	      - urn:schemas-upnp-org:service:ContentDirectory:1
+//	      - urn:schemas-upnp-org:service:ConnectionManager:1
+//	services:
+//	  - type: urn:schemas-upnp-org:service:Printer:1
+//	    usn: uuid:5b1a9c2e-93f4-4b0e-8f3c-0a1b2c3d4e5f::urn:schemas-upnp-org:service:Printer:1
+//	    location: http://{iface:eth0}:631/printer.xml
+//
+// The server and location at the top level are defaults for the
+// devices and services that do not set their own. Locations may
+// use the templates of minissdpc.ResolveLocation.
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/forfuncsake/minissdpc"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	errNoUUID       = errors.New("device has no uuid")
+	errNoDeviceType = errors.New("device has no type")
+	errDuplicate    = errors.New("service is declared more than once")
+)
+
+// Manifest is the set of devices and services to advertise
+type Manifest struct {
+	// Server and Location are the defaults for devices
+	// and services that do not set their own
+	Server   string `yaml:"server"`
+	Location string `yaml:"location"`
+
+	Devices []Device `yaml:"devices"`
+
+	// Services are single advertisements, registered as given
+	Services []minissdpc.Service `yaml:"services"`
+}
+
+// Device is a UPnP device, advertised with all of the entries that
+// the UPnP Device Architecture requires for it
+type Device struct {
+	// UUID identifies the device, with or without the "uuid:" prefix
+	UUID string `yaml:"uuid"`
+
+	// Type is the device's URN, e.g. urn:Belkin:device:controllee:1
+	Type string `yaml:"type"`
+
+	// Services lists the URNs of the services offered by the device
+	Services []string `yaml:"services"`
+
+	// Devices holds any embedded devices, which inherit
+	// their Location and Server from the parent
+	Devices []Device `yaml:"devices"`
+
+	Location string `yaml:"location"`
+	Server   string `yaml:"server"`
+}
+
+// Read parses a manifest. Unknown fields are rejected,
+// so that a misspelt field is not silently ignored.
+func Read(r io.Reader) (*Manifest, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not read manifest: %v", err)
+	}
+	m := &Manifest{}
+	if err := yaml.UnmarshalStrict(b, m); err != nil {
+		return nil, fmt.Errorf("could not parse manifest: %v", err)
+	}
+	return m, nil
+}
+
+// ReadFile parses the manifest in the named file
+func ReadFile(path string) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read manifest: %v", err)
+	}
+	defer f.Close()
+
+	m, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return m, nil
+}
+
+// Expand returns every service entry declared by the manifest:
+// the expanded advertisements of each device, followed by the
+// individual services. Location templates are left unresolved.
+func (m *Manifest) Expand() []minissdpc.Service {
+	var services []minissdpc.Service
+	for _, d := range m.Devices {
+		ad := d.advertisement()
+		if ad.Location == "" {
+			ad.Location = m.Location
+		}
+		if ad.Server == "" {
+			ad.Server = m.Server
+		}
+		services = append(services, ad.Services()...)
+	}
+
+	for _, service := range m.Services {
+		if service.Server == "" {
+			service.Server = m.Server
+		}
+		if service.Location == "" {
+			service.Location = m.Location
+		}
+		services = append(services, service)
+	}
+	return services
+}
+
+// Validate checks that every device has a UUID and type, that no
+// service is declared twice, and that each service is valid for
+// registration once its Location is resolved with r. A nil r uses
+// minissdpc.SystemResolver. The first problem found is returned.
+func (m *Manifest) Validate(r minissdpc.Resolver) error {
+	return m.validate(r, false)
+}
+
+// ValidateAllowLoopback is Validate, but accepts services with a
+// Location on a loopback address, as Service.ValidateAllowLoopback
+func (m *Manifest) ValidateAllowLoopback(r minissdpc.Resolver) error {
+	return m.validate(r, true)
+}
+
+func (m *Manifest) validate(r minissdpc.Resolver, allowLoopback bool) error {
+	for i := range m.Devices {
+		if err := m.Devices[i].validate(); err != nil {
+			return fmt.Errorf("devices[%d]: %v", i, err)
+		}
+	}
+
+	seen := make(map[[2]string]bool)
+	for _, s := range m.Expand() {
+		key := [2]string{s.USN, s.Type}
+		if seen[key] {
+			return fmt.Errorf("%s: %v", s.USN, errDuplicate)
+		}
+		seen[key] = true
+
+		resolved, err := s.ResolveLocation(r)
+		if err == nil && allowLoopback {
+			err = resolved.ValidateAllowLoopback()
+		} else if err == nil {
+			err = resolved.Validate()
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", s.USN, err)
+		}
+	}
+	return nil
+}
+
+func (d *Device) validate() error {
+	if d.UUID == "" {
+		return errNoUUID
+	}
+	if d.Type == "" {
+		return errNoDeviceType
+	}
+	for i := range d.Devices {
+		if err := d.Devices[i].validate(); err != nil {
+			return fmt.Errorf("devices[%d]: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (d *Device) advertisement() minissdpc.DeviceAdvertisement {
+	ad := minissdpc.DeviceAdvertisement{
+		UUID:         d.UUID,
+		DeviceType:   d.Type,
+		ServiceTypes: d.Services,
+		Location:     d.Location,
+		Server:       d.Server,
+	}
+	for i := range d.Devices {
+		ad.Devices = append(ad.Devices, d.Devices[i].advertisement())
+	}
+	return ad
+}
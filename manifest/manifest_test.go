@@ -0,0 +1,175 @@
+package manifest
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/forfuncsake/minissdpc"
+)
+
+const testManifest = `
+server: Linux/4.14 UPnP/1.0 nas/1.0
+location: http://{iface:eth0}:5000/description.xml
+devices:
+  - uuid: 4d696e69-444c-164e-9d41-b827eb96c6c2
+    type: urn:schemas-upnp-org:device:MediaServer:1
+    services:
+      - urn:schemas-upnp-org:service:ContentDirectory:1
+      - urn:schemas-upnp-org:service:ConnectionManager:1
+    devices:
+      - uuid: uuid:4d696e69-444c-164e-9d41-b827eb96c6c3
+        type: urn:schemas-upnp-org:device:Printer:1
+services:
+  - type: urn:schemas-upnp-org:service:Scanner:1
+    usn: uuid:5b1a9c2e-93f4-4b0e-8f3c-0a1b2c3d4e5f::urn:schemas-upnp-org:service:Scanner:1
+    server: Scanner/1.0
+    location: http://192.168.1.10:8080/scanner.xml
+`
+
+var testResolver = minissdpc.ResolverFunc(func() ([]minissdpc.Interface, error) {
+	return []minissdpc.Interface{
+		{Name: "eth0", Flags: net.FlagUp, Addrs: []net.IP{net.ParseIP("192.168.1.10")}},
+	}, nil
+})
+
+func TestRead(t *testing.T) {
+	m, err := Read(strings.NewReader(testManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Validate(testResolver); err != nil {
+		t.Fatal(err)
+	}
+
+	services := m.Expand()
+	// rootdevice, uuid, device type and 2 services,
+	// then uuid and device type of the embedded device,
+	// then the individual service
+	if len(services) != 8 {
+		t.Fatalf("expected 8 services, got %d: %+v", len(services), services)
+	}
+	root := services[0]
+	if root.Type != minissdpc.NTRootDevice || root.USN != "uuid:4d696e69-444c-164e-9d41-b827eb96c6c2::upnp:rootdevice" {
+		t.Fatalf("unexpected root device entry %+v", root)
+	}
+	for _, s := range services[:7] {
+		if s.Server != m.Server || s.Location != m.Location {
+			t.Fatalf("%s did not inherit the defaults: %+v", s.USN, s)
+		}
+	}
+	if services[5].USN != "uuid:4d696e69-444c-164e-9d41-b827eb96c6c3" {
+		t.Fatalf("unexpected embedded device entry %+v", services[5])
+	}
+	if s := services[7]; s.Server != "Scanner/1.0" || s.Location != "http://192.168.1.10:8080/scanner.xml" {
+		t.Fatalf("individual service was changed: %+v", s)
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+	}{
+		{"syntax", "devices: [\n"},
+		{"unknown field", "devices:\n  - uuid: 1234\n    deviceType: urn:x:device:y:1\n"},
+		{"unknown service field", "services:\n  - type: upnp:rootdevice\n    urn: uuid:1234::upnp:rootdevice\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Read(strings.NewReader(test.manifest)); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "manifest.yaml")
+	if err := ioutil.WriteFile(path, []byte(testManifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect, _ := Read(strings.NewReader(testManifest))
+	if !reflect.DeepEqual(m, expect) {
+		t.Fatalf("expected %+v, got %+v", expect, m)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("devices: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFile(path); err == nil || !strings.HasPrefix(err.Error(), path+": ") {
+		t.Fatalf("expected an error naming %s, got %v", path, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	const device = `
+server: Linux/4.14 UPnP/1.0 nas/1.0
+location: http://{iface:eth0}:5000/description.xml
+devices:
+  - uuid: 4d696e69-444c-164e-9d41-b827eb96c6c2
+    type: urn:schemas-upnp-org:device:MediaServer:1
+`
+	tests := []struct {
+		name     string
+		manifest string
+		err      string
+	}{
+		{"no uuid", "devices:\n  - type: urn:x:device:y:1\n", errNoUUID.Error()},
+		{"no type", "devices:\n  - uuid: 1234\n", errNoDeviceType.Error()},
+		{"embedded", "devices:\n  - uuid: 1234\n    type: urn:x:device:y:1\n    devices:\n      - uuid: 5678\n",
+			"devices[0]: devices[0]: " + errNoDeviceType.Error()},
+		{"no server", "location: http://192.168.1.10/\ndevices:\n  - uuid: 1234\n    type: urn:x:device:y:1\n",
+			"invalid server"},
+		{"bad interface", strings.Replace(device, "eth0", "wlan0", 1), "no such interface"},
+		{"duplicate", device + "services:\n  - type: upnp:rootdevice\n    usn: uuid:4d696e69-444c-164e-9d41-b827eb96c6c2::upnp:rootdevice\n",
+			errDuplicate.Error()},
+		{"mismatched usn", device + "services:\n  - type: urn:x:service:y:1\n    usn: uuid:1234::urn:x:service:z:1\n",
+			"does not match"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := Read(strings.NewReader(test.manifest))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = m.Validate(testResolver)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestValidateAllowLoopback(t *testing.T) {
+	m, err := Read(strings.NewReader(`
+server: Linux/4.14 UPnP/1.0 nas/1.0
+location: http://127.0.0.1:5000/description.xml
+devices:
+  - uuid: 4d696e69-444c-164e-9d41-b827eb96c6c2
+    type: urn:schemas-upnp-org:device:MediaServer:1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Validate(testResolver); err == nil || !strings.Contains(err.Error(), "loopback") {
+		t.Fatalf("expected a loopback error, got %v", err)
+	}
+	if err := m.ValidateAllowLoopback(testResolver); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,118 @@
+package minissdpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var errInvalidText = errors.New("invalid service text")
+
+// serviceFields has the same fields and tags as Service but none of
+// its methods, so it can be handed to the json and yaml encoders
+// without them falling back to MarshalText.
+type serviceFields Service
+
+// MarshalJSON encodes the service as a JSON object
+func (s Service) MarshalJSON() ([]byte, error) {
+	return json.Marshal(serviceFields(s))
+}
+
+// UnmarshalJSON decodes a JSON object into the service
+func (s *Service) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, (*serviceFields)(s))
+}
+
+// MarshalYAML encodes the service as a YAML mapping
+func (s Service) MarshalYAML() (interface{}, error) {
+	return serviceFields(s), nil
+}
+
+// UnmarshalYAML decodes a YAML mapping into the service
+func (s *Service) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	return unmarshal((*serviceFields)(s))
+}
+
+// MarshalText encodes the service as a single line of quoted
+// key=value pairs, suitable for log output. e.g.
+//
+//	type="upnp:rootdevice" usn="uuid:1234::upnp:rootdevice" location="http://192.168.1.10/setup.xml"
+//
+// The server field is omitted when empty.
+func (s Service) MarshalText() ([]byte, error) {
+	var b []byte
+	for _, f := range s.textFields() {
+		if f.key == "server" && *f.value == "" {
+			continue
+		}
+		if len(b) > 0 {
+			b = append(b, ' ')
+		}
+		b = append(b, f.key...)
+		b = append(b, '=')
+		b = strconv.AppendQuote(b, *f.value)
+	}
+	return b, nil
+}
+
+// UnmarshalText decodes a line produced by MarshalText into the service
+func (s *Service) UnmarshalText(text []byte) error {
+	var out Service
+	fields := out.textFields()
+
+	rest := string(text)
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		i := strings.IndexByte(rest, '=')
+		if i < 0 {
+			return fmt.Errorf("%v: missing '=' in %q", errInvalidText, rest)
+		}
+		key := rest[:i]
+
+		quoted, err := strconv.QuotedPrefix(rest[i+1:])
+		if err != nil {
+			return fmt.Errorf("%v: bad value for %s: %v", errInvalidText, key, err)
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return fmt.Errorf("%v: bad value for %s: %v", errInvalidText, key, err)
+		}
+		rest = rest[i+1+len(quoted):]
+
+		found := false
+		for _, f := range fields {
+			if f.key == key {
+				*f.value = value
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%v: unknown key %q", errInvalidText, key)
+		}
+	}
+
+	*s = out
+	return nil
+}
+
+// String returns the service in its text form
+func (s Service) String() string {
+	b, _ := s.MarshalText()
+	return string(b)
+}
+
+type textField struct {
+	key   string
+	value *string
+}
+
+func (s *Service) textFields() []textField {
+	return []textField{
+		{"type", &s.Type},
+		{"usn", &s.USN},
+		{"server", &s.Server},
+		{"location", &s.Location},
+	}
+}
@@ -0,0 +1,131 @@
+package minissdpc
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+var marshalService = Service{
+	Type:     "urn:Belkin:device:controllee:1",
+	USN:      "uuid:Socket-1_0-221517K0101769::urn:Belkin:device:controllee:1",
+	Server:   "Unspecified, UPnP/1.0, \"Unspecified\"",
+	Location: "http://192.168.1.10:49153/setup.xml",
+}
+
+func TestServiceJSON(t *testing.T) {
+	expect := `{"type":"urn:Belkin:device:controllee:1",` +
+		`"usn":"uuid:Socket-1_0-221517K0101769::urn:Belkin:device:controllee:1",` +
+		`"server":"Unspecified, UPnP/1.0, \"Unspecified\"",` +
+		`"location":"http://192.168.1.10:49153/setup.xml"}`
+
+	b, err := json.Marshal(marshalService)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != expect {
+		t.Fatalf("expected %s, got %s", expect, b)
+	}
+
+	var out Service
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out != marshalService {
+		t.Fatalf("round trip mismatch: %#v", out)
+	}
+
+	// Slices are encoded as arrays of objects, and the server
+	// is omitted when empty
+	b, err = json.Marshal([]Service{{Type: "upnp:rootdevice"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = `[{"type":"upnp:rootdevice","usn":"","location":""}]`
+	if string(b) != expect {
+		t.Fatalf("expected %s, got %s", expect, b)
+	}
+}
+
+func TestServiceYAML(t *testing.T) {
+	expect := `type: urn:Belkin:device:controllee:1
+usn: uuid:Socket-1_0-221517K0101769::urn:Belkin:device:controllee:1
+server: Unspecified, UPnP/1.0, "Unspecified"
+location: http://192.168.1.10:49153/setup.xml
+`
+
+	b, err := yaml.Marshal(marshalService)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != expect {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expect, b)
+	}
+
+	var single Service
+	if err := yaml.Unmarshal(b, &single); err != nil {
+		t.Fatal(err)
+	}
+	if single != marshalService {
+		t.Fatalf("round trip mismatch: %#v", single)
+	}
+
+	var out []Service
+	in := []Service{marshalService, {Type: "upnp:rootdevice", USN: "uuid:1::upnp:rootdevice"}}
+	b, err = yaml.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Fatalf("round trip mismatch: %#v", out)
+	}
+}
+
+func TestServiceText(t *testing.T) {
+	expect := `type="urn:Belkin:device:controllee:1" ` +
+		`usn="uuid:Socket-1_0-221517K0101769::urn:Belkin:device:controllee:1" ` +
+		`server="Unspecified, UPnP/1.0, \"Unspecified\"" ` +
+		`location="http://192.168.1.10:49153/setup.xml"`
+
+	b, err := marshalService.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != expect {
+		t.Fatalf("expected %s, got %s", expect, b)
+	}
+	if marshalService.String() != expect {
+		t.Fatalf("expected String() to match text form, got %s", marshalService.String())
+	}
+
+	var out Service
+	if err := out.UnmarshalText(b); err != nil {
+		t.Fatal(err)
+	}
+	if out != marshalService {
+		t.Fatalf("round trip mismatch: %#v", out)
+	}
+
+	// An empty server is omitted
+	s := Service{Type: "upnp:rootdevice", USN: "uuid:1::upnp:rootdevice", Location: "http://h/"}
+	expect = `type="upnp:rootdevice" usn="uuid:1::upnp:rootdevice" location="http://h/"`
+	if s.String() != expect {
+		t.Fatalf("expected %s, got %s", expect, s.String())
+	}
+
+	for _, bad := range []string{
+		`type`,
+		`type=unquoted`,
+		`type="unterminated`,
+		`colour="red"`,
+	} {
+		if err := out.UnmarshalText([]byte(bad)); err == nil {
+			t.Errorf("expected error decoding %q", bad)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package minissdpc
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -12,75 +11,116 @@ import (
 // length of 34359738367 (which overflows a 32bit int anyway)
 const MaxLengthBytes = 5
 
-// Request Types as defined by minissdpd
+// MaxStringLength is the largest string that will be decoded from
+// a minissdpd response. Longer lengths are rejected rather than
+// allocating a buffer for them.
+const MaxStringLength = MaxRequestLength * 4
+
+// maxEncodedLength is the first length too large for MaxLengthBytes
+const maxEncodedLength = uint64(1) << (7 * MaxLengthBytes)
+
+// Request Types as defined by minissdpd. Version and Notify
+// were added in minissdpd 1.5.
 const (
+	RequestTypeVersion  byte = 0
 	RequestTypeByType   byte = 1
 	RequestTypeByUSN    byte = 2
 	RequestTypeAll      byte = 3
 	RequestTypeRegister byte = 4
+	RequestTypeNotify   byte = 5
 )
 
 var (
 	errInvalidLength = errors.New("provided length is invalid")
 	errNilWriter     = errors.New("received nil io.Writer")
 	errTooLong       = errors.New("too many bytes read for string length")
+	errNonCanonical  = errors.New("string length has redundant leading bytes")
+	errStringTooLong = fmt.Errorf("string length exceeds %d bytes", MaxStringLength)
 )
 
-func pow(x, y uint) uint {
-	v := uint(1)
-	for i := uint(0); i < y; i++ {
-		v *= x
-	}
-	return v
-}
+const maxInt = int(^uint(0) >> 1)
 
 // EncodeStringLength takes the length of a string as an integer
 // and encodes it as a slice of bytes to the provided Writer.
+// No allocations are made when w is also an io.ByteWriter.
 func EncodeStringLength(length int, w io.Writer) error {
-	if length < 0 {
+	if length < 0 || uint64(length) >= maxEncodedLength {
 		return errInvalidLength
 	}
 	if w == nil {
 		return errNilWriter
 	}
 
-	n := uint(length)
-	b := make([]byte, MaxLengthBytes)
-
-	b[MaxLengthBytes-1] = byte(n & 0x7f)
-	var i uint
-	for i = 1; i < MaxLengthBytes; i++ {
-		if n >= pow(128, i) {
-			b[MaxLengthBytes-1-i] = byte(n>>(7*i) | 0x80)
-		} else {
-			break
+	if bw, ok := w.(io.ByteWriter); ok {
+		var b [MaxLengthBytes]byte
+		for _, c := range appendLength(b[:0], uint64(length)) {
+			if err := bw.WriteByte(c); err != nil {
+				return fmt.Errorf("could not write to buffer: %v", err)
+			}
 		}
+		return nil
 	}
-	i--
 
-	_, err := w.Write(b[MaxLengthBytes-1-i:])
+	_, err := w.Write(appendLength(make([]byte, 0, MaxLengthBytes), uint64(length)))
 	if err != nil {
 		return fmt.Errorf("could not write to buffer: %v", err)
 	}
 	return nil
 }
 
+// AppendStringLength appends the encoded length to dst
+// and returns the extended slice
+func AppendStringLength(dst []byte, length int) ([]byte, error) {
+	if length < 0 || uint64(length) >= maxEncodedLength {
+		return dst, errInvalidLength
+	}
+	return appendLength(dst, uint64(length)), nil
+}
+
+// appendLength encodes n using 7 bits per byte, most significant
+// group first, with the high bit set on all but the final byte.
+// n must be less than maxEncodedLength.
+func appendLength(dst []byte, n uint64) []byte {
+	var shift uint
+	for shift < 7*(MaxLengthBytes-1) && n>>(shift+7) != 0 {
+		shift += 7
+	}
+	for ; shift > 0; shift -= 7 {
+		dst = append(dst, byte(n>>shift)|0x80)
+	}
+	return append(dst, byte(n&0x7f))
+}
+
+// lengthBytes returns the number of bytes appendLength uses for n
+func lengthBytes(n uint64) int {
+	i := 1
+	for i < MaxLengthBytes && n>>(7*uint(i)) != 0 {
+		i++
+	}
+	return i
+}
+
 // DecodeStringLength reads the length bytes from the provided Reader
 // and decodes them into the integer value.
+// Only the shortest encoding of a length is accepted.
 func DecodeStringLength(r io.Reader) (int, error) {
 	length := 0
 	b := make([]byte, 1)
+	var first byte
 
 	for i := 1; ; i++ {
 		if i > MaxLengthBytes {
 			return 0, errTooLong
 		}
-		n, err := r.Read(b)
+		_, err := io.ReadFull(r, b)
 		if err != nil {
 			return 0, fmt.Errorf("could not read buffer: %v", err)
 		}
-		if n != 1 {
-			return 0, fmt.Errorf("expected to read 1 byte, got %d", n)
+		if i == 1 {
+			first = b[0]
+		}
+		if length > maxInt>>7 {
+			return 0, errTooLong
 		}
 
 		length = (length << 7) | int(b[0]&0x7f)
@@ -90,38 +130,58 @@ func DecodeStringLength(r io.Reader) (int, error) {
 		}
 	}
 
+	// A leading 0x80 adds nothing to the value, so the
+	// same length could have been encoded in fewer bytes
+	if first == 0x80 {
+		return 0, errNonCanonical
+	}
+
 	return length, nil
 }
 
 // A Service represents an SSDP service that can be
 // be advertised by minissdpd
 type Service struct {
-	Type     string
-	USN      string
-	Server   string
-	Location string
+	Type     string `json:"type" yaml:"type"`
+	USN      string `json:"usn" yaml:"usn"`
+	Server   string `json:"server,omitempty" yaml:"server,omitempty"`
+	Location string `json:"location" yaml:"location"`
 }
 
 // Encode will encode the service into a slice of bytes
 // that can be written to the minissdpd socket
 func (s *Service) Encode() ([]byte, error) {
-	buf := &bytes.Buffer{}
-	for _, v := range []string{
+	return s.AppendEncode(nil)
+}
+
+// AppendEncode appends the encoded service to dst and returns
+// the extended slice. It does not allocate if dst has enough
+// spare capacity.
+func (s *Service) AppendEncode(dst []byte) ([]byte, error) {
+	var err error
+	for _, v := range [...]string{
 		s.Type,
 		s.USN,
 		s.Server,
 		s.Location,
 	} {
-		err := EncodeStringLength(len(v), buf)
+		dst, err = AppendStringLength(dst, len(v))
 		if err != nil {
-			return nil, fmt.Errorf("could not encode length of %q: %v", v, err)
-		}
-		_, err = buf.WriteString(v)
-		if err != nil {
-			return nil, fmt.Errorf("could not write string to buffer: %v", err)
+			return dst, fmt.Errorf("could not encode length of %q: %v", v, err)
 		}
+		dst = append(dst, v...)
+	}
+	return dst, nil
+}
+
+// encodedLen returns the number of bytes that AppendEncode appends,
+// without encoding the service
+func (s *Service) encodedLen() int {
+	n := 0
+	for _, v := range [...]string{s.Type, s.USN, s.Server, s.Location} {
+		n += lengthBytes(uint64(len(v))) + len(v)
 	}
-	return buf.Bytes(), nil
+	return n
 }
 
 // EncodeTo will encode and write the service as bytes, in
@@ -135,10 +195,12 @@ func (s *Service) EncodeTo(w io.Writer) (int, error) {
 	return w.Write(b)
 }
 
-func decodeServices(r io.Reader) ([]Service, error) {
+// DecodeServices reads the response to a query: the number of
+// services, then the Location, Type and USN of each one
+func DecodeServices(r io.Reader) ([]Service, error) {
 	// The first byte is the number of services in the response
 	buf := make([]byte, 1)
-	_, err := r.Read(buf)
+	_, err := io.ReadFull(r, buf)
 	if err != nil {
 		return nil, fmt.Errorf("could not read count from start of response: %v", err)
 	}
@@ -146,25 +208,43 @@ func decodeServices(r io.Reader) ([]Service, error) {
 
 	services := make([]Service, count)
 	for i := 0; i < count; i++ {
-		var service Service
-		for _, s := range []*string{&service.Location, &service.Type, &service.USN} {
-			length, err := DecodeStringLength(r)
-			if err != nil {
-				return services, fmt.Errorf("error decoding string length: %v", err)
-			}
-
-			buf := make([]byte, length)
-			n, err := r.Read(buf)
-			if err != nil {
-				return services, fmt.Errorf("error reading string: %v", err)
-			}
-			if n != length {
-				return services, fmt.Errorf("expected to read %d bytes, got %d", length, n)
-			}
-			*s = string(buf)
+		service, err := decodeService(r)
+		if err != nil {
+			return services, err
 		}
 		services[i] = service
 	}
 
 	return services, nil
 }
+
+// decodeService reads the Location, Type and USN of a
+// service, in the order minissdpd sends them
+func decodeService(r io.Reader) (Service, error) {
+	var service Service
+	for _, s := range []*string{&service.Location, &service.Type, &service.USN} {
+		var err error
+		if *s, err = DecodeString(r); err != nil {
+			return service, err
+		}
+	}
+	return service, nil
+}
+
+// DecodeString reads a string prefixed with its encoded length
+func DecodeString(r io.Reader) (string, error) {
+	length, err := DecodeStringLength(r)
+	if err != nil {
+		return "", fmt.Errorf("error decoding string length: %v", err)
+	}
+	if length > MaxStringLength {
+		return "", errStringTooLong
+	}
+
+	buf := make([]byte, length)
+	n, err := io.ReadFull(r, buf)
+	if err != nil {
+		return "", fmt.Errorf("error reading string: expected %d bytes, got %d: %v", length, n, err)
+	}
+	return string(buf), nil
+}
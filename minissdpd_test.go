@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -36,6 +37,17 @@ func TestEncodeDecode(t *testing.T) {
 			if !reflect.DeepEqual(out, test.encoded) {
 				t.Errorf("encode expected %#v, got %#v", test.encoded, out)
 			}
+
+			appended, err := AppendStringLength([]byte{0xff}, test.length)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(appended[1:], test.encoded) || appended[0] != 0xff {
+				t.Errorf("append expected %#v, got %#v", test.encoded, appended[1:])
+			}
+			if n := lengthBytes(uint64(test.length)); n != len(test.encoded) {
+				t.Errorf("lengthBytes expected %d, got %d", len(test.encoded), n)
+			}
 		})
 
 		t.Run(fmt.Sprintf("Decode %d", test.length), func(t *testing.T) {
@@ -80,6 +92,47 @@ func TestTooManyLengthBytes(t *testing.T) {
 	}
 }
 
+func TestNonCanonicalLength(t *testing.T) {
+	for _, encoded := range [][]byte{
+		{0x80, 0x00},
+		{0x80, 0x81, 0x00},
+	} {
+		_, err := DecodeStringLength(bytes.NewReader(encoded))
+		if err != errNonCanonical {
+			t.Errorf("expected errNonCanonical for %#v, got: %v", encoded, err)
+		}
+	}
+}
+
+func TestLengthTooLarge(t *testing.T) {
+	if strconv.IntSize == 32 {
+		t.Skip("lengths too large to encode do not fit in a 32-bit int")
+	}
+	// A variable, as converting the constant does not compile on 32-bit
+	tooLarge := maxEncodedLength
+
+	err := EncodeStringLength(int(tooLarge), &bytes.Buffer{})
+	if err != errInvalidLength {
+		t.Fatalf("expected errInvalidLength, got: %v", err)
+	}
+	_, err = AppendStringLength(nil, int(tooLarge))
+	if err != errInvalidLength {
+		t.Fatalf("expected errInvalidLength from append, got: %v", err)
+	}
+}
+
+func TestDecodeServicesTooLong(t *testing.T) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte(1)
+	if err := EncodeStringLength(MaxStringLength+1, buf); err != nil {
+		t.Fatal(err)
+	}
+	_, err := DecodeServices(buf)
+	if err != errStringTooLong {
+		t.Fatalf("expected errStringTooLong, got: %v", err)
+	}
+}
+
 func TestServiceEncode(t *testing.T) {
 	s := Service{
 		Type:     "dummytype",
@@ -111,6 +164,9 @@ func TestServiceEncode(t *testing.T) {
 	if b != len(expect) {
 		t.Fatalf("expected %d bytes, got %d", len(expect), b)
 	}
+	if n := s.encodedLen(); n != len(expect) {
+		t.Fatalf("expected encodedLen of %d, got %d", len(expect), n)
+	}
 
 	out := buf.Bytes()
 	if !reflect.DeepEqual(out, expect) {
@@ -122,7 +178,7 @@ func TestServiceEncode(t *testing.T) {
 
 func TestDecodeServices(t *testing.T) {
 	buf := bytes.NewReader([]byte{0})
-	out, err := decodeServices(buf)
+	out, err := DecodeServices(buf)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -144,7 +200,7 @@ func TestDecodeServices(t *testing.T) {
 	}
 
 	buf = bytes.NewReader(stream)
-	out, err = decodeServices(buf)
+	out, err = DecodeServices(buf)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -156,6 +212,102 @@ func TestDecodeServices(t *testing.T) {
 	}
 }
 
+func FuzzEncodeDecode(f *testing.F) {
+	seeds := []int{0, 1, 127, 128, 16383, 16384, 268435456}
+	if strconv.IntSize == 64 {
+		largest := maxEncodedLength - 1
+		seeds = append(seeds, int(largest))
+	}
+	for _, n := range seeds {
+		f.Add(n)
+	}
+
+	f.Fuzz(func(t *testing.T, length int) {
+		buf := &bytes.Buffer{}
+		err := EncodeStringLength(length, buf)
+		if length < 0 || uint64(length) >= maxEncodedLength {
+			if err != errInvalidLength {
+				t.Fatalf("expected errInvalidLength for %d, got: %v", length, err)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() > MaxLengthBytes {
+			t.Fatalf("%d encoded to %d bytes", length, buf.Len())
+		}
+
+		n, err := DecodeStringLength(buf)
+		if err != nil {
+			t.Fatalf("could not decode %d: %v", length, err)
+		}
+		if n != length {
+			t.Fatalf("round trip of %d returned %d", length, n)
+		}
+		if buf.Len() != 0 {
+			t.Fatalf("%d bytes left unread after decode", buf.Len())
+		}
+	})
+}
+
+func FuzzDecodeStringLength(f *testing.F) {
+	f.Add([]byte{0})
+	f.Add([]byte{129, 0})
+	f.Add([]byte{129, 128, 128, 128, 0})
+	f.Add([]byte{0x80, 0x00})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0x7f})
+
+	f.Fuzz(func(t *testing.T, encoded []byte) {
+		r := bytes.NewReader(encoded)
+		n, err := DecodeStringLength(r)
+		if err != nil {
+			return
+		}
+		if n < 0 {
+			t.Fatalf("decoded negative length %d", n)
+		}
+
+		// Only canonical encodings are accepted, so re-encoding
+		// must reproduce exactly the bytes that were consumed
+		consumed := encoded[:len(encoded)-r.Len()]
+		buf := &bytes.Buffer{}
+		if err := EncodeStringLength(n, buf); err != nil {
+			t.Fatalf("could not re-encode %d: %v", n, err)
+		}
+		if !bytes.Equal(buf.Bytes(), consumed) {
+			t.Fatalf("%#v decoded to %d, which encodes as %#v", consumed, n, buf.Bytes())
+		}
+	})
+}
+
+func FuzzDecodeServices(f *testing.F) {
+	f.Add([]byte{0})
+	f.Add([]byte{1, 1, 'a', 1, 'b', 1, 'c'})
+	f.Add([]byte{2, 1, 'a', 1, 'b', 1, 'c'})
+	f.Add([]byte{1, 0xff, 0xff, 0xff, 0xff, 0x7f})
+
+	f.Fuzz(func(t *testing.T, stream []byte) {
+		services, err := DecodeServices(bytes.NewReader(stream))
+		if err != nil {
+			return
+		}
+		if len(services) != int(stream[0]) {
+			t.Fatalf("expected %d services, decoded %d", stream[0], len(services))
+		}
+
+		// Every decoded string was read from the stream, so the
+		// total can never exceed its length
+		total := 0
+		for _, s := range services {
+			total += len(s.Type) + len(s.USN) + len(s.Location)
+		}
+		if total > len(stream) {
+			t.Fatalf("decoded %d bytes of strings from a %d byte stream", total, len(stream))
+		}
+	})
+}
+
 func BenchmarkEncodeShort(b *testing.B) {
 	bb := make([]byte, 1)
 	buf := bytes.NewBuffer(bb)
@@ -179,3 +331,22 @@ func BenchmarkEncodeLong(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkServiceAppendEncode(b *testing.B) {
+	s := Service{
+		Type:     "urn:Belkin:device:controllee:1",
+		USN:      "uuid:Socket-1_0-221517K0101769::urn:Belkin:device:controllee:1",
+		Server:   "Unspecified, UPnP/1.0, Unspecified",
+		Location: "http://192.168.1.10:49153/setup.xml",
+	}
+	buf := make([]byte, 0, 256)
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		var err error
+		buf, err = s.AppendEncode(buf[:0])
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
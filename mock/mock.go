@@ -0,0 +1,36 @@
+// Package mock implements the server side of the minissdpd protocol,
+// so that clients can be developed and tested on hosts without
+// minissdpd. A Server answers queries from an in-memory table of
+// services, without advertising them on the network.
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/forfuncsake/minissdpc"
+	"gopkg.in/yaml.v2"
+)
+
+// LoadFixture reads a list of services from a JSON or YAML file,
+// chosen by its extension. Unknown fields are ignored, so the output
+// of "minissdpc ls -o json" or "-o yaml" can be used as a fixture.
+func LoadFixture(path string) ([]minissdpc.Service, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read fixture: %v", err)
+	}
+
+	var services []minissdpc.Service
+	if filepath.Ext(path) == ".json" {
+		err = json.Unmarshal(b, &services)
+	} else {
+		err = yaml.Unmarshal(b, &services)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse fixture %s: %v", path, err)
+	}
+	return services, nil
+}
@@ -0,0 +1,71 @@
+package mock
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/forfuncsake/minissdpc"
+)
+
+func testServices() []minissdpc.Service {
+	return []minissdpc.Service{
+		{
+			Type:     "urn:Belkin:device:controllee:1",
+			USN:      "uuid:Socket-1_0-221517K0101769::urn:Belkin:device:controllee:1",
+			Server:   "Unspecified, UPnP/1.0, Unspecified",
+			Location: "http://192.168.1.10:49153/setup.xml",
+		},
+		{
+			Type:     "urn:Belkin:service:basicevent:1",
+			USN:      "uuid:Socket-1_0-221517K0101769::urn:Belkin:service:basicevent:1",
+			Server:   "Unspecified, UPnP/1.0, Unspecified",
+			Location: "http://192.168.1.10:49153/setup.xml",
+		},
+		{
+			Type:     "upnp:rootdevice",
+			USN:      "uuid:2f402f80-da50-11e1-9b23-001788102201::upnp:rootdevice",
+			Server:   "Linux/3.14.0 UPnP/1.0 IpBridge/1.24.0",
+			Location: "http://192.168.1.20:80/description.xml",
+		},
+	}
+}
+
+func TestLoadFixture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssdpc-mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Fields other than those of a service are ignored
+	files := map[string]string{
+		"services.json": `[{"type": "upnp:rootdevice", "usn": "uuid:1234::upnp:rootdevice",
+			"location": "http://192.168.1.10/", "ours": true}]`,
+		"services.yaml": "- type: upnp:rootdevice\n  usn: uuid:1234::upnp:rootdevice\n  location: http://192.168.1.10/\n  ours: true\n",
+	}
+	expect := []minissdpc.Service{
+		{Type: "upnp:rootdevice", USN: "uuid:1234::upnp:rootdevice", Location: "http://192.168.1.10/"},
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		services, err := LoadFixture(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(services, expect) {
+			t.Fatalf("%s: expected %v, got %v", name, expect, services)
+		}
+	}
+
+	path := filepath.Join(dir, "invalid.json")
+	ioutil.WriteFile(path, []byte("{"), 0644)
+	if _, err := LoadFixture(path); err == nil {
+		t.Fatal("expected an error for invalid JSON")
+	}
+}
@@ -0,0 +1,311 @@
+package mock
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/forfuncsake/minissdpc"
+)
+
+// DefaultVersion is the minissdpd version reported by a Server
+const DefaultVersion = "1.5"
+
+const (
+	// notifyQueue is the number of notifications queued for a
+	// subscriber, which is disconnected if it falls further behind
+	notifyQueue = 64
+
+	// writeTimeout bounds the write of a notification
+	writeTimeout = 5 * time.Second
+)
+
+var (
+	errInUse          = errors.New("socket is in use by a running daemon")
+	errEmptyRequest   = errors.New("empty request")
+	errUnknownRequest = errors.New("unknown request type")
+)
+
+// A Server answers minissdpd requests from its table of services.
+// Registered services replace any with the same USN and type, as
+// they do in minissdpd, and are sent to subscribed clients.
+// It must be created with NewServer.
+type Server struct {
+	// Version is reported to version requests. If it is empty, the
+	// server behaves as minissdpd before 1.5, which answers version
+	// and notify requests with an empty response, and closes the
+	// connection if they are empty. It must not be changed while
+	// the server is serving.
+	Version string
+
+	// CloseUnknown, when Version is empty, makes the server close
+	// the connection on version and notify requests rather than
+	// answer them, as some daemons do with request types they do
+	// not know. It must not be changed while the server is serving.
+	CloseUnknown bool
+
+	// Log, if set, is called with each request received
+	Log func(minissdpc.Request)
+
+	mu          sync.Mutex
+	services    []minissdpc.Service
+	listeners   []net.Listener
+	conns       map[net.Conn]bool
+	subscribers map[net.Conn]chan []byte
+}
+
+// NewServer returns a Server whose table holds services
+func NewServer(services ...minissdpc.Service) *Server {
+	s := &Server{
+		Version:     DefaultVersion,
+		conns:       make(map[net.Conn]bool),
+		subscribers: make(map[net.Conn]chan []byte),
+	}
+	for _, svc := range services {
+		s.Register(svc)
+	}
+	return s
+}
+
+// Services returns the services in the table
+func (s *Server) Services() []minissdpc.Service {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]minissdpc.Service(nil), s.services...)
+}
+
+// Register adds svc to the table, replacing any service
+// with the same USN and type
+func (s *Server) Register(svc minissdpc.Service) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, old := range s.services {
+		if old.USN == svc.USN && old.Type == svc.Type {
+			s.services[i] = svc
+			s.notify(minissdpc.NotifyUpdate, svc)
+			return
+		}
+	}
+	s.services = append(s.services, svc)
+	s.notify(minissdpc.NotifyNew, svc)
+}
+
+// Remove drops the service with the USN and type of svc from the
+// table, as minissdpd does when an advertisement expires. It reports
+// whether the service was found.
+func (s *Server) Remove(svc minissdpc.Service) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, old := range s.services {
+		if old.USN == svc.USN && old.Type == svc.Type {
+			s.services = append(s.services[:i], s.services[i+1:]...)
+			s.notify(minissdpc.NotifyRemove, old)
+			return true
+		}
+	}
+	return false
+}
+
+// ListenAndServe listens on the unix socket at path and serves
+// requests until Close is called. A socket left behind by a daemon
+// that is no longer running is replaced.
+func (s *Server) ListenAndServe(path string) error {
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return errInUse
+		}
+		os.Remove(path)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l and serves requests until Close
+// is called, when it returns nil
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.conns == nil {
+		s.mu.Unlock()
+		l.Close()
+		return nil
+	}
+	s.listeners = append(s.listeners, l)
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.conns == nil
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.conns == nil {
+			s.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.conns[conn] = true
+		s.mu.Unlock()
+		go s.serve(conn)
+	}
+}
+
+// Close stops the server, closing its listeners and connections
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for _, l := range s.listeners {
+		if cerr := l.Close(); err == nil {
+			err = cerr
+		}
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	for conn := range s.subscribers {
+		s.unsubscribe(conn)
+	}
+	s.listeners = nil
+	s.conns = nil
+	s.subscribers = nil
+	return err
+}
+
+// serve answers requests on conn until it is closed
+func (s *Server) serve(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.unsubscribe(conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		req, err := minissdpc.ReadRequest(r)
+		if err != nil {
+			return
+		}
+		if s.Log != nil {
+			s.Log(req)
+		}
+		if err := s.answer(conn, req); err != nil {
+			return
+		}
+	}
+}
+
+// answer writes the response to req, if it has one
+func (s *Server) answer(conn net.Conn, req minissdpc.Request) error {
+	version := s.Version
+	if version == "" && s.CloseUnknown &&
+		(req.Type == minissdpc.RequestTypeVersion || req.Type == minissdpc.RequestTypeNotify) {
+		return errUnknownRequest
+	}
+
+	// minissdpd closes the connection on an empty request, other than
+	// for all services or, from 1.5, for its version or notifications
+	empty := req.Filter == ""
+	if req.Type == minissdpc.RequestTypeRegister {
+		empty = req.Service.Type == ""
+	}
+	if empty && req.Type != minissdpc.RequestTypeAll && (version == "" ||
+		req.Type != minissdpc.RequestTypeVersion && req.Type != minissdpc.RequestTypeNotify) {
+		return errEmptyRequest
+	}
+
+	switch req.Type {
+	case minissdpc.RequestTypeVersion:
+		b, _ := minissdpc.AppendStringLength(nil, len(version))
+		_, err := conn.Write(append(b, version...))
+		return err
+
+	case minissdpc.RequestTypeNotify:
+		if version == "" {
+			_, err := conn.Write([]byte{0})
+			return err
+		}
+		s.mu.Lock()
+		if s.subscribers != nil && s.subscribers[conn] == nil {
+			q := make(chan []byte, notifyQueue)
+			s.subscribers[conn] = q
+			go send(conn, q)
+		}
+		s.mu.Unlock()
+		return nil
+
+	case minissdpc.RequestTypeRegister:
+		s.Register(req.Service)
+		return nil
+	}
+
+	var found []minissdpc.Service
+	for _, svc := range s.Services() {
+		switch {
+		case req.Type == minissdpc.RequestTypeAll,
+			req.Type == minissdpc.RequestTypeByType && strings.HasPrefix(svc.Type, req.Filter),
+			req.Type == minissdpc.RequestTypeByUSN && strings.HasPrefix(svc.USN, req.Filter):
+			found = append(found, svc)
+		}
+	}
+	if len(found) > 255 {
+		found = found[:255]
+	}
+	return minissdpc.WriteServices(conn, found)
+}
+
+// notify queues a notification for each subscriber, disconnecting
+// those whose queue is full. It must be called with s.mu held.
+func (s *Server) notify(typ minissdpc.NotificationType, svc minissdpc.Service) {
+	n := minissdpc.Notification{Type: typ, Service: svc}
+	msg, err := n.AppendEncode(nil)
+	if err != nil {
+		return
+	}
+	for conn, q := range s.subscribers {
+		select {
+		case q <- msg:
+		default:
+			s.unsubscribe(conn)
+			conn.Close()
+		}
+	}
+}
+
+// unsubscribe stops the notifications of conn, if it is subscribed.
+// It must be called with s.mu held.
+func (s *Server) unsubscribe(conn net.Conn) {
+	if q, ok := s.subscribers[conn]; ok {
+		delete(s.subscribers, conn)
+		close(q)
+	}
+}
+
+// send writes the notifications queued in q to conn, without
+// holding the server, and closes conn if a write fails
+func send(conn net.Conn, q <-chan []byte) {
+	for msg := range q {
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := conn.Write(msg); err != nil {
+			conn.Close()
+			return
+		}
+	}
+}
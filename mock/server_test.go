@@ -0,0 +1,253 @@
+package mock
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forfuncsake/minissdpc"
+)
+
+// startServer serves s on a temporary socket
+func startServer(t *testing.T, s *Server) (string, func()) {
+	dir, err := ioutil.TempDir("", "ssdpc-mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "minissdpd.sock")
+	done := make(chan error, 1)
+	go func() {
+		done <- s.ListenAndServe(path)
+	}()
+	for i := 0; i < 1000; i++ {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return path, func() {
+		s.Close()
+		if err := <-done; err != nil {
+			t.Errorf("unexpected serve error: %v", err)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestServer(t *testing.T) {
+	services := testServices()
+	s := NewServer(services[:2]...)
+	var mu sync.Mutex
+	var logged []string
+	s.Log = func(r minissdpc.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		logged = append(logged, r.Name())
+	}
+	path, stop := startServer(t, s)
+	defer stop()
+
+	c := &minissdpc.Client{SocketPath: path}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.RegisterService(services[2]); err != nil {
+		t.Fatal(err)
+	}
+	all, err := c.GetServicesAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("expected 3 services, got %v", all)
+	}
+	// Responses do not hold the server
+	if all[2].Location != services[2].Location || all[2].USN != services[2].USN {
+		t.Fatalf("unexpected service %v", all[2])
+	}
+
+	found, err := c.GetServicesByType("urn:Belkin:")
+	if err != nil || len(found) != 2 {
+		t.Fatalf("expected 2 services by type prefix, got %v, %v", found, err)
+	}
+	found, err = c.GetServicesByUSN("uuid:2f402f80")
+	if err != nil || len(found) != 1 || found[0].USN != services[2].USN {
+		t.Fatalf("expected 1 service by USN prefix, got %v, %v", found, err)
+	}
+
+	v, err := c.Version()
+	if err != nil || v != DefaultVersion {
+		t.Fatalf("expected version %s, got %q, %v", DefaultVersion, v, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expect := []string{"register", "all", "by-type", "by-usn", "version"}
+	if !reflect.DeepEqual(logged, expect) {
+		t.Fatalf("expected requests %v, got %v", expect, logged)
+	}
+}
+
+func TestServerNotify(t *testing.T) {
+	services := testServices()
+	s := NewServer(services[0])
+	path, stop := startServer(t, s)
+	defer stop()
+
+	c := &minissdpc.Client{SocketPath: path}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Subscribe(); err != nil {
+		t.Fatal(err)
+	}
+	// Wait for the subscription, which is not acknowledged
+	for i := 0; i < 1000; i++ {
+		s.mu.Lock()
+		n := len(s.subscribers)
+		s.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	moved := services[0]
+	moved.Location = "http://192.168.1.11:49153/setup.xml"
+	s.Register(services[1])
+	s.Register(moved)
+	s.Remove(services[1])
+
+	expect := []minissdpc.NotificationType{minissdpc.NotifyNew, minissdpc.NotifyUpdate, minissdpc.NotifyRemove}
+	for _, typ := range expect {
+		n, err := c.ReadNotification()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.Type != typ {
+			t.Fatalf("expected %s notification, got %s", typ, n.Type)
+		}
+	}
+	if s.Remove(services[1]) {
+		t.Fatal("removed a service that is not in the table")
+	}
+}
+
+func TestServerOldVersion(t *testing.T) {
+	s := NewServer()
+	s.Version = ""
+	path, stop := startServer(t, s)
+	defer stop()
+
+	c := &minissdpc.Client{SocketPath: path}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Subscribe(); err == nil {
+		t.Fatal("expected subscribing to fail")
+	}
+}
+
+func TestServerEmptyRequest(t *testing.T) {
+	for _, tc := range []struct {
+		version      string
+		closeUnknown bool
+		req          []byte
+		closed       bool
+	}{
+		{DefaultVersion, false, []byte{minissdpc.RequestTypeAll, 0}, false},
+		{DefaultVersion, false, []byte{minissdpc.RequestTypeVersion, 0}, false},
+		{DefaultVersion, false, []byte{minissdpc.RequestTypeByType, 0}, true},
+		{"", false, []byte{minissdpc.RequestTypeVersion, 0}, true},
+		{"", false, []byte{minissdpc.RequestTypeVersion, 1, 0}, false},
+		{"", true, []byte{minissdpc.RequestTypeVersion, 1, 0}, true},
+		{"", true, []byte{minissdpc.RequestTypeNotify, 1, 0}, true},
+		{"", true, []byte{minissdpc.RequestTypeByType, 1, 'u'}, false},
+		{DefaultVersion, true, []byte{minissdpc.RequestTypeVersion, 1, 0}, false},
+	} {
+		s := NewServer()
+		s.Version = tc.version
+		s.CloseUnknown = tc.closeUnknown
+		path, stop := startServer(t, s)
+
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Write(tc.req); err != nil {
+			t.Fatal(err)
+		}
+		_, err = conn.Read(make([]byte, 16))
+		if closed := err == io.EOF; closed != tc.closed {
+			t.Errorf("version %q, close unknown %v, request %v: expected closed %v, got %v",
+				tc.version, tc.closeUnknown, tc.req, tc.closed, err)
+		}
+		conn.Close()
+		stop()
+	}
+}
+
+func TestServerSlowSubscriber(t *testing.T) {
+	s := NewServer()
+	path, stop := startServer(t, s)
+	defer stop()
+
+	// A subscriber that never reads
+	c := &minissdpc.Client{SocketPath: path}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Subscribe(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		s.mu.Lock()
+		n := len(s.subscribers)
+		s.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Enough notifications to fill the socket buffer do not
+	// block registration
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		svc := testServices()[0]
+		svc.Location += "?" + strings.Repeat("x", 1000)
+		for i := 0; i < 2000; i++ {
+			svc.Server = fmt.Sprint(i)
+			s.Register(svc)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("registration blocked on a subscriber")
+	}
+}
+
+func TestServerInUse(t *testing.T) {
+	path, stop := startServer(t, NewServer())
+	defer stop()
+
+	if err := NewServer().ListenAndServe(path); err != errInUse {
+		t.Fatalf("expected errInUse, got %v", err)
+	}
+}
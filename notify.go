@@ -0,0 +1,167 @@
+package minissdpc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// notificationMarker is the first byte of every notification
+const notificationMarker = 0xff
+
+var (
+	errNotSupported    = errors.New("minissdpd does not support notifications")
+	errNotSubscribed   = errors.New("client has not subscribed to notifications")
+	errNotNotification = errors.New("message is not a notification")
+)
+
+// NotificationType identifies the change reported by a Notification
+type NotificationType byte
+
+// Notification types as defined by minissdpd
+const (
+	NotifyNew    NotificationType = 1
+	NotifyUpdate NotificationType = 2
+	NotifyRemove NotificationType = 3
+)
+
+func (t NotificationType) String() string {
+	switch t {
+	case NotifyNew:
+		return "new"
+	case NotifyUpdate:
+		return "update"
+	case NotifyRemove:
+		return "remove"
+	}
+	return fmt.Sprintf("NotificationType(%d)", byte(t))
+}
+
+// A Notification reports a change to the services known to minissdpd
+type Notification struct {
+	Type    NotificationType
+	Service Service
+}
+
+// versionTimeout bounds the wait for the answer to a version
+// request, which minissdpd before 1.5 may never send
+const versionTimeout = 2 * time.Second
+
+// Version queries the version of the minissdpd server. Versions
+// before 1.5 do not know the request, and an empty version is
+// returned for them. Some of them drop the connection rather than
+// answer: it is then closed, and Connect must be called before the
+// client is used again.
+func (c *Client) Version() (string, error) {
+	// minissdpd before 1.5 closes the connection on an empty request
+	// of a type it does not know, so a filter is sent, which is
+	// ignored by later versions
+	_, err := c.Write([]byte{RequestTypeVersion, 1, 0})
+	if err != nil {
+		return "", fmt.Errorf("could not send request: %v", err)
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(versionTimeout))
+	// The connection is closed on EOF or timeout, so only a
+	// connection still open has its deadline cleared
+	defer func() {
+		if c.conn != nil {
+			c.conn.SetReadDeadline(time.Time{})
+		}
+	}()
+	var first [1]byte
+	_, err = io.ReadFull(c.conn, first[:])
+	if err == io.EOF || isTimeout(err) {
+		c.Close()
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not read version: %v", err)
+	}
+
+	// Older versions answer unknown requests with a single 0,
+	// which reads as an empty string
+	v, err := DecodeString(io.MultiReader(bytes.NewReader(first[:]), c.conn))
+	if err != nil {
+		return "", fmt.Errorf("could not read version: %v", err)
+	}
+	return v, nil
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+// Subscribe asks minissdpd to send a Notification on the client's
+// connection whenever a service is added, updated or removed. The
+// connection should then only be used to call ReadNotification.
+// An error is returned if the server does not support notifications,
+// and the connection may then have been closed, as by Version.
+func (c *Client) Subscribe() error {
+	_, err := c.subscribe()
+	return err
+}
+
+// subscribe is Subscribe, also returning the version of the server
+func (c *Client) subscribe() (string, error) {
+	v, err := c.Version()
+	if err != nil {
+		return "", err
+	}
+	if v == "" {
+		return "", errNotSupported
+	}
+
+	_, err = c.Write([]byte{RequestTypeNotify, 0})
+	if err != nil {
+		return "", fmt.Errorf("could not send request: %v", err)
+	}
+	c.subscribed = true
+	return v, nil
+}
+
+// ReadNotification blocks until minissdpd sends a notification.
+// Subscribe must have been called first.
+func (c *Client) ReadNotification() (Notification, error) {
+	if c.conn == nil {
+		return Notification{}, errNilConn
+	}
+	if !c.subscribed {
+		return Notification{}, errNotSubscribed
+	}
+
+	return DecodeNotification(c.conn)
+}
+
+// DecodeNotification reads a notification: a marker byte, the
+// notification type, a reserved byte, then the Location, Type
+// and USN of the service
+func DecodeNotification(r io.Reader) (Notification, error) {
+	var n Notification
+	var head [3]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return n, fmt.Errorf("could not read notification: %v", err)
+	}
+	if head[0] != notificationMarker {
+		return n, errNotNotification
+	}
+	n.Type = NotificationType(head[1])
+
+	// head[2] is reserved
+	s, err := decodeService(r)
+	if err != nil {
+		return n, err
+	}
+	n.Service = s
+	return n, nil
+}
+
+// AppendEncode appends the notification, as minissdpd sends it,
+// to dst and returns the extended slice
+func (n *Notification) AppendEncode(dst []byte) ([]byte, error) {
+	return appendResponse(append(dst, notificationMarker, byte(n.Type), 0), n.Service)
+}
@@ -0,0 +1,440 @@
+// Package proxy relays connections between minissdpd clients and
+// the daemon, decoding every request and response on the way so
+// that the conversation can be logged or recorded.
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/forfuncsake/minissdpc"
+)
+
+// Senders of a Message
+const (
+	FromClient = "client"
+	FromDaemon = "daemon"
+)
+
+// Kinds of Message that are not requests, whose Kind is the
+// request's name, such as "by-type" or "register"
+const (
+	KindOpen         = "open"
+	KindClose        = "close"
+	KindServices     = "services"
+	KindVersion      = "version"
+	KindNotification = "notification"
+	KindRaw          = "raw"
+)
+
+// rawBufferSize is the most data logged in a single raw Message
+const rawBufferSize = 4096
+
+var errInUse = errors.New("socket is in use by a running daemon")
+
+// A Message is a single message seen by the proxy, or the opening
+// or closing of a session. Once a message cannot be decoded, the
+// rest of its session is relayed without decoding, as raw messages.
+type Message struct {
+	Time time.Time `json:"time"`
+
+	// Session numbers the client connections, from 1
+	Session int `json:"session"`
+
+	// From is FromClient or FromDaemon
+	From string `json:"from"`
+
+	Kind string `json:"kind"`
+
+	// Filter is the filter of a request
+	Filter string `json:"filter,omitempty"`
+
+	// Services holds the service of a register request or
+	// notification, or those of a response to a query
+	Services []minissdpc.Service `json:"services,omitempty"`
+
+	// Version is the version reported by the daemon
+	Version string `json:"version,omitempty"`
+
+	// Notification is the type of a notification
+	Notification string `json:"notification,omitempty"`
+
+	// Err describes why a session was closed or could not be decoded
+	Err string `json:"error,omitempty"`
+
+	// Data holds the bytes of the message as they were sent
+	Data []byte `json:"data,omitempty"`
+}
+
+// String formats the message for humans, on one line per service
+func (m Message) String() string {
+	arrow := ">"
+	if m.From == FromDaemon {
+		arrow = "<"
+	}
+	s := fmt.Sprintf("%s #%d %s %s %s", m.Time.Format("15:04:05.000"), m.Session, m.From, arrow, m.Kind)
+
+	switch m.Kind {
+	case "by-type", "by-usn":
+		s += fmt.Sprintf(" filter=%q", m.Filter)
+	case KindServices:
+		s += fmt.Sprintf(" count=%d", len(m.Services))
+	case KindVersion:
+		s += fmt.Sprintf(" %q", m.Version)
+	case KindNotification:
+		s += " " + m.Notification
+	case KindRaw:
+		s += fmt.Sprintf(" %d bytes: % x", len(m.Data), m.Data)
+	}
+	if m.Err != "" {
+		s += ": " + m.Err
+	}
+	for _, svc := range m.Services {
+		s += "\n    " + svc.String()
+	}
+	return s
+}
+
+// A Proxy accepts connections from clients, and relays each one
+// to its own connection to the daemon. It must be created with New.
+type Proxy struct {
+	// Upstream is the path of the daemon's socket
+	Upstream string
+
+	// Log, if set, is called with each message in the order the
+	// messages were seen. Calls are never made concurrently.
+	Log func(Message)
+
+	logMu sync.Mutex
+
+	mu        sync.Mutex
+	listeners []net.Listener
+	conns     map[net.Conn]bool
+	sessions  int
+}
+
+// New returns a Proxy relaying connections to the daemon
+// listening on upstream
+func New(upstream string) *Proxy {
+	return &Proxy{
+		Upstream: upstream,
+		conns:    make(map[net.Conn]bool),
+	}
+}
+
+// ListenAndServe listens on the unix socket at path and relays
+// connections until Close is called. A socket left behind by a
+// daemon that is no longer running is replaced.
+func (p *Proxy) ListenAndServe(path string) error {
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return errInUse
+		}
+		os.Remove(path)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	return p.Serve(l)
+}
+
+// Serve accepts connections on l and relays them until Close
+// is called, when it returns nil
+func (p *Proxy) Serve(l net.Listener) error {
+	p.mu.Lock()
+	if p.conns == nil {
+		p.mu.Unlock()
+		l.Close()
+		return nil
+	}
+	p.listeners = append(p.listeners, l)
+	p.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			p.mu.Lock()
+			closed := p.conns == nil
+			p.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		p.mu.Lock()
+		if p.conns == nil {
+			p.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		p.conns[conn] = true
+		p.sessions++
+		id := p.sessions
+		p.mu.Unlock()
+		go p.relay(id, conn)
+	}
+}
+
+// Close stops the proxy, closing its listeners and connections
+func (p *Proxy) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var err error
+	for _, l := range p.listeners {
+		if cerr := l.Close(); err == nil {
+			err = cerr
+		}
+	}
+	for conn := range p.conns {
+		conn.Close()
+	}
+	p.listeners = nil
+	p.conns = nil
+	return err
+}
+
+func (p *Proxy) log(m Message) {
+	if p.Log == nil {
+		return
+	}
+	p.logMu.Lock()
+	defer p.logMu.Unlock()
+	m.Time = time.Now()
+	p.Log(m)
+}
+
+// track adds conn to those closed by Close, and reports
+// whether the proxy is still open
+func (p *Proxy) track(conn net.Conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conns == nil {
+		return false
+	}
+	p.conns[conn] = true
+	return true
+}
+
+func (p *Proxy) untrack(conns ...net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conn := range conns {
+		delete(p.conns, conn)
+		conn.Close()
+	}
+}
+
+// relay runs a session between a client and the daemon
+func (p *Proxy) relay(id int, client net.Conn) {
+	up, err := net.Dial("unix", p.Upstream)
+	if err != nil {
+		p.log(Message{Session: id, From: FromDaemon, Kind: KindClose, Err: err.Error()})
+		p.untrack(client)
+		return
+	}
+	defer p.untrack(client, up)
+	if !p.track(up) {
+		return
+	}
+	p.log(Message{Session: id, From: FromClient, Kind: KindOpen})
+
+	s := &session{
+		p:      p,
+		id:     id,
+		client: client,
+		daemon: up,
+		cr:     &recorder{r: bufio.NewReader(client)},
+		dr:     &recorder{r: bufio.NewReader(up)},
+	}
+	err = s.run()
+	if isClosed(err) {
+		err = nil
+	}
+
+	m := Message{Session: id, From: FromClient, Kind: KindClose}
+	if err != nil {
+		m.Err = err.Error()
+	}
+	p.log(m)
+}
+
+// A session relays the messages of one client connection
+type session struct {
+	p              *Proxy
+	id             int
+	client, daemon net.Conn
+	cr, dr         *recorder
+}
+
+// run relays requests and their responses until the client
+// subscribes to notifications, or a message cannot be decoded
+func (s *session) run() error {
+	for {
+		req, err := minissdpc.ReadRequest(s.cr)
+		if err != nil {
+			return s.raw(FromClient, err)
+		}
+		if err := s.forward(FromClient, Message{Kind: req.Name(), Filter: req.Filter}, req); err != nil {
+			return err
+		}
+
+		switch req.Type {
+		case minissdpc.RequestTypeRegister:
+			// Registrations are not acknowledged
+
+		case minissdpc.RequestTypeVersion:
+			v, err := minissdpc.DecodeString(s.dr)
+			if err != nil {
+				return s.raw(FromDaemon, err)
+			}
+			if err := s.forward(FromDaemon, Message{Kind: KindVersion, Version: v}, req); err != nil {
+				return err
+			}
+
+		case minissdpc.RequestTypeNotify:
+			return s.notifications()
+
+		default:
+			services, err := minissdpc.DecodeServices(s.dr)
+			if err != nil {
+				return s.raw(FromDaemon, err)
+			}
+			m := Message{Kind: KindServices, Services: services}
+			if err := s.forward(FromDaemon, m, req); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// forward logs m, and sends the bytes read from its sender
+// on to the other side
+func (s *session) forward(from string, m Message, req minissdpc.Request) error {
+	src, dst := s.cr, s.daemon
+	if from == FromDaemon {
+		src, dst = s.dr, s.client
+	}
+	if from == FromClient && req.Type == minissdpc.RequestTypeRegister {
+		m.Services = []minissdpc.Service{req.Service}
+	}
+
+	m.Session = s.id
+	m.From = from
+	m.Data = src.take()
+	s.p.log(m)
+	_, err := dst.Write(m.Data)
+	return err
+}
+
+// notifications relays the notifications sent to a subscribed
+// client. Anything further sent by the client is relayed raw.
+func (s *session) notifications() error {
+	go s.copyRaw(FromClient, nil)
+	for {
+		n, err := minissdpc.DecodeNotification(s.dr)
+		if err != nil {
+			return s.raw(FromDaemon, err)
+		}
+		m := Message{
+			Kind:         KindNotification,
+			Notification: n.Type.String(),
+			Services:     []minissdpc.Service{n.Service},
+		}
+		if err := s.forward(FromDaemon, m, minissdpc.Request{}); err != nil {
+			return err
+		}
+	}
+}
+
+// raw gives up decoding after err, and relays the rest of the
+// session without decoding it, starting with the bytes that were
+// read from the sender before the error. If nothing was read, the
+// sender has gone and the session ends with err.
+func (s *session) raw(from string, err error) error {
+	var pending []byte
+	if from == FromClient {
+		pending = s.cr.take()
+	} else {
+		pending = s.dr.take()
+	}
+	if len(pending) == 0 {
+		return err
+	}
+	s.p.log(Message{Session: s.id, From: from, Kind: KindRaw, Err: err.Error(), Data: pending})
+
+	dst := s.daemon
+	if from == FromDaemon {
+		dst = s.client
+	}
+	if _, err := dst.Write(pending); err != nil {
+		return err
+	}
+
+	done := make(chan error, 2)
+	go s.copyRaw(FromClient, done)
+	go s.copyRaw(FromDaemon, done)
+	return <-done
+}
+
+// copyRaw relays everything sent from one side, logging it as it
+// goes, and sends the reason it stopped on done if it is not nil
+func (s *session) copyRaw(from string, done chan<- error) {
+	src, dst := s.cr.r, s.daemon
+	if from == FromDaemon {
+		src, dst = s.dr.r, s.client
+	}
+
+	buf := make([]byte, rawBufferSize)
+	var err error
+	for err == nil {
+		var n int
+		n, err = src.Read(buf)
+		if n > 0 {
+			data := append([]byte(nil), buf[:n]...)
+			s.p.log(Message{Session: s.id, From: from, Kind: KindRaw, Data: data})
+			_, err = dst.Write(data)
+		}
+	}
+
+	// Closing either side ends the session
+	s.client.Close()
+	s.daemon.Close()
+	if done != nil {
+		done <- err
+	}
+}
+
+// A recorder keeps the bytes read through it until they are taken
+type recorder struct {
+	r   io.Reader
+	buf []byte
+}
+
+func (r *recorder) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.buf = append(r.buf, b[:n]...)
+	return n, err
+}
+
+// take returns the bytes read since the last call
+func (r *recorder) take() []byte {
+	b := r.buf
+	r.buf = nil
+	return b
+}
+
+// isClosed reports whether err is from a connection closed by the
+// client or the proxy, which ends a session normally
+func isClosed(err error) bool {
+	return err == nil || err == io.EOF || errors.Is(err, net.ErrClosed)
+}
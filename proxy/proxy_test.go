@@ -0,0 +1,237 @@
+package proxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forfuncsake/minissdpc"
+	"github.com/forfuncsake/minissdpc/mock"
+)
+
+var testService = minissdpc.Service{
+	Type:     "urn:Belkin:device:controllee:1",
+	USN:      "uuid:Socket-1_0-221517K0101769::urn:Belkin:device:controllee:1",
+	Server:   "Unspecified, UPnP/1.0, Unspecified",
+	Location: "http://192.168.1.10:49153/setup.xml",
+}
+
+// testProxy runs a mock daemon and a proxy in front of it
+type testProxy struct {
+	daemon     *mock.Server
+	daemonPath string
+	path       string
+
+	mu       sync.Mutex
+	messages []Message
+
+	stop func()
+}
+
+func newTestProxy(t *testing.T) *testProxy {
+	dir, err := ioutil.TempDir("", "ssdpc-proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := &testProxy{
+		daemon:     mock.NewServer(testService),
+		daemonPath: filepath.Join(dir, "minissdpd.sock"),
+		path:       filepath.Join(dir, "proxy.sock"),
+	}
+
+	dl, err := net.Listen("unix", tp.daemonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go tp.daemon.Serve(dl)
+
+	p := New(tp.daemonPath)
+	p.Log = func(m Message) {
+		tp.mu.Lock()
+		defer tp.mu.Unlock()
+		tp.messages = append(tp.messages, m)
+	}
+	pl, err := net.Listen("unix", tp.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go p.Serve(pl)
+
+	tp.stop = func() {
+		p.Close()
+		tp.daemon.Close()
+		os.RemoveAll(dir)
+	}
+	return tp
+}
+
+// waitKinds waits for n messages to have been logged,
+// and returns their kinds
+func (tp *testProxy) waitKinds(n int) []string {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tp.mu.Lock()
+		var kinds []string
+		for _, m := range tp.messages {
+			kinds = append(kinds, m.From+":"+m.Kind)
+		}
+		tp.mu.Unlock()
+		if len(kinds) >= n || time.Now().After(deadline) {
+			return kinds
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (tp *testProxy) connect(t *testing.T) *minissdpc.Client {
+	c := &minissdpc.Client{SocketPath: tp.path}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestProxy(t *testing.T) {
+	tp := newTestProxy(t)
+	defer tp.stop()
+
+	c := tp.connect(t)
+	moved := testService
+	moved.Location = "http://192.168.1.11:49153/setup.xml"
+	if err := c.RegisterService(moved); err != nil {
+		t.Fatal(err)
+	}
+	services, err := c.GetServicesByType("urn:Belkin:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || services[0].Location != moved.Location {
+		t.Fatalf("unexpected services through the proxy: %v", services)
+	}
+	if v, err := c.Version(); err != nil || v != mock.DefaultVersion {
+		t.Fatalf("unexpected version %q, %v", v, err)
+	}
+	c.Close()
+
+	expect := "client:open client:register client:by-type daemon:services client:version daemon:version client:close"
+	if kinds := strings.Join(tp.waitKinds(7), " "); kinds != expect {
+		t.Fatalf("expected messages %s, got %s", expect, kinds)
+	}
+
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	register := tp.messages[1]
+	if register.Session != 1 || len(register.Services) != 1 || register.Services[0] != moved {
+		t.Fatalf("unexpected register message %+v", register)
+	}
+	if register.Data[0] != minissdpc.RequestTypeRegister {
+		t.Fatalf("register message does not hold the request bytes: % x", register.Data)
+	}
+	if s := tp.messages[3].String(); !strings.Contains(s, "count=1") || !strings.Contains(s, moved.Location) {
+		t.Fatalf("unexpected text for a response: %s", s)
+	}
+}
+
+func TestProxyNotifications(t *testing.T) {
+	tp := newTestProxy(t)
+	defer tp.stop()
+
+	c := tp.connect(t)
+	defer c.Close()
+	if err := c.Subscribe(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The subscription is not acknowledged, so changes are made
+	// until one is notified
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		moved := testService
+		for i := 0; ; i++ {
+			moved.Location = fmt.Sprintf("http://192.168.1.10:%d/setup.xml", 50000+i)
+			tp.daemon.Register(moved)
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+
+	n, err := c.ReadNotification()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Type != minissdpc.NotifyUpdate || n.Service.USN != testService.USN {
+		t.Fatalf("unexpected notification %+v", n)
+	}
+
+	kinds := tp.waitKinds(5)
+	if kinds[4] != "daemon:notification" {
+		t.Fatalf("notification was not logged: %v", kinds)
+	}
+}
+
+func TestProxyRaw(t *testing.T) {
+	tp := newTestProxy(t)
+	defer tp.stop()
+
+	conn, err := net.Dial("unix", tp.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// An unknown request is relayed as is, and the mock
+	// daemon closes the connection
+	if _, err := conn.Write([]byte{9, 0}); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected the connection to be closed")
+	}
+
+	kinds := tp.waitKinds(3)
+	if len(kinds) < 2 || kinds[1] != "client:raw" {
+		t.Fatalf("expected a raw message, got %v", kinds)
+	}
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	if m := tp.messages[1]; m.Err == "" || len(m.Data) == 0 {
+		t.Fatalf("raw message does not hold the error and data: %+v", m)
+	}
+}
+
+func TestProxyNoUpstream(t *testing.T) {
+	tp := newTestProxy(t)
+	defer tp.stop()
+	tp.daemon.Close()
+	// The socket is removed once the daemon has stopped listening
+	for i := 0; i < 1000; i++ {
+		if _, err := os.Stat(tp.daemonPath); err != nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	conn, err := net.Dial("unix", tp.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected the connection to be closed")
+	}
+	if kinds := tp.waitKinds(1); len(kinds) != 1 || kinds[0] != "daemon:close" {
+		t.Fatalf("expected a close message, got %v", kinds)
+	}
+}
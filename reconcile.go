@@ -0,0 +1,197 @@
+package minissdpc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Drift describes how the services advertised by minissdpd differ
+// from a desired set of services
+type Drift struct {
+	// Missing services are desired but not advertised
+	Missing []Service
+
+	// Extra services are advertised for a device that has desired
+	// services (their USNs share its uuid), but are not desired
+	Extra []Service
+
+	// Mismatched services are advertised with a desired USN,
+	// but a different Type or Location
+	Mismatched []Mismatch
+
+	// Conflicts are mismatched services that were registered by
+	// another application, according to the client's Ledger.
+	// They are not touched by Fix.
+	Conflicts []Mismatch
+}
+
+// A Mismatch pairs a desired service with its advertised counterpart
+type Mismatch struct {
+	Desired    Service
+	Advertised Service
+}
+
+// Empty reports whether the advertised services match those desired
+func (d *Drift) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Extra) == 0 && len(d.Mismatched) == 0 &&
+		len(d.Conflicts) == 0
+}
+
+// Reconcile queries minissdpd for all advertised services, and
+// returns how they differ from the desired services. Location
+// templates are resolved with the client's Resolver, so a service
+// whose address has changed is reported as mismatched. If the client
+// has a Ledger, only services recorded in it are considered ours:
+// others are never reported as Extra, and are reported as Conflicts
+// rather than Mismatched.
+func (c *Client) Reconcile(desired []Service) (*Drift, error) {
+	desired, err := c.resolveAll(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	var owned func(Service) bool
+	if c.Ledger != nil {
+		if owned, err = c.Ledger.owned(); err != nil {
+			return nil, err
+		}
+	}
+
+	advertised, err := c.advertised(desired)
+	if err != nil {
+		return nil, err
+	}
+	return diff(desired, advertised, owned), nil
+}
+
+// advertised returns the services advertised by minissdpd, or at
+// least those of the desired services' devices. The count of a
+// response is a single byte, so a full response to GetServicesAll
+// may have been truncated, and each device is queried instead.
+func (c *Client) advertised(desired []Service) ([]Service, error) {
+	all, err := c.GetServicesAll()
+	if err != nil || len(all) < maxResponseServices {
+		return all, err
+	}
+
+	var out []Service
+	queried := make(map[string]bool)
+	for _, s := range desired {
+		uuid := deviceUUID(s.USN)
+		if queried[uuid] {
+			continue
+		}
+		queried[uuid] = true
+
+		found, err := c.GetServicesByUSN(uuid)
+		if err != nil {
+			return nil, err
+		}
+		// The query matches a prefix, so uuid:1 also finds uuid:10
+		for _, f := range found {
+			if deviceUUID(f.USN) == uuid {
+				out = append(out, f)
+			}
+		}
+	}
+	return out, nil
+}
+
+// Fix registers the missing and mismatched services of d, and
+// returns the first error met. minissdpd has no way to remove a
+// service, so Extra services cannot be fixed and are left in place.
+func (c *Client) Fix(d *Drift) error {
+	for _, s := range d.Missing {
+		if err := c.RegisterService(s); err != nil {
+			return fmt.Errorf("could not register %s: %v", s.USN, err)
+		}
+	}
+	for _, m := range d.Mismatched {
+		if err := c.RegisterService(m.Desired); err != nil {
+			return fmt.Errorf("could not register %s: %v", m.Desired.USN, err)
+		}
+	}
+	return nil
+}
+
+// resolveAll returns services with their Location templates resolved
+func (c *Client) resolveAll(services []Service) ([]Service, error) {
+	var resolved []Service
+	for i, s := range services {
+		if !IsTemplate(s.Location) {
+			continue
+		}
+		if resolved == nil {
+			resolved = append([]Service(nil), services...)
+		}
+		var err error
+		if resolved[i], err = s.ResolveLocation(c.Resolver); err != nil {
+			return nil, err
+		}
+	}
+	if resolved == nil {
+		return services, nil
+	}
+	return resolved, nil
+}
+
+// diff compares the desired services with those advertised.
+// owned reports whether an advertised service is ours, and
+// all services are if it is nil.
+func diff(desired, advertised []Service, owned func(Service) bool) *Drift {
+	if owned == nil {
+		owned = func(Service) bool { return true }
+	}
+
+	d := &Drift{}
+
+	byUSN := make(map[string][]Service, len(advertised))
+	for _, s := range advertised {
+		byUSN[s.USN] = append(byUSN[s.USN], s)
+	}
+
+	wanted := make(map[string]bool, len(desired))
+	devices := make(map[string]bool)
+	for _, s := range desired {
+		wanted[s.USN] = true
+		devices[deviceUUID(s.USN)] = true
+
+		found := byUSN[s.USN]
+		switch {
+		case len(found) == 0:
+			d.Missing = append(d.Missing, s)
+		case !registered(found, s):
+			m := Mismatch{Desired: s, Advertised: found[0]}
+			if owned(found[0]) {
+				d.Mismatched = append(d.Mismatched, m)
+			} else {
+				d.Conflicts = append(d.Conflicts, m)
+			}
+		}
+	}
+
+	for _, s := range advertised {
+		if !wanted[s.USN] && devices[deviceUUID(s.USN)] && owned(s) {
+			d.Extra = append(d.Extra, s)
+		}
+	}
+	return d
+}
+
+// registered reports whether s is among the services found
+func registered(found []Service, s Service) bool {
+	for _, f := range found {
+		if f.USN == s.USN && f.Type == s.Type && f.Location == s.Location {
+			return true
+		}
+	}
+	return false
+}
+
+// deviceUUID returns the uuid:<id> part of a USN
+func deviceUUID(usn string) string {
+	if i := strings.Index(usn, "::"); i >= 0 {
+		return usn[:i]
+	}
+	return usn
+}
@@ -0,0 +1,165 @@
+package minissdpc_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/forfuncsake/minissdpc"
+	"github.com/forfuncsake/minissdpc/mock"
+)
+
+func TestReconcileFullResponse(t *testing.T) {
+	// More services than a response can hold, with ours added last
+	// so that they are cut from the response to GetServicesAll
+	var services []minissdpc.Service
+	for i := 0; i < 300; i++ {
+		id := fmt.Sprintf("uuid:Other-%d", i)
+		services = append(services, minissdpc.Service{
+			Type:     "urn:Other:device:thing:1",
+			USN:      id + "::urn:Other:device:thing:1",
+			Location: fmt.Sprintf("http://192.168.1.%d/setup.xml", i%250+1),
+		})
+	}
+	ours := []minissdpc.Service{
+		{Type: "urn:Belkin:device:controllee:1", USN: "uuid:Socket-1::urn:Belkin:device:controllee:1", Location: "http://192.168.1.10:49153/setup.xml"},
+		{Type: "uuid:Socket-1", USN: "uuid:Socket-1", Location: "http://192.168.1.10:49153/setup.xml"},
+	}
+	d := newDaemon(t, func(s *mock.Server) {
+		for _, svc := range append(services, ours...) {
+			s.Register(svc)
+		}
+	})
+	defer d.close()
+
+	c := &minissdpc.Client{SocketPath: d.path}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	all, err := c.GetServicesAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 255 {
+		t.Fatalf("expected a full response of 255 services, got %d", len(all))
+	}
+
+	drift, err := c.Reconcile(ours)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !drift.Empty() {
+		t.Fatalf("expected no drift, got %+v", drift)
+	}
+}
+
+func TestReconcileFix(t *testing.T) {
+	d := newDaemon(t, nil)
+	defer d.close()
+
+	c := &minissdpc.Client{SocketPath: d.path}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	old := testDevice("http://192.168.1.11/setup.xml")
+	for _, s := range old[:2] {
+		if err := c.RegisterService(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.waitRegistered(t, 2)
+
+	desired := testDevice("http://192.168.1.10/setup.xml")
+	drift, err := c.Reconcile(desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drift.Missing) != 2 || len(drift.Mismatched) != 2 || len(drift.Extra) != 0 {
+		t.Fatalf("unexpected drift %+v", drift)
+	}
+
+	if err := c.Fix(drift); err != nil {
+		t.Fatal(err)
+	}
+	d.waitRegistered(t, 4)
+
+	drift, err = c.Reconcile(desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !drift.Empty() {
+		t.Fatalf("unexpected drift after fix: %+v", drift)
+	}
+}
+
+func TestReconcileLedger(t *testing.T) {
+	d := newDaemon(t, nil)
+	defer d.close()
+	dir, err := ioutil.TempDir("", "ssdpc-ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l := minissdpc.NewLedger(filepath.Join(dir, "state"))
+
+	c := &minissdpc.Client{SocketPath: d.path, Ledger: l}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	services := testDevice("http://192.168.1.10/setup.xml")
+	if err := c.RegisterService(services[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := l.Lookup(services[0]); !ok {
+		t.Fatal("registered service was not recorded")
+	}
+
+	// Another application registers the rest of the device,
+	// and an extra service for it
+	other := &minissdpc.Client{SocketPath: d.path}
+	if err := other.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	moved := services[1]
+	moved.Location = "http://192.168.1.11/setup.xml"
+	extra := minissdpc.Service{Type: "urn:Belkin:service:metainfo:1", USN: "uuid:1234-1234-1234-1234::urn:Belkin:service:metainfo:1",
+		Server: "Other", Location: "http://192.168.1.11/setup.xml"}
+	for _, s := range []minissdpc.Service{moved, extra} {
+		if err := other.RegisterService(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.waitRegistered(t, 3)
+
+	drift, err := c.Reconcile(services)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drift.Extra) != 0 || len(drift.Mismatched) != 0 {
+		t.Fatalf("another application's services were claimed: %+v", drift)
+	}
+	if len(drift.Conflicts) != 1 || drift.Conflicts[0].Desired != services[1] {
+		t.Fatalf("expected a conflict for %s, got %+v", services[1].USN, drift.Conflicts)
+	}
+	if len(drift.Missing) != 2 {
+		t.Fatalf("expected 2 missing services, got %+v", drift.Missing)
+	}
+
+	// A ledger that cannot be written is reported
+	// after the service is registered
+	c.Ledger = minissdpc.NewLedger(filepath.Join(l.Path(), "not-a-dir"))
+	err = c.RegisterService(services[2])
+	if _, ok := err.(*minissdpc.LedgerError); !ok {
+		t.Fatalf("expected *LedgerError, got %v", err)
+	}
+	d.waitRegistered(t, 4)
+}
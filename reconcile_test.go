@@ -0,0 +1,80 @@
+package minissdpc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testDevice(location string) []Service {
+	return (&DeviceAdvertisement{
+		UUID:         "1234-1234-1234-1234",
+		DeviceType:   "urn:Belkin:device:controllee:1",
+		ServiceTypes: []string{"urn:Belkin:service:basicevent:1"},
+		Location:     location,
+		Server:       "Unspecified, UPnP/1.0, Unspecified",
+	}).Services()
+}
+
+// advertised returns services as minissdpd reports them, without Server
+func advertised(services ...Service) []Service {
+	out := make([]Service, len(services))
+	for i, s := range services {
+		s.Server = ""
+		out[i] = s
+	}
+	return out
+}
+
+func TestDiff(t *testing.T) {
+	desired := testDevice("http://192.168.1.10/setup.xml")
+	moved := testDevice("http://192.168.1.11/setup.xml")
+	other := Service{Type: "urn:Other:device:thing:1", USN: "uuid:9999::urn:Other:device:thing:1",
+		Location: "http://192.168.1.12/desc.xml"}
+	extra := Service{Type: "urn:Belkin:service:metainfo:1", USN: "uuid:1234-1234-1234-1234::urn:Belkin:service:metainfo:1",
+		Location: "http://192.168.1.10/setup.xml"}
+
+	retyped := desired[2]
+	retyped.Type = "urn:Belkin:device:lightswitch:1"
+
+	tests := []struct {
+		name       string
+		advertised []Service
+		expect     *Drift
+	}{
+		{"in sync", advertised(desired...), &Drift{}},
+		{"in sync with others", advertised(append([]Service{other}, desired...)...), &Drift{}},
+		{"nothing advertised", nil, &Drift{Missing: desired}},
+		{
+			"one missing",
+			advertised(desired[0], desired[1], desired[3]),
+			&Drift{Missing: desired[2:3]},
+		},
+		{
+			"extra service for our device",
+			advertised(append(desired, extra)...),
+			&Drift{Extra: []Service{extra}},
+		},
+		{
+			"moved location",
+			advertised(desired[0], moved[1], desired[2], desired[3]),
+			&Drift{Mismatched: []Mismatch{{Desired: desired[1], Advertised: advertised(moved[1])[0]}}},
+		},
+		{
+			"changed type",
+			advertised(desired[0], desired[1], retyped, desired[3]),
+			&Drift{Mismatched: []Mismatch{{Desired: desired[2], Advertised: advertised(retyped)[0]}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := diff(desired, test.advertised, nil)
+			if !reflect.DeepEqual(got, test.expect) {
+				t.Fatalf("expected %+v, got %+v", test.expect, got)
+			}
+			if got.Empty() != (len(test.expect.Missing)+len(test.expect.Extra)+len(test.expect.Mismatched) == 0) {
+				t.Fatalf("unexpected Empty() for %+v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package minissdpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultCheckInterval is how often a Registrar checks that its
+// services are still registered, unless Interval is set
+const DefaultCheckInterval = 30 * time.Second
+
+// eventQueueLength is the number of events buffered by a Registrar
+// before further events are dropped
+const eventQueueLength = 64
+
+var (
+	errSocketReplaced = errors.New("socket was replaced, minissdpd has restarted")
+	errForeignService = errors.New("USN is advertised differently by another application")
+)
+
+// EventType identifies what a Registrar Event reports
+type EventType int
+
+// Types of Registrar events
+const (
+	// EventConnected is sent when a connection to minissdpd is made
+	EventConnected EventType = iota
+	// EventDisconnected is sent when the connection is lost or
+	// cannot be made. Err holds the cause.
+	EventDisconnected
+	// EventRegistered is sent when a missing or mismatched
+	// service is submitted
+	EventRegistered
+	// EventError is sent when a service cannot be checked or
+	// registered. Err holds the cause.
+	EventError
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventConnected:
+		return "connected"
+	case EventDisconnected:
+		return "disconnected"
+	case EventRegistered:
+		return "registered"
+	case EventError:
+		return "error"
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// An Event reports a change in the state of a Registrar
+type Event struct {
+	Type    EventType
+	Service *Service
+	Err     error
+}
+
+func (e Event) String() string {
+	s := e.Type.String()
+	if e.Service != nil {
+		s += " " + e.Service.USN
+	}
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+// A Registrar keeps a set of services registered with minissdpd,
+// which forgets them whenever it restarts. While running, it
+// periodically reconciles the advertised services with its own and
+// re-registers any that are missing or mismatched, reconnecting as
+// needed. It must be created with NewRegistrar.
+type Registrar struct {
+	// Client is used to talk to minissdpd. It must not be used
+	// by anything else while the Registrar is running.
+	Client *Client
+
+	// Interval is the time between checks, and the limit on
+	// the time taken by each check
+	Interval time.Duration
+
+	mu       sync.Mutex
+	services []Service
+	events   chan Event
+	check    chan struct{}
+
+	// socket identifies the socket file last connected to,
+	// so that its replacement by a new daemon can be noticed
+	socket os.FileInfo
+}
+
+// NewRegistrar returns a Registrar that keeps services registered
+// with the minissdpd listening on socketPath
+func NewRegistrar(socketPath string, services ...Service) *Registrar {
+	return &Registrar{
+		Client:   &Client{SocketPath: socketPath},
+		Interval: DefaultCheckInterval,
+		services: append([]Service(nil), services...),
+		events:   make(chan Event, eventQueueLength),
+		check:    make(chan struct{}, 1),
+	}
+}
+
+// Events returns the channel on which events are sent. Events are
+// dropped, rather than blocking the Registrar, if it is not drained.
+func (r *Registrar) Events() <-chan Event {
+	return r.events
+}
+
+// Services returns the services the Registrar keeps registered
+func (r *Registrar) Services() []Service {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Service(nil), r.services...)
+}
+
+// SetServices replaces the services the Registrar keeps registered,
+// and checks them without waiting for the next interval. minissdpd
+// has no way to remove a service, so services that are no longer
+// wanted are only no longer re-registered.
+func (r *Registrar) SetServices(services []Service) {
+	r.mu.Lock()
+	r.services = append([]Service(nil), services...)
+	r.mu.Unlock()
+	r.Check()
+}
+
+// Check asks a running Registrar to check its services now
+func (r *Registrar) Check() {
+	select {
+	case r.check <- struct{}{}:
+	default:
+	}
+}
+
+// Run checks the services immediately, then on every interval or
+// request from Check, until ctx is done. It returns ctx.Err().
+func (r *Registrar) Run(ctx context.Context) error {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = DefaultCheckInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	defer r.disconnect(nil)
+
+	for {
+		r.sync(interval)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		case <-r.check:
+		}
+	}
+}
+
+// sync makes a single pass over the services, re-registering those
+// that minissdpd no longer advertises or advertises differently
+func (r *Registrar) sync(timeout time.Duration) {
+	if r.Client.conn != nil && r.replaced() {
+		r.disconnect(errSocketReplaced)
+	}
+	if r.Client.conn == nil && !r.connect() {
+		return
+	}
+	r.Client.conn.SetDeadline(time.Now().Add(timeout))
+
+	// Templates are resolved on every pass, so that services are
+	// re-registered when an interface's address changes
+	var services []Service
+	for _, s := range r.Services() {
+		s := s
+		resolved, err := s.ResolveLocation(r.Client.Resolver)
+		if err != nil {
+			r.send(Event{Type: EventError, Service: &s, Err: err})
+			continue
+		}
+		services = append(services, resolved)
+	}
+
+	drift, err := r.Client.Reconcile(services)
+	if err != nil {
+		// minissdpd has gone away, or the connection is no longer
+		// in a known state; either way it must be re-established
+		r.disconnect(err)
+		return
+	}
+
+	for _, m := range drift.Conflicts {
+		s := m.Desired
+		r.send(Event{Type: EventError, Service: &s, Err: errForeignService})
+	}
+
+	fix := drift.Missing
+	for _, m := range drift.Mismatched {
+		fix = append(fix, m.Desired)
+	}
+	for _, s := range fix {
+		s := s
+		err = r.Client.RegisterService(s)
+		switch err.(type) {
+		case nil:
+			r.send(Event{Type: EventRegistered, Service: &s})
+		case *ValidationError:
+			r.send(Event{Type: EventError, Service: &s, Err: err})
+		case *LedgerError:
+			r.send(Event{Type: EventRegistered, Service: &s})
+			r.send(Event{Type: EventError, Service: &s, Err: err})
+		default:
+			r.disconnect(err)
+			return
+		}
+	}
+}
+
+func (r *Registrar) connect() bool {
+	err := r.Client.Connect()
+	if err != nil {
+		r.send(Event{Type: EventDisconnected, Err: err})
+		return false
+	}
+	r.socket, _ = os.Stat(r.Client.SocketPath)
+	r.send(Event{Type: EventConnected})
+	return true
+}
+
+// disconnect closes the connection, reporting err if it is not nil
+func (r *Registrar) disconnect(err error) {
+	if r.Client.conn == nil {
+		return
+	}
+	r.Client.Close()
+	r.socket = nil
+	if err != nil {
+		r.send(Event{Type: EventDisconnected, Err: err})
+	}
+}
+
+// replaced reports whether the socket file has been removed or
+// recreated since it was connected to
+func (r *Registrar) replaced() bool {
+	if r.socket == nil {
+		return false
+	}
+	fi, err := os.Stat(r.Client.SocketPath)
+	return err != nil || !os.SameFile(fi, r.socket)
+}
+
+func (r *Registrar) send(e Event) {
+	select {
+	case r.events <- e:
+	default:
+	}
+}
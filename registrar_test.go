@@ -0,0 +1,312 @@
+package minissdpc_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forfuncsake/minissdpc"
+	"github.com/forfuncsake/minissdpc/mock"
+)
+
+// daemon runs a mock.Server on a temporary socket, and can be
+// restarted with a new server to forget its services, as minissdpd
+// does when it restarts
+type daemon struct {
+	*mock.Server
+	path string
+
+	// configure, if set, is applied to each new server
+	configure func(*mock.Server)
+}
+
+func newDaemon(t *testing.T, configure func(*mock.Server)) *daemon {
+	dir, err := ioutil.TempDir("", "ssdpc")
+	if err != nil {
+		t.Fatalf("could not create temp socket dir: %v", err)
+	}
+	d := &daemon{path: filepath.Join(dir, "minissdpd.sock"), configure: configure}
+	d.start(t)
+	return d
+}
+
+func (d *daemon) start(t *testing.T) {
+	d.Server = mock.NewServer()
+	if d.configure != nil {
+		d.configure(d.Server)
+	}
+	// Listening before serving means the socket accepts
+	// connections as soon as this returns
+	os.Remove(d.path)
+	l, err := net.Listen("unix", d.path)
+	if err != nil {
+		t.Fatalf("mock server did not start: %v", err)
+	}
+	go d.Serve(l)
+}
+
+// restart replaces the server and its socket
+func (d *daemon) restart(t *testing.T) {
+	d.Close()
+	d.start(t)
+}
+
+func (d *daemon) close() {
+	d.Close()
+	os.RemoveAll(filepath.Dir(d.path))
+}
+
+// waitFor waits for the registered services to satisfy cond,
+// as minissdpd does not acknowledge registrations
+func (d *daemon) waitFor(cond func([]minissdpc.Service) bool) []minissdpc.Service {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond(d.Services()) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	return d.Services()
+}
+
+// waitRegistered waits for n registrations
+func (d *daemon) waitRegistered(t *testing.T, n int) {
+	got := d.waitFor(func(s []minissdpc.Service) bool { return len(s) >= n })
+	if len(got) != n {
+		t.Fatalf("expected %d registrations, got %d", n, len(got))
+	}
+}
+
+func testDevice(location string) []minissdpc.Service {
+	return (&minissdpc.DeviceAdvertisement{
+		UUID:         "1234-1234-1234-1234",
+		DeviceType:   "urn:Belkin:device:controllee:1",
+		ServiceTypes: []string{"urn:Belkin:service:basicevent:1"},
+		Location:     location,
+		Server:       "Unspecified, UPnP/1.0, Unspecified",
+	}).Services()
+}
+
+// expectEvent waits for an event of the given type, skipping others
+func expectEvent(t *testing.T, r *minissdpc.Registrar, typ minissdpc.EventType) minissdpc.Event {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-r.Events():
+			if e.Type == typ {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s event", typ)
+		}
+	}
+}
+
+func TestRegistrar(t *testing.T) {
+	var mu sync.Mutex
+	registrations := 0
+	d := newDaemon(t, func(s *mock.Server) {
+		s.Log = func(req minissdpc.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			if req.Type == minissdpc.RequestTypeRegister {
+				registrations++
+			}
+		}
+	})
+	defer d.close()
+	registered := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return registrations
+	}
+
+	services := (&minissdpc.DeviceAdvertisement{
+		UUID:       "1234-1234-1234-1234",
+		DeviceType: "urn:Belkin:device:controllee:1",
+		Location:   "http://192.168.1.10/setup.xml",
+		Server:     "Unspecified, UPnP/1.0, Unspecified",
+	}).Services()
+
+	r := minissdpc.NewRegistrar(d.path, services...)
+	r.Interval = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- r.Run(ctx)
+	}()
+
+	expectEvent(t, r, minissdpc.EventConnected)
+	for _, s := range services {
+		e := expectEvent(t, r, minissdpc.EventRegistered)
+		if e.Service.USN != s.USN {
+			t.Fatalf("expected %s to be registered, got %s", s.USN, e.Service.USN)
+		}
+	}
+	d.waitRegistered(t, len(services))
+
+	// A check with nothing missing registers nothing more
+	r.Check()
+	time.Sleep(50 * time.Millisecond)
+	if n := registered(); n != len(services) {
+		t.Fatalf("expected %d registrations, got %d", len(services), n)
+	}
+
+	// After a restart the services are submitted to the new daemon
+	d.restart(t)
+	r.Check()
+	e := expectEvent(t, r, minissdpc.EventDisconnected)
+	if e.Err == nil {
+		t.Fatal("disconnected event has no error")
+	}
+	r.Check()
+	expectEvent(t, r, minissdpc.EventConnected)
+	for range services {
+		expectEvent(t, r, minissdpc.EventRegistered)
+	}
+	d.waitRegistered(t, len(services))
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestRegistrarInvalidService(t *testing.T) {
+	d := newDaemon(t, nil)
+	defer d.close()
+
+	invalid := minissdpc.Service{Type: "urn:Dummy:device:controllee:1", USN: "uuid:1234::urn:Dummy:device:controllee:1",
+		Server: "Dummy", Location: "ftp://192.168.1.10/setup.xml"}
+	valid := minissdpc.Service{Type: "urn:Dummy:device:controllee:1", USN: "uuid:5678::urn:Dummy:device:controllee:1",
+		Server: "Dummy", Location: "http://192.168.1.10/setup.xml"}
+
+	r := minissdpc.NewRegistrar(d.path)
+	r.SetServices([]minissdpc.Service{invalid, valid})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	e := expectEvent(t, r, minissdpc.EventError)
+	if e.Service.USN != invalid.USN {
+		t.Fatalf("unexpected error event %v", e)
+	}
+	if _, ok := e.Err.(*minissdpc.ValidationError); !ok {
+		t.Fatalf("expected *ValidationError, got %T", e.Err)
+	}
+	e = expectEvent(t, r, minissdpc.EventRegistered)
+	if e.Service.USN != valid.USN {
+		t.Fatalf("unexpected registered event %v", e)
+	}
+}
+
+func TestRegistrarNoDaemon(t *testing.T) {
+	r := minissdpc.NewRegistrar(filepath.Join(os.TempDir(), "ssdpc-missing.sock"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	e := expectEvent(t, r, minissdpc.EventDisconnected)
+	if e.Err == nil {
+		t.Fatal("disconnected event has no error")
+	}
+}
+
+// interfaces is a Resolver whose interfaces can be changed
+type interfaces struct {
+	mu     sync.Mutex
+	ifaces []minissdpc.Interface
+}
+
+func (f *interfaces) Interfaces() ([]minissdpc.Interface, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]minissdpc.Interface(nil), f.ifaces...), nil
+}
+
+func (f *interfaces) set(ifaces ...minissdpc.Interface) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ifaces = ifaces
+}
+
+func eth0(ip string) minissdpc.Interface {
+	return minissdpc.Interface{Name: "eth0", Flags: net.FlagUp, Addrs: []net.IP{net.ParseIP(ip)}}
+}
+
+func TestClientRegisterTemplate(t *testing.T) {
+	d := newDaemon(t, nil)
+	defer d.close()
+
+	c := &minissdpc.Client{SocketPath: d.path, Resolver: &interfaces{ifaces: []minissdpc.Interface{eth0("192.168.1.10")}}}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	s := testDevice("http://{iface:eth0}:49153/setup.xml")[0]
+	if err := c.RegisterService(s); err != nil {
+		t.Fatal(err)
+	}
+	d.waitRegistered(t, 1)
+	if loc := d.Services()[0].Location; loc != "http://192.168.1.10:49153/setup.xml" {
+		t.Fatalf("unexpected location %s", loc)
+	}
+
+	s.Location = "http://{iface:wlan0}:49153/setup.xml"
+	if err := c.RegisterService(s); err == nil {
+		t.Fatal("expected an error for a missing interface")
+	}
+}
+
+func TestRegistrarAddressChange(t *testing.T) {
+	d := newDaemon(t, nil)
+	defer d.close()
+
+	ifaces := &interfaces{ifaces: []minissdpc.Interface{eth0("192.168.1.10")}}
+	services := testDevice("http://{iface:eth0}:49153/setup.xml")
+	r := minissdpc.NewRegistrar(d.path, services...)
+	r.Client.Resolver = ifaces
+	r.Interval = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	for range services {
+		expectEvent(t, r, minissdpc.EventRegistered)
+	}
+
+	ifaces.set(eth0("192.168.1.99"))
+	r.Check()
+	for range services {
+		e := expectEvent(t, r, minissdpc.EventRegistered)
+		if e.Service.Location != "http://192.168.1.99:49153/setup.xml" {
+			t.Fatalf("unexpected location %s", e.Service.Location)
+		}
+	}
+	moved := func(services []minissdpc.Service) bool {
+		for _, s := range services {
+			if s.Location != "http://192.168.1.99:49153/setup.xml" {
+				return false
+			}
+		}
+		return true
+	}
+	for _, s := range d.waitFor(moved) {
+		if s.Location != "http://192.168.1.99:49153/setup.xml" {
+			t.Fatalf("%s was not re-registered: %s", s.USN, s.Location)
+		}
+	}
+
+	// An interface going away is reported for each service
+	ifaces.set()
+	r.Check()
+	e := expectEvent(t, r, minissdpc.EventError)
+	if e.Service.Location != services[0].Location {
+		t.Fatalf("error event does not hold the template: %v", e)
+	}
+}
@@ -0,0 +1,125 @@
+package minissdpc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// maxResponseServices is the number of services that fit in a
+// response, whose count is a single byte
+const maxResponseServices = 255
+
+var (
+	errTooManyServices = fmt.Errorf("a response holds at most %d services", maxResponseServices)
+	errUnknownRequest  = errors.New("unknown request type")
+)
+
+// A Request is a single request sent to minissdpd by a client.
+// It is the server side of the protocol spoken by Client.
+type Request struct {
+	// Type is one of the RequestType constants
+	Type byte
+
+	// Filter is the type or USN prefix of a query. It is
+	// also read for other requests, which do not use it.
+	Filter string
+
+	// Service is the service of a register request
+	Service Service
+}
+
+// Name returns a short name for the type of the request
+func (r Request) Name() string {
+	switch r.Type {
+	case RequestTypeVersion:
+		return "version"
+	case RequestTypeByType:
+		return "by-type"
+	case RequestTypeByUSN:
+		return "by-usn"
+	case RequestTypeAll:
+		return "all"
+	case RequestTypeRegister:
+		return "register"
+	case RequestTypeNotify:
+		return "notify"
+	}
+	return "type-" + strconv.Itoa(int(r.Type))
+}
+
+func (r Request) String() string {
+	switch r.Type {
+	case RequestTypeByType, RequestTypeByUSN:
+		return fmt.Sprintf("%s filter=%q", r.Name(), r.Filter)
+	case RequestTypeRegister:
+		return r.Name() + " " + r.Service.String()
+	}
+	return r.Name()
+}
+
+// ReadRequest reads a request from r. Every request is a type byte
+// followed by a length-prefixed string, except for register
+// requests, which are followed by the four fields of the service.
+// An error is returned for request types that minissdpd does not know.
+func ReadRequest(r io.Reader) (Request, error) {
+	var req Request
+	var typ [1]byte
+	if _, err := io.ReadFull(r, typ[:]); err != nil {
+		return req, err
+	}
+	req.Type = typ[0]
+
+	switch req.Type {
+	case RequestTypeRegister:
+		s := &req.Service
+		for _, v := range []*string{&s.Type, &s.USN, &s.Server, &s.Location} {
+			var err error
+			if *v, err = DecodeString(r); err != nil {
+				return req, fmt.Errorf("could not read register request: %v", err)
+			}
+		}
+
+	case RequestTypeVersion, RequestTypeByType, RequestTypeByUSN, RequestTypeAll, RequestTypeNotify:
+		var err error
+		if req.Filter, err = DecodeString(r); err != nil {
+			return req, fmt.Errorf("could not read %s request: %v", req.Name(), err)
+		}
+
+	default:
+		return req, fmt.Errorf("%v %d", errUnknownRequest, req.Type)
+	}
+	return req, nil
+}
+
+// WriteServices writes the response to a query, as read by
+// DecodeServices
+func WriteServices(w io.Writer, services []Service) error {
+	if len(services) > maxResponseServices {
+		return errTooManyServices
+	}
+	b := []byte{byte(len(services))}
+	for _, s := range services {
+		var err error
+		if b, err = appendResponse(b, s); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// appendResponse appends the Location, Type and USN of s,
+// as minissdpd sends them in responses and notifications
+func appendResponse(dst []byte, s Service) ([]byte, error) {
+	var err error
+	for _, v := range [...]string{s.Location, s.Type, s.USN} {
+		dst, err = AppendStringLength(dst, len(v))
+		if err != nil {
+			return dst, fmt.Errorf("could not encode length of %q: %v", v, err)
+		}
+		dst = append(dst, v...)
+	}
+	return dst, nil
+}
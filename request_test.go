@@ -0,0 +1,89 @@
+package minissdpc
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestReadRequest(t *testing.T) {
+	s := testDevice("http://192.168.1.10:49153/setup.xml")[0]
+	b, err := s.AppendEncode([]byte{RequestTypeRegister})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = append(b, RequestTypeByType, 4)
+	b = append(b, "urn:"...)
+	b = append(b, RequestTypeAll, 1, 0)
+	b = append(b, RequestTypeVersion, 0)
+
+	r := bytes.NewReader(b)
+	expect := []Request{
+		{Type: RequestTypeRegister, Service: s},
+		{Type: RequestTypeByType, Filter: "urn:"},
+		{Type: RequestTypeAll, Filter: "\x00"},
+		{Type: RequestTypeVersion},
+	}
+	for _, e := range expect {
+		req, err := ReadRequest(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req != e {
+			t.Fatalf("expected %v, got %v", e, req)
+		}
+	}
+
+	if _, err := ReadRequest(bytes.NewReader([]byte{9, 0})); err == nil {
+		t.Fatal("expected an error for an unknown request type")
+	}
+	if _, err := ReadRequest(bytes.NewReader([]byte{RequestTypeByUSN, 5, 'u'})); err == nil {
+		t.Fatal("expected an error for a truncated request")
+	}
+}
+
+func TestWriteServices(t *testing.T) {
+	services := testDevice("http://192.168.1.10:49153/setup.xml")
+	var buf bytes.Buffer
+	if err := WriteServices(&buf, services); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := DecodeServices(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Responses do not hold the server
+	for i := range services {
+		services[i].Server = ""
+	}
+	if !reflect.DeepEqual(got, services) {
+		t.Fatalf("expected %v, got %v", services, got)
+	}
+
+	if err := WriteServices(&buf, make([]Service, 256)); err != errTooManyServices {
+		t.Fatalf("expected errTooManyServices, got %v", err)
+	}
+}
+
+func TestNotificationEncode(t *testing.T) {
+	n := Notification{Type: NotifyUpdate, Service: testDevice("http://192.168.1.10:49153/setup.xml")[1]}
+	n.Service.Server = ""
+	b, err := n.AppendEncode(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := DecodeNotification(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != n {
+		t.Fatalf("expected %v, got %v", n, got)
+	}
+
+	b[0] = 0
+	if _, err := DecodeNotification(bytes.NewReader(b)); err != errNotNotification {
+		t.Fatalf("expected errNotNotification, got %v", err)
+	}
+}
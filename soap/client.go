@@ -0,0 +1,124 @@
+package soap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/forfuncsake/minissdpc/description"
+)
+
+// maxResponseSize limits the size of a response read by Invoke
+const maxResponseSize = 1 << 20
+
+var errUnexpectedResponse = errors.New("response is not for the invoked action")
+
+// DefaultClient is used to invoke actions when no client is given
+var DefaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// Invoke calls action on the service at controlURL, using c or
+// DefaultClient if c is nil, and returns its out arguments.
+// A fault sent by the service is returned as an *Error.
+func Invoke(c *http.Client, controlURL, serviceType, action string, args []Arg) ([]Arg, error) {
+	if c == nil {
+		c = DefaultClient
+	}
+	body, err := EncodeAction(serviceType, action, args)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, controlURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPACTION", FormatSOAPAction(serviceType, action))
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Faults are sent with 500 Internal Server Error, any
+	// other failure has no envelope to decode
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusInternalServerError {
+		return nil, fmt.Errorf("POST %s: %s", controlURL, resp.Status)
+	}
+	env, err := Decode(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("POST %s: %s", controlURL, resp.Status)
+		}
+		return nil, err
+	}
+	if env.Fault != nil {
+		return nil, env.Fault
+	}
+	if env.Name.Local != action+"Response" {
+		return nil, fmt.Errorf("%v: %s", errUnexpectedResponse, env.Name.Local)
+	}
+	return env.Args, nil
+}
+
+// ParseArgs parses arguments of the form NAME=VALUE, as given
+// on a command line
+func ParseArgs(args []string) ([]Arg, error) {
+	in := make([]Arg, 0, len(args))
+	for _, a := range args {
+		i := strings.IndexByte(a, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("argument %q must be of the form NAME=VALUE", a)
+		}
+		in = append(in, Arg{Name: a[:i], Value: a[i+1:]})
+	}
+	return in, nil
+}
+
+// CheckArgs checks that in holds exactly the in arguments of the
+// action described by scpd, and returns them in the order they are
+// declared, ready to be given to Invoke
+func CheckArgs(scpd *description.SCPD, action string, in []Arg) ([]Arg, error) {
+	def := scpd.Action(action)
+	if def == nil {
+		var names []string
+		for _, a := range scpd.Actions {
+			names = append(names, a.Name)
+		}
+		return nil, fmt.Errorf("service has no action %s, it has: %s", action, strings.Join(names, ", "))
+	}
+
+	ordered := make([]Arg, 0, len(in))
+	declared := make(map[string]bool)
+	var missing []string
+	for _, a := range def.Arguments {
+		if a.Direction != description.DirectionIn {
+			continue
+		}
+		declared[a.Name] = true
+		v, ok := findArg(in, a.Name)
+		if !ok {
+			missing = append(missing, a.Name)
+			continue
+		}
+		ordered = append(ordered, Arg{Name: a.Name, Value: v})
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%s is missing arguments: %s", action, strings.Join(missing, ", "))
+	}
+	seen := make(map[string]bool, len(in))
+	for _, a := range in {
+		if !declared[a.Name] {
+			return nil, fmt.Errorf("%s has no in argument %s", action, a.Name)
+		}
+		if seen[a.Name] {
+			return nil, fmt.Errorf("%s was given argument %s more than once", action, a.Name)
+		}
+		seen[a.Name] = true
+	}
+	return ordered, nil
+}
@@ -0,0 +1,142 @@
+package soap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/forfuncsake/minissdpc/description"
+)
+
+func TestInvoke(t *testing.T) {
+	srv := httptest.NewServer(testHandler(t))
+	defer srv.Close()
+
+	out, err := Invoke(nil, srv.URL, basicEvent, "SetBinaryState", []Arg{{"BinaryState", "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []Arg{{"BinaryState", "1"}, {"CountdownEndTime", "0"}}
+	if !reflect.DeepEqual(out, expect) {
+		t.Fatalf("expected out args %v, got %v", expect, out)
+	}
+
+	out, err = Invoke(nil, srv.URL, basicEvent, "GetBinaryState", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := findArg(out, "BinaryState"); v != "1" {
+		t.Fatalf("expected state to be set, got %v", out)
+	}
+
+	_, err = Invoke(nil, srv.URL, basicEvent, "SetBinaryState", []Arg{{"BinaryState", "2"}})
+	if e, ok := err.(*Error); !ok || e.Code != ErrArgumentValueInvalid.Code {
+		t.Fatalf("expected Argument Value Invalid fault, got %v", err)
+	}
+
+	_, err = Invoke(nil, srv.URL, basicEvent, "Missing", nil)
+	if e, ok := err.(*Error); !ok || e.Code != ErrInvalidAction.Code {
+		t.Fatalf("expected Invalid Action fault, got %v", err)
+	}
+}
+
+func TestInvokeHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	_, err := Invoke(nil, srv.URL, basicEvent, "GetBinaryState", nil)
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected 404 error, got %v", err)
+	}
+
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(encodeAction(t, basicEvent, "GetFriendlyNameResponse", nil))
+	}))
+	defer srv.Close()
+
+	_, err = Invoke(nil, srv.URL, basicEvent, "GetBinaryState", nil)
+	if err == nil || !strings.Contains(err.Error(), errUnexpectedResponse.Error()) {
+		t.Fatalf("expected errUnexpectedResponse, got %v", err)
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args   []string
+		expect []Arg
+		err    string
+	}{
+		{nil, []Arg{}, ""},
+		{[]string{"BinaryState=1"}, []Arg{{"BinaryState", "1"}}, ""},
+		{[]string{"Name=", "URL=http://host/?a=b"}, []Arg{{"Name", ""}, {"URL", "http://host/?a=b"}}, ""},
+		{[]string{"BinaryState"}, nil, `argument "BinaryState" must be of the form NAME=VALUE`},
+		{[]string{"=1"}, nil, `argument "=1" must be of the form NAME=VALUE`},
+	}
+	for _, test := range tests {
+		in, err := ParseArgs(test.args)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%q: expected error %q, got %v, %v", test.args, test.err, in, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(in, test.expect) {
+			t.Errorf("%q: expected %v, got %v, %v", test.args, test.expect, in, err)
+		}
+	}
+}
+
+func TestCheckArgs(t *testing.T) {
+	def := &description.ServiceDefinition{
+		ServiceType: basicEvent,
+		Actions: []description.ActionDefinition{
+			{Name: "GetBinaryState", Out: []description.Arg{{Name: "BinaryState"}}},
+			{
+				Name: "SetRule",
+				In:   []description.Arg{{Name: "RuleID"}, {Name: "Enabled"}},
+				Out:  []description.Arg{{Name: "Result"}},
+			},
+		},
+		Variables: []description.StateVariable{
+			{Name: "BinaryState", DataType: "boolean"},
+			{Name: "RuleID", DataType: "ui4"},
+			{Name: "Enabled", DataType: "boolean"},
+			{Name: "Result", DataType: "string"},
+		},
+	}
+	scpd, err := def.SCPD()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		action string
+		in     []Arg
+		expect []Arg
+		err    string
+	}{
+		{"GetBinaryState", nil, []Arg{}, ""},
+		{"SetRule", []Arg{{"RuleID", "1"}, {"Enabled", "1"}}, []Arg{{"RuleID", "1"}, {"Enabled", "1"}}, ""},
+		{"SetRule", []Arg{{"Enabled", "0"}, {"RuleID", "2"}}, []Arg{{"RuleID", "2"}, {"Enabled", "0"}}, ""},
+		{"Missing", nil, nil, "service has no action Missing, it has: GetBinaryState, SetRule"},
+		{"SetRule", []Arg{{"RuleID", "1"}}, nil, "SetRule is missing arguments: Enabled"},
+		{"SetRule", nil, nil, "SetRule is missing arguments: RuleID, Enabled"},
+		{"GetBinaryState", []Arg{{"BinaryState", "1"}}, nil, "GetBinaryState has no in argument BinaryState"},
+		{"SetRule", []Arg{{"RuleID", "1"}, {"Enabled", "1"}, {"Result", "x"}}, nil, "SetRule has no in argument Result"},
+		{"SetRule", []Arg{{"RuleID", "1"}, {"Enabled", "1"}, {"RuleID", "2"}}, nil, "SetRule was given argument RuleID more than once"},
+	}
+	for _, test := range tests {
+		in, err := CheckArgs(scpd, test.action, test.in)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s %v: expected error %q, got %v, %v", test.action, test.in, test.err, in, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(in, test.expect) {
+			t.Errorf("%s %v: expected %v, got %v, %v", test.action, test.in, test.expect, in, err)
+		}
+	}
+}
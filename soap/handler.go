@@ -0,0 +1,176 @@
+package soap
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/forfuncsake/minissdpc/description"
+)
+
+// A Request is an action invocation received by a Handler
+type Request struct {
+	ServiceType string
+	Action      string
+	Args        []Arg
+
+	// HTTPRequest is the request the action arrived in
+	HTTPRequest *http.Request
+}
+
+// Arg returns the value of the named in argument and
+// whether it was provided
+func (r *Request) Arg(name string) (string, bool) {
+	return findArg(r.Args, name)
+}
+
+// An ActionFunc handles an action, returning its out arguments.
+// Returning an *Error sends that error to the control point, any
+// other error is reported as 501 Action Failed.
+type ActionFunc func(r *Request) ([]Arg, error)
+
+// Handler serves the controlURL of a single service, dispatching
+// each action to the ActionFunc registered for it
+type Handler struct {
+	ServiceType string
+
+	// SCPD, if set, is used to check the in arguments of each
+	// request and to order the out arguments of each response
+	SCPD *description.SCPD
+
+	actions map[string]ActionFunc
+}
+
+// NewHandler returns a Handler for the service type. scpd may be nil.
+func NewHandler(serviceType string, scpd *description.SCPD) *Handler {
+	return &Handler{
+		ServiceType: serviceType,
+		SCPD:        scpd,
+		actions:     make(map[string]ActionFunc),
+	}
+}
+
+// Handle registers fn to handle the named action
+func (h *Handler) Handle(action string, fn ActionFunc) {
+	if h.actions == nil {
+		h.actions = make(map[string]ActionFunc)
+	}
+	h.actions[action] = fn
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	serviceType, action, ok := ParseSOAPAction(req.Header.Get("SOAPACTION"))
+	if !ok || serviceType != h.ServiceType {
+		writeFault(w, ErrInvalidAction)
+		return
+	}
+
+	env, err := Decode(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if env.Name.Local != action || env.Name.Space != serviceType {
+		writeFault(w, ErrInvalidAction)
+		return
+	}
+
+	fn, ok := h.actions[action]
+	if !ok {
+		writeFault(w, ErrInvalidAction)
+		return
+	}
+
+	var def *description.Action
+	if h.SCPD != nil {
+		def = h.SCPD.Action(action)
+		if def == nil {
+			writeFault(w, ErrInvalidAction)
+			return
+		}
+		if !validArgs(def, env.Args) {
+			writeFault(w, ErrInvalidArgs)
+			return
+		}
+	}
+
+	out, err := fn(&Request{
+		ServiceType: serviceType,
+		Action:      action,
+		Args:        env.Args,
+		HTTPRequest: req,
+	})
+	if err != nil {
+		if e, ok := err.(*Error); ok {
+			writeFault(w, e)
+			return
+		}
+		writeFault(w, &Error{ErrActionFailed.Code, err.Error()})
+		return
+	}
+
+	if def != nil {
+		out, err = orderArgs(def, out)
+		if err != nil {
+			writeFault(w, &Error{ErrActionFailed.Code, err.Error()})
+			return
+		}
+	}
+
+	b, err := EncodeResponse(serviceType, action, out)
+	if err != nil {
+		writeFault(w, &Error{ErrActionFailed.Code, err.Error()})
+		return
+	}
+	writeEnvelope(w, http.StatusOK, b)
+}
+
+// validArgs reports whether args holds exactly the in
+// arguments of the action
+func validArgs(def *description.Action, args []Arg) bool {
+	in := 0
+	for _, a := range def.Arguments {
+		if a.Direction != description.DirectionIn {
+			continue
+		}
+		in++
+		if _, ok := findArg(args, a.Name); !ok {
+			return false
+		}
+	}
+	return len(args) == in
+}
+
+// orderArgs returns the out arguments in the order declared by the
+// action, which control points are permitted to rely on
+func orderArgs(def *description.Action, out []Arg) ([]Arg, error) {
+	ordered := make([]Arg, 0, len(out))
+	for _, a := range def.Arguments {
+		if a.Direction != description.DirectionOut {
+			continue
+		}
+		v, ok := findArg(out, a.Name)
+		if !ok {
+			return nil, fmt.Errorf("handler did not return out argument %q", a.Name)
+		}
+		ordered = append(ordered, Arg{a.Name, v})
+	}
+	return ordered, nil
+}
+
+func writeFault(w http.ResponseWriter, e *Error) {
+	writeEnvelope(w, http.StatusInternalServerError, EncodeFault(e))
+}
+
+func writeEnvelope(w http.ResponseWriter, status int, b []byte) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.Header().Set("EXT", "")
+	w.WriteHeader(status)
+	w.Write(b)
+}
@@ -0,0 +1,192 @@
+package soap
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/forfuncsake/minissdpc/description"
+)
+
+func testHandler(t *testing.T) *Handler {
+	def := &description.ServiceDefinition{
+		ServiceType: basicEvent,
+		Actions: []description.ActionDefinition{
+			{Name: "GetBinaryState", Out: []description.Arg{{Name: "BinaryState"}}},
+			{
+				Name: "SetBinaryState",
+				In:   []description.Arg{{Name: "BinaryState"}},
+				Out: []description.Arg{
+					{Name: "BinaryState"},
+					{Name: "CountdownEndTime", Variable: "Time"},
+				},
+			},
+			{Name: "GetFriendlyName", Out: []description.Arg{{Name: "FriendlyName"}}},
+			{Name: "Unhandled"},
+		},
+		Variables: []description.StateVariable{
+			{Name: "BinaryState", DataType: "boolean"},
+			{Name: "Time", DataType: "ui4"},
+			{Name: "FriendlyName", DataType: "string"},
+		},
+	}
+	scpd, err := def.SCPD()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := "0"
+	h := NewHandler(basicEvent, scpd)
+	h.Handle("GetBinaryState", func(r *Request) ([]Arg, error) {
+		return []Arg{{"BinaryState", state}}, nil
+	})
+	h.Handle("SetBinaryState", func(r *Request) ([]Arg, error) {
+		v, _ := r.Arg("BinaryState")
+		if v != "0" && v != "1" {
+			return nil, ErrArgumentValueInvalid
+		}
+		state = v
+		// Returned out of order, to be sorted by the SCPD
+		return []Arg{{"CountdownEndTime", "0"}, {"BinaryState", state}}, nil
+	})
+	h.Handle("GetFriendlyName", func(r *Request) ([]Arg, error) {
+		return nil, errors.New("no name set")
+	})
+	h.Handle("NotInSCPD", func(r *Request) ([]Arg, error) {
+		return nil, nil
+	})
+	return h
+}
+
+func call(t *testing.T, url, soapAction string, body []byte) (int, *Envelope) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPACTION", soapAction)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	env, err := Decode(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, env
+}
+
+func TestHandler(t *testing.T) {
+	srv := httptest.NewServer(testHandler(t))
+	defer srv.Close()
+
+	invoke := func(action string, args ...Arg) (int, *Envelope) {
+		return call(t, srv.URL, FormatSOAPAction(basicEvent, action), encodeAction(t, basicEvent, action, args))
+	}
+
+	status, env := invoke("SetBinaryState", Arg{"BinaryState", "1"})
+	if status != http.StatusOK || env.Fault != nil {
+		t.Fatalf("unexpected response %d: %#v", status, env.Fault)
+	}
+	if env.Name.Local != "SetBinaryStateResponse" {
+		t.Fatalf("unexpected response element: %s", env.Name.Local)
+	}
+	if len(env.Args) != 2 || env.Args[0].Name != "BinaryState" || env.Args[1].Name != "CountdownEndTime" {
+		t.Fatalf("out arguments not in SCPD order: %v", env.Args)
+	}
+
+	_, env = invoke("GetBinaryState")
+	if v, _ := env.Arg("BinaryState"); v != "1" {
+		t.Fatalf("expected state 1, got %q", v)
+	}
+
+	faults := []struct {
+		name   string
+		action string
+		args   []Arg
+		code   int
+	}{
+		{"unknown action", "Reboot", nil, 401},
+		{"not in scpd", "NotInSCPD", nil, 401},
+		{"unhandled", "Unhandled", nil, 401},
+		{"missing arg", "SetBinaryState", nil, 402},
+		{"extra arg", "GetBinaryState", []Arg{{"BinaryState", "1"}}, 402},
+		{"handler error", "SetBinaryState", []Arg{{"BinaryState", "on"}}, 600},
+		{"handler failure", "GetFriendlyName", nil, 501},
+	}
+	for _, f := range faults {
+		status, env := invoke(f.action, f.args...)
+		if status != http.StatusInternalServerError || env.Fault == nil || env.Fault.Code != f.code {
+			t.Errorf("%s: expected fault %d, got %d %#v", f.name, f.code, status, env.Fault)
+		}
+	}
+
+	// The SOAPACTION header must match the body and the service
+	status, env = call(t, srv.URL, FormatSOAPAction(basicEvent, "GetBinaryState"),
+		encodeAction(t, basicEvent, "SetBinaryState", []Arg{{"BinaryState", "0"}}))
+	if status != http.StatusInternalServerError || env.Fault.Code != 401 {
+		t.Fatalf("expected mismatched action to fail, got %d %#v", status, env.Fault)
+	}
+	status, env = call(t, srv.URL, FormatSOAPAction("urn:Belkin:service:metainfo:1", "GetBinaryState"),
+		encodeAction(t, "urn:Belkin:service:metainfo:1", "GetBinaryState", nil))
+	if status != http.StatusInternalServerError || env.Fault.Code != 401 {
+		t.Fatalf("expected wrong service type to fail, got %d %#v", status, env.Fault)
+	}
+}
+
+func TestHandlerBadRequests(t *testing.T) {
+	srv := httptest.NewServer(testHandler(t))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected GET to be rejected, got %s", resp.Status)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("not xml"))
+	req.Header.Set("SOAPACTION", FormatSOAPAction(basicEvent, "GetBinaryState"))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected malformed envelope to be rejected, got %s", resp.Status)
+	}
+}
+
+func TestHandlerWithoutSCPD(t *testing.T) {
+	var h Handler
+	h.ServiceType = basicEvent
+	h.Handle("Echo", func(r *Request) ([]Arg, error) {
+		return r.Args, nil
+	})
+
+	srv := httptest.NewServer(&h)
+	defer srv.Close()
+
+	args := []Arg{{"A", "1"}, {"B", "2"}}
+	status, env := call(t, srv.URL, FormatSOAPAction(basicEvent, "Echo"), encodeAction(t, basicEvent, "Echo", args))
+	if status != http.StatusOK || len(env.Args) != 2 || env.Args[1] != args[1] {
+		t.Fatalf("unexpected response %d: %#v", status, env)
+	}
+
+	// Out arguments that cannot be written as elements fail the action
+	h.Handle("Bad", func(r *Request) ([]Arg, error) {
+		return []Arg{{"Binary State", "1"}}, nil
+	})
+	status, env = call(t, srv.URL, FormatSOAPAction(basicEvent, "Bad"), encodeAction(t, basicEvent, "Bad", nil))
+	if status != http.StatusInternalServerError || env.Fault == nil || env.Fault.Code != ErrActionFailed.Code {
+		t.Fatalf("expected invalid out argument to fail, got %d %#v", status, env.Fault)
+	}
+}
@@ -0,0 +1,227 @@
+// Package soap implements the SOAP control protocol used by UPnP
+// control points to invoke actions on a service, so that a mock device
+// advertised through minissdpd can be controlled.
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/forfuncsake/minissdpc/internal/xmlname"
+)
+
+// XML namespaces used in control messages
+const (
+	EnvelopeNamespace = "http://schemas.xmlsoap.org/soap/envelope/"
+	EncodingStyle     = "http://schemas.xmlsoap.org/soap/encoding/"
+	ControlNamespace  = "urn:schemas-upnp-org:control-1-0"
+)
+
+var (
+	errNoBody      = errors.New("envelope has no Body")
+	errNoAction    = errors.New("envelope Body has no action element")
+	errInvalidName = errors.New("not a valid XML element name")
+)
+
+// An Arg is a named in or out argument of an action
+type Arg struct {
+	Name  string
+	Value string
+}
+
+// An Error is a UPnP error, returned to the control point in a SOAP fault
+type Error struct {
+	Code        int
+	Description string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("UPnP error %d: %s", e.Code, e.Description)
+}
+
+// Errors defined by the UPnP Device Architecture
+var (
+	ErrInvalidAction           = &Error{401, "Invalid Action"}
+	ErrInvalidArgs             = &Error{402, "Invalid Args"}
+	ErrActionFailed            = &Error{501, "Action Failed"}
+	ErrArgumentValueInvalid    = &Error{600, "Argument Value Invalid"}
+	ErrArgumentValueOutOfRange = &Error{601, "Argument Value Out of Range"}
+	ErrOptionalNotImplemented  = &Error{602, "Optional Action Not Implemented"}
+	ErrOutOfMemory             = &Error{603, "Out of Memory"}
+	ErrHumanIntervention       = &Error{604, "Human Intervention Required"}
+	ErrStringTooLong           = &Error{605, "String Argument Too Long"}
+)
+
+// ParseSOAPAction splits a SOAPACTION header of the form
+// "urn:schemas-upnp-org:service:serviceType:v#actionName"
+// into its service type and action name
+func ParseSOAPAction(header string) (serviceType, action string, ok bool) {
+	header = strings.Trim(strings.TrimSpace(header), `"`)
+	i := strings.LastIndexByte(header, '#')
+	if i <= 0 || i == len(header)-1 {
+		return "", "", false
+	}
+	return header[:i], header[i+1:], true
+}
+
+// FormatSOAPAction returns the quoted SOAPACTION header value
+// for an action of the given service type
+func FormatSOAPAction(serviceType, action string) string {
+	return `"` + serviceType + "#" + action + `"`
+}
+
+// encodeEnvelope writes a complete SOAP envelope with body as
+// the contents of its Body element
+func encodeEnvelope(body func(b *bytes.Buffer)) []byte {
+	b := &bytes.Buffer{}
+	b.WriteString(xml.Header)
+	b.WriteString(`<s:Envelope xmlns:s="` + EnvelopeNamespace + `" s:encodingStyle="` + EncodingStyle + `">`)
+	b.WriteString("<s:Body>")
+	body(b)
+	b.WriteString("</s:Body></s:Envelope>\n")
+	return b.Bytes()
+}
+
+// EncodeAction returns an envelope invoking action with args. The
+// names of the action and its args become element names, so an
+// error is returned if one is not a valid XML name.
+func EncodeAction(serviceType, action string, args []Arg) ([]byte, error) {
+	if !xmlname.Valid(action) {
+		return nil, fmt.Errorf("action %q: %v", action, errInvalidName)
+	}
+	for _, a := range args {
+		if !xmlname.Valid(a.Name) {
+			return nil, fmt.Errorf("argument %q: %v", a.Name, errInvalidName)
+		}
+	}
+	return encodeEnvelope(func(b *bytes.Buffer) {
+		writeAction(b, serviceType, action, args)
+	}), nil
+}
+
+// EncodeResponse returns an envelope holding the out
+// arguments of a successful action
+func EncodeResponse(serviceType, action string, args []Arg) ([]byte, error) {
+	return EncodeAction(serviceType, action+"Response", args)
+}
+
+// EncodeFault returns an envelope reporting e to the control point
+func EncodeFault(e *Error) []byte {
+	return encodeEnvelope(func(b *bytes.Buffer) {
+		b.WriteString("<s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail>")
+		b.WriteString(`<UPnPError xmlns="` + ControlNamespace + `">`)
+		fmt.Fprintf(b, "<errorCode>%d</errorCode><errorDescription>", e.Code)
+		xml.EscapeText(b, []byte(e.Description))
+		b.WriteString("</errorDescription></UPnPError></detail></s:Fault>")
+	})
+}
+
+// writeAction writes the action element. Its names must be valid.
+func writeAction(b *bytes.Buffer, serviceType, action string, args []Arg) {
+	b.WriteString("<u:" + action + ` xmlns:u="`)
+	xml.EscapeText(b, []byte(serviceType))
+	b.WriteString(`">`)
+	for _, a := range args {
+		b.WriteString("<" + a.Name + ">")
+		xml.EscapeText(b, []byte(a.Value))
+		b.WriteString("</" + a.Name + ">")
+	}
+	b.WriteString("</u:" + action + ">")
+}
+
+// An Envelope is the decoded Body of a SOAP message. For an action
+// or its response, Name is the action element and Args its children.
+// For a fault, Fault holds the UPnP error.
+type Envelope struct {
+	Name  xml.Name
+	Args  []Arg
+	Fault *Error
+}
+
+// Arg returns the value of the named argument and
+// whether it was present in the envelope
+func (e *Envelope) Arg(name string) (string, bool) {
+	return findArg(e.Args, name)
+}
+
+func findArg(args []Arg, name string) (string, bool) {
+	for _, a := range args {
+		if a.Name == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// Decode reads a SOAP envelope from r
+func Decode(r io.Reader) (*Envelope, error) {
+	d := xml.NewDecoder(r)
+
+	// Find the Body element
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			return nil, errNoBody
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not decode envelope: %v", err)
+		}
+		if se, ok := t.(xml.StartElement); ok && se.Name.Local == "Body" && se.Name.Space == EnvelopeNamespace {
+			break
+		}
+	}
+
+	// Its first child is the action, response or fault
+	var start xml.StartElement
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return nil, fmt.Errorf("could not decode envelope body: %v", err)
+		}
+		if se, ok := t.(xml.StartElement); ok {
+			start = se
+			break
+		}
+		if _, ok := t.(xml.EndElement); ok {
+			return nil, errNoAction
+		}
+	}
+
+	if start.Name.Local == "Fault" && start.Name.Space == EnvelopeNamespace {
+		var fault struct {
+			FaultString string `xml:"faultstring"`
+			Code        int    `xml:"detail>UPnPError>errorCode"`
+			Description string `xml:"detail>UPnPError>errorDescription"`
+		}
+		if err := d.DecodeElement(&fault, &start); err != nil {
+			return nil, fmt.Errorf("could not decode fault: %v", err)
+		}
+		if fault.Description == "" {
+			fault.Description = fault.FaultString
+		}
+		return &Envelope{
+			Name:  start.Name,
+			Fault: &Error{fault.Code, fault.Description},
+		}, nil
+	}
+
+	var action struct {
+		Args []struct {
+			XMLName xml.Name
+			Value   string `xml:",chardata"`
+		} `xml:",any"`
+	}
+	if err := d.DecodeElement(&action, &start); err != nil {
+		return nil, fmt.Errorf("could not decode action %s: %v", start.Name.Local, err)
+	}
+
+	e := &Envelope{Name: start.Name}
+	for _, a := range action.Args {
+		e.Args = append(e.Args, Arg{a.XMLName.Local, a.Value})
+	}
+	return e, nil
+}
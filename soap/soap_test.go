@@ -0,0 +1,136 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const basicEvent = "urn:Belkin:service:basicevent:1"
+
+func encodeAction(t *testing.T, serviceType, action string, args []Arg) []byte {
+	b, err := EncodeAction(serviceType, action, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestParseSOAPAction(t *testing.T) {
+	tests := []struct {
+		header, serviceType, action string
+		ok                          bool
+	}{
+		{`"urn:Belkin:service:basicevent:1#SetBinaryState"`, basicEvent, "SetBinaryState", true},
+		{`urn:Belkin:service:basicevent:1#GetBinaryState`, basicEvent, "GetBinaryState", true},
+		{` "urn:a:service:b:1#C" `, "urn:a:service:b:1", "C", true},
+		{`"urn:Belkin:service:basicevent:1"`, "", "", false},
+		{`"#SetBinaryState"`, "", "", false},
+		{`"urn:Belkin:service:basicevent:1#"`, "", "", false},
+		{``, "", "", false},
+	}
+
+	for _, test := range tests {
+		st, action, ok := ParseSOAPAction(test.header)
+		if st != test.serviceType || action != test.action || ok != test.ok {
+			t.Errorf("%s: expected (%q, %q, %v), got (%q, %q, %v)",
+				test.header, test.serviceType, test.action, test.ok, st, action, ok)
+		}
+	}
+
+	h := FormatSOAPAction(basicEvent, "SetBinaryState")
+	if st, action, ok := ParseSOAPAction(h); !ok || st != basicEvent || action != "SetBinaryState" {
+		t.Fatalf("could not parse formatted header %s", h)
+	}
+}
+
+func TestEncodeDecodeAction(t *testing.T) {
+	args := []Arg{
+		{"BinaryState", "1"},
+		{"Metadata", `<a href="x">&amp;</a>`},
+		{"Empty", ""},
+	}
+
+	b := encodeAction(t, basicEvent, "SetBinaryState", args)
+	if !bytes.HasPrefix(b, []byte(xml.Header)) {
+		t.Fatal("expected envelope to start with the XML header")
+	}
+	if !bytes.Contains(b, []byte(`<u:SetBinaryState xmlns:u="urn:Belkin:service:basicevent:1">`)) {
+		t.Fatalf("unexpected envelope: %s", b)
+	}
+
+	env, err := Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.Name != (xml.Name{Space: basicEvent, Local: "SetBinaryState"}) {
+		t.Fatalf("unexpected action name: %v", env.Name)
+	}
+	if !reflect.DeepEqual(env.Args, args) {
+		t.Fatalf("expected args %v, got %v", args, env.Args)
+	}
+	if v, ok := env.Arg("BinaryState"); !ok || v != "1" {
+		t.Fatalf("expected BinaryState of 1, got %q", v)
+	}
+	if _, ok := env.Arg("Missing"); ok {
+		t.Fatal("found missing argument")
+	}
+
+	b, err = EncodeResponse(basicEvent, "GetBinaryState", []Arg{{"BinaryState", "0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err = Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.Name.Local != "GetBinaryStateResponse" || env.Fault != nil {
+		t.Fatalf("unexpected response envelope: %#v", env)
+	}
+}
+
+func TestEncodeInvalidName(t *testing.T) {
+	for _, name := range []string{"", "Set State", "<a>", "a>b", "1Action", "-a", "u:Set", `a"b`} {
+		if _, err := EncodeAction(basicEvent, name, nil); err == nil {
+			t.Errorf("expected error for action %q", name)
+		}
+		if _, err := EncodeAction(basicEvent, "Set", []Arg{{name, "1"}}); err == nil {
+			t.Errorf("expected error for argument %q", name)
+		}
+	}
+	for _, name := range []string{"SetBinaryState", "_a", "A-1.b", "Größe"} {
+		if _, err := EncodeAction(basicEvent, name, []Arg{{name, "1"}}); err != nil {
+			t.Errorf("%q: %v", name, err)
+		}
+	}
+}
+
+func TestEncodeDecodeFault(t *testing.T) {
+	b := EncodeFault(&Error{402, "Invalid <Args>"})
+	env, err := Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.Fault == nil || *env.Fault != (Error{402, "Invalid <Args>"}) {
+		t.Fatalf("unexpected fault: %#v", env.Fault)
+	}
+	if env.Fault.Error() != "UPnP error 402: Invalid <Args>" {
+		t.Fatalf("unexpected error string: %s", env.Fault.Error())
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for _, doc := range []string{
+		``,
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"></s:Envelope>`,
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body></s:Body></s:Envelope>`,
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><u:A xmlns:u="x"><B>`,
+		`<Envelope><Body><A/></Body></Envelope>`,
+	} {
+		if _, err := Decode(strings.NewReader(doc)); err == nil {
+			t.Errorf("expected error decoding %q", doc)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package minissdpc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// MaxRequestLength is the size of the buffer minissdpd reads a
+// request into. Requests larger than this are rejected by the daemon.
+const MaxRequestLength = 2048
+
+// NTRootDevice is the notification type advertised once for each
+// root device
+const NTRootDevice = "upnp:rootdevice"
+
+var (
+	errEmpty            = errors.New("must not be empty")
+	errInvalidNT        = errors.New("not a valid notification type")
+	errUSNMismatch      = errors.New("does not match the service type")
+	errInvalidURL       = errors.New("not an absolute http(s) URL with a host")
+	errLoopbackLocation = errors.New("loopback address is not reachable from other hosts")
+	errRequestTooLong   = fmt.Errorf("encoded service exceeds %d bytes", MaxRequestLength)
+)
+
+// A ValidationError describes a problem found with a single
+// field of a Service
+type ValidationError struct {
+	Field string
+	Value string
+	Err   error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s %q: %v", e.Field, e.Value, e.Err)
+}
+
+// Validate checks that the service is suitable for registration
+// with minissdpd: all fields are present, the Type is a valid NT,
+// the USN matches the Type and the Location is an absolute http(s)
+// URL that can be reached by other hosts on the LAN.
+// The returned error will be a *ValidationError.
+func (s *Service) Validate() error {
+	return s.validate(false)
+}
+
+// ValidateAllowLoopback is Validate, but accepts a Location on a
+// loopback address, for a service only meant for clients running
+// on the same host
+func (s *Service) ValidateAllowLoopback() error {
+	return s.validate(true)
+}
+
+func (s *Service) validate(allowLoopback bool) error {
+	for _, f := range []struct {
+		name, value string
+	}{
+		{"type", s.Type},
+		{"usn", s.USN},
+		{"server", s.Server},
+		{"location", s.Location},
+	} {
+		if f.value == "" {
+			return &ValidationError{f.name, f.value, errEmpty}
+		}
+	}
+
+	if !validNT(s.Type) {
+		return &ValidationError{"type", s.Type, errInvalidNT}
+	}
+	if !usnMatches(s.USN, s.Type) {
+		return &ValidationError{"usn", s.USN, errUSNMismatch}
+	}
+
+	u, err := url.Parse(s.Location)
+	if err != nil || !u.IsAbs() || u.Hostname() == "" ||
+		(u.Scheme != "http" && u.Scheme != "https") {
+		return &ValidationError{"location", s.Location, errInvalidURL}
+	}
+	if !allowLoopback && isLoopback(u.Hostname()) {
+		return &ValidationError{"location", s.Location, errLoopbackLocation}
+	}
+
+	if s.encodedLen()+1 > MaxRequestLength {
+		return &ValidationError{"service", s.USN, errRequestTooLong}
+	}
+
+	return nil
+}
+
+// validNT reports whether t is one of the notification types
+// defined by the UPnP Device Architecture:
+// upnp:rootdevice, uuid:<id>, urn:<domain>:device:<type>:<ver>
+// or urn:<domain>:service:<type>:<ver>
+func validNT(t string) bool {
+	if t == NTRootDevice {
+		return true
+	}
+	if strings.HasPrefix(t, "uuid:") {
+		return len(t) > len("uuid:") && !strings.Contains(t, "::")
+	}
+
+	// Split into a fixed array, as validation runs on every register
+	var parts [5]string
+	rest := t
+	for i := range parts[:4] {
+		j := strings.IndexByte(rest, ':')
+		if j < 0 {
+			return false
+		}
+		parts[i], rest = rest[:j], rest[j+1:]
+	}
+	parts[4] = rest
+	if parts[0] != "urn" || strings.IndexByte(rest, ':') >= 0 {
+		return false
+	}
+	if parts[2] != "device" && parts[2] != "service" {
+		return false
+	}
+	if parts[1] == "" || parts[3] == "" {
+		return false
+	}
+	_, err := strconv.ParseUint(parts[4], 10, 32)
+	return err == nil
+}
+
+// usnMatches reports whether usn is the correct unique service
+// name for a service of type t, which is either the uuid itself
+// or uuid:<id>::<type>
+func usnMatches(usn, t string) bool {
+	if strings.HasPrefix(t, "uuid:") {
+		return usn == t
+	}
+	if !strings.HasPrefix(usn, "uuid:") || !strings.HasSuffix(usn, "::"+t) {
+		return false
+	}
+	return validNT(strings.TrimSuffix(usn, "::"+t))
+}
+
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
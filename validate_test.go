@@ -0,0 +1,101 @@
+package minissdpc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestServiceValidate(t *testing.T) {
+	valid := Service{
+		Type:     "urn:Belkin:device:controllee:1",
+		USN:      "uuid:Socket-1_0-221517K0101769::urn:Belkin:device:controllee:1",
+		Server:   "Unspecified, UPnP/1.0, Unspecified",
+		Location: "http://192.168.1.10:49153/setup.xml",
+	}
+
+	tests := []struct {
+		name   string
+		modify func(s *Service)
+		field  string
+		err    error
+	}{
+		{"valid", func(s *Service) {}, "", nil},
+		{"rootdevice", func(s *Service) {
+			s.Type = NTRootDevice
+			s.USN = "uuid:Socket-1_0-221517K0101769::upnp:rootdevice"
+		}, "", nil},
+		{"uuid", func(s *Service) {
+			s.Type = "uuid:Socket-1_0-221517K0101769"
+			s.USN = s.Type
+		}, "", nil},
+		{"service type", func(s *Service) {
+			s.Type = "urn:Belkin:service:basicevent:1"
+			s.USN = "uuid:Socket-1_0-221517K0101769::urn:Belkin:service:basicevent:1"
+		}, "", nil},
+		{"https", func(s *Service) { s.Location = "https://nas.local/setup.xml" }, "", nil},
+		{"empty type", func(s *Service) { s.Type = "" }, "type", errEmpty},
+		{"empty usn", func(s *Service) { s.USN = "" }, "usn", errEmpty},
+		{"empty server", func(s *Service) { s.Server = "" }, "server", errEmpty},
+		{"empty location", func(s *Service) { s.Location = "" }, "location", errEmpty},
+		{"bad nt", func(s *Service) { s.Type = "Belkin controllee" }, "type", errInvalidNT},
+		{"bad urn kind", func(s *Service) { s.Type = "urn:Belkin:thing:controllee:1" }, "type", errInvalidNT},
+		{"bad urn version", func(s *Service) { s.Type = "urn:Belkin:device:controllee:v1" }, "type", errInvalidNT},
+		{"usn without uuid", func(s *Service) { s.USN = "Socket-1_0-221517K0101769" }, "usn", errUSNMismatch},
+		{"usn wrong type", func(s *Service) {
+			s.USN = "uuid:Socket-1_0-221517K0101769::urn:Belkin:device:sensor:1"
+		}, "usn", errUSNMismatch},
+		{"uuid usn mismatch", func(s *Service) {
+			s.Type = "uuid:Socket-1_0-221517K0101769"
+			s.USN = "uuid:Socket-1_0-221517K0101770"
+		}, "usn", errUSNMismatch},
+		{"relative location", func(s *Service) { s.Location = "/setup.xml" }, "location", errInvalidURL},
+		{"ftp location", func(s *Service) { s.Location = "ftp://192.168.1.10/setup.xml" }, "location", errInvalidURL},
+		{"no host", func(s *Service) { s.Location = "http:///setup.xml" }, "location", errInvalidURL},
+		{"loopback", func(s *Service) { s.Location = "http://127.0.0.1:8080/setup.xml" }, "location", errLoopbackLocation},
+		{"loopback v6", func(s *Service) { s.Location = "http://[::1]:8080/setup.xml" }, "location", errLoopbackLocation},
+		{"localhost", func(s *Service) { s.Location = "http://localhost/setup.xml" }, "location", errLoopbackLocation},
+		{"too long", func(s *Service) { s.Server = strings.Repeat("x", MaxRequestLength) }, "service", errRequestTooLong},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := valid
+			test.modify(&s)
+
+			err := s.Validate()
+			if test.err == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			verr, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("expected *ValidationError, got %v", err)
+			}
+			if verr.Field != test.field || verr.Err != test.err {
+				t.Fatalf("expected %s error %q, got %s error %q", test.field, test.err, verr.Field, verr.Err)
+			}
+		})
+	}
+}
+
+func TestServiceValidateAllowLoopback(t *testing.T) {
+	s := Service{
+		Type:     "urn:Belkin:device:controllee:1",
+		USN:      "uuid:Socket-1_0-221517K0101769::urn:Belkin:device:controllee:1",
+		Server:   "Unspecified, UPnP/1.0, Unspecified",
+		Location: "http://127.0.0.1:49153/setup.xml",
+	}
+	if err := s.ValidateAllowLoopback(); err != nil {
+		t.Fatalf("expected a loopback location to be allowed, got %v", err)
+	}
+
+	// Everything else is still checked
+	s.Location = "ftp://127.0.0.1/setup.xml"
+	err := s.ValidateAllowLoopback()
+	if verr, ok := err.(*ValidationError); !ok || verr.Err != errInvalidURL {
+		t.Fatalf("expected %v, got %v", errInvalidURL, err)
+	}
+}
@@ -0,0 +1,270 @@
+package minissdpc
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// DefaultWatchInterval is how often a Watcher polls minissdpd when
+// notifications are not available, unless Interval is set
+const DefaultWatchInterval = time.Second
+
+// ChangeType identifies what a Change reports
+type ChangeType int
+
+// Types of changes reported by a Watcher
+const (
+	ChangeAdded ChangeType = iota
+	ChangeRemoved
+	ChangeUpdated
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeUpdated:
+		return "updated"
+	}
+	return "unknown"
+}
+
+// A Change is a service appearing, disappearing or changing
+type Change struct {
+	Type    ChangeType
+	Service Service
+	Time    time.Time
+}
+
+// A Watcher reports changes to the services known to minissdpd.
+// It uses notifications when the server supports them, and otherwise
+// compares the full list of services at every interval.
+type Watcher struct {
+	SocketPath string
+
+	// Interval is the time between polls
+	Interval time.Duration
+
+	// Poll disables the use of notifications
+	Poll bool
+
+	// OnStart, if set, is called once Watch has probed the server,
+	// with its version, or "" if the services are polled
+	OnStart func(version string)
+
+	now func() time.Time
+}
+
+// serviceKey identifies a service as minissdpd does
+type serviceKey struct {
+	usn, typ string
+}
+
+func keyOf(s Service) serviceKey {
+	return serviceKey{s.USN, s.Type}
+}
+
+// Watch sends a ChangeAdded for every service currently known, then
+// a Change for every change, until ctx is done or an error occurs.
+// It returns ctx.Err() or the error.
+func (w *Watcher) Watch(ctx context.Context, changes chan<- Change) error {
+	if w.now == nil {
+		w.now = time.Now
+	}
+
+	var notify *Client
+	var version string
+	if !w.Poll {
+		// Subscribe before listing the current services,
+		// so that no change is missed in between
+		notify = &Client{SocketPath: w.SocketPath}
+		if err := notify.Connect(); err != nil {
+			return err
+		}
+		defer notify.Close()
+
+		var err error
+		version, err = notify.subscribe()
+		if err == errNotSupported {
+			// The daemon may have dropped the connection, so
+			// polling is done on a new one
+			notify.Close()
+			notify = nil
+		} else if err != nil {
+			return err
+		}
+	}
+	if w.OnStart != nil {
+		w.OnStart(version)
+	}
+
+	c := &Client{SocketPath: w.SocketPath}
+	if err := c.Connect(); err != nil {
+		return err
+	}
+	defer c.Close()
+
+	known := make(map[serviceKey]Service)
+	services, err := c.GetServicesAll()
+	if err != nil {
+		return err
+	}
+	if err := w.update(ctx, known, services, changes); err != nil {
+		return err
+	}
+
+	if notify != nil {
+		c.Close()
+		return w.watchNotifications(ctx, notify, known, changes)
+	}
+	return w.poll(ctx, c, known, changes)
+}
+
+func (w *Watcher) poll(ctx context.Context, c *Client, known map[serviceKey]Service, changes chan<- Change) error {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		services, err := c.GetServicesAll()
+		if err != nil {
+			return err
+		}
+		if err := w.update(ctx, known, services, changes); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *Watcher) watchNotifications(ctx context.Context, c *Client, known map[serviceKey]Service, changes chan<- Change) error {
+	type result struct {
+		n   Notification
+		err error
+	}
+	results := make(chan result)
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			n, err := c.ReadNotification()
+			select {
+			case results <- result{n, err}:
+			case <-quit:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// Closing the connection ends the blocked read
+	defer func() {
+		close(quit)
+		c.conn.Close()
+		<-done
+	}()
+
+	for {
+		var r result
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case r = <-results:
+		}
+		if r.err != nil {
+			return r.err
+		}
+
+		s := r.n.Service
+		old, exists := known[keyOf(s)]
+		change := Change{Service: s, Time: w.now()}
+		switch {
+		case r.n.Type == NotifyRemove:
+			if !exists {
+				continue
+			}
+			delete(known, keyOf(s))
+			change.Type = ChangeRemoved
+		case !exists:
+			known[keyOf(s)] = s
+			change.Type = ChangeAdded
+		case old != s:
+			known[keyOf(s)] = s
+			change.Type = ChangeUpdated
+		default:
+			// A renewed advertisement
+			continue
+		}
+
+		if err := send(ctx, changes, change); err != nil {
+			return err
+		}
+	}
+}
+
+// update replaces known with services, sending the differences
+func (w *Watcher) update(ctx context.Context, known map[serviceKey]Service, services []Service, changes chan<- Change) error {
+	now := w.now()
+	current := make(map[serviceKey]bool, len(services))
+	for _, s := range services {
+		k := keyOf(s)
+		current[k] = true
+		old, exists := known[k]
+		known[k] = s
+
+		var err error
+		switch {
+		case !exists:
+			err = send(ctx, changes, Change{ChangeAdded, s, now})
+		case old != s:
+			err = send(ctx, changes, Change{ChangeUpdated, s, now})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Removals are sorted for stable output
+	var removed []Service
+	for k, s := range known {
+		if !current[k] {
+			delete(known, k)
+			removed = append(removed, s)
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool {
+		if removed[i].USN != removed[j].USN {
+			return removed[i].USN < removed[j].USN
+		}
+		return removed[i].Type < removed[j].Type
+	})
+	for _, s := range removed {
+		if err := send(ctx, changes, Change{ChangeRemoved, s, now}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func send(ctx context.Context, changes chan<- Change, c Change) error {
+	select {
+	case changes <- c:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
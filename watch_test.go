@@ -0,0 +1,163 @@
+package minissdpc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/forfuncsake/minissdpc"
+	"github.com/forfuncsake/minissdpc/mock"
+)
+
+// expectChange waits for the next change, checking its type and USN
+func expectChange(t *testing.T, changes <-chan minissdpc.Change, typ minissdpc.ChangeType, s minissdpc.Service) minissdpc.Change {
+	select {
+	case c := <-changes:
+		if c.Type != typ || c.Service.USN != s.USN || c.Service.Location != s.Location {
+			t.Fatalf("expected %s %s at %s, got %s %s at %s",
+				typ, s.USN, s.Location, c.Type, c.Service.USN, c.Service.Location)
+		}
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s %s", typ, s.USN)
+	}
+	return minissdpc.Change{}
+}
+
+// oldDaemon configures a server as a minissdpd that predates
+// notifications, closing the connection on requests for them if
+// closeUnknown is set
+func oldDaemon(closeUnknown bool) func(*mock.Server) {
+	return func(s *mock.Server) {
+		s.Version = ""
+		s.CloseUnknown = closeUnknown
+	}
+}
+
+func testWatcher(t *testing.T, configure func(*mock.Server), poll bool) {
+	d := newDaemon(t, configure)
+	defer d.close()
+
+	services := testDevice("http://192.168.1.10/setup.xml")
+	d.Register(services[0])
+	d.Register(services[1])
+
+	versions := make(chan string, 1)
+	w := &minissdpc.Watcher{
+		SocketPath: d.path,
+		Interval:   10 * time.Millisecond,
+		Poll:       poll,
+		OnStart:    func(version string) { versions <- version },
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan minissdpc.Change)
+	done := make(chan error)
+	go func() {
+		done <- w.Watch(ctx, changes)
+	}()
+
+	// The current services are reported first
+	expectChange(t, changes, minissdpc.ChangeAdded, services[0])
+	expectChange(t, changes, minissdpc.ChangeAdded, services[1])
+
+	// Only the default server is asked for notifications
+	version := <-versions
+	if notify := configure == nil && !poll; notify != (version != "") {
+		t.Fatalf("unexpected version %q reported to OnStart", version)
+	}
+
+	d.Register(services[2])
+	expectChange(t, changes, minissdpc.ChangeAdded, services[2])
+
+	moved := services[1]
+	moved.Location = "http://192.168.1.11/setup.xml"
+	d.Register(moved)
+	expectChange(t, changes, minissdpc.ChangeUpdated, moved)
+
+	d.Remove(services[0])
+	expectChange(t, changes, minissdpc.ChangeRemoved, services[0])
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch did not return after cancel")
+	}
+}
+
+func TestWatchNotifications(t *testing.T) {
+	testWatcher(t, nil, false)
+}
+
+func TestWatchPollFallback(t *testing.T) {
+	testWatcher(t, oldDaemon(false), false)
+}
+
+func TestWatchPollFallbackDropped(t *testing.T) {
+	testWatcher(t, oldDaemon(true), false)
+}
+
+func TestWatchPoll(t *testing.T) {
+	testWatcher(t, nil, true)
+}
+
+func TestClientVersion(t *testing.T) {
+	d := newDaemon(t, oldDaemon(false))
+	defer d.close()
+
+	c := &minissdpc.Client{SocketPath: d.path}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	v, err := c.Version()
+	if err != nil || v != "" {
+		t.Fatalf("expected no version, got %q, %v", v, err)
+	}
+	if err := c.Subscribe(); err != minissdpc.ErrNotSupported {
+		t.Fatalf("expected ErrNotSupported, got %v", err)
+	}
+	if _, err := c.ReadNotification(); err != minissdpc.ErrNotSubscribed {
+		t.Fatalf("expected ErrNotSubscribed, got %v", err)
+	}
+
+	// The same client finds the version once the daemon is upgraded
+	c.Close()
+	d.configure = nil
+	d.restart(t)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	v, err = c.Version()
+	if err != nil || v != mock.DefaultVersion {
+		t.Fatalf("expected version %s, got %q, %v", mock.DefaultVersion, v, err)
+	}
+}
+
+func TestClientVersionDropped(t *testing.T) {
+	d := newDaemon(t, oldDaemon(true))
+	defer d.close()
+
+	c := &minissdpc.Client{SocketPath: d.path}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	v, err := c.Version()
+	if err != nil || v != "" {
+		t.Fatalf("expected no version, got %q, %v", v, err)
+	}
+
+	// Connect fails on a client that is still connected
+	if err := c.Connect(); err != nil {
+		t.Fatalf("dropped connection was not closed: %v", err)
+	}
+	if err := c.Subscribe(); err != minissdpc.ErrNotSupported {
+		t.Fatalf("expected ErrNotSupported, got %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+// Package wemo emulates Belkin Wemo switches, so that Go code (or a
+// shell command) can be controlled by anything that speaks to Wemo
+// devices, such as Alexa or Home Assistant. Each Switch is advertised
+// through minissdpd and serves the setup.xml, SCPD, control and event
+// endpoints that Wemo clients expect.
+package wemo
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/forfuncsake/minissdpc"
+	"github.com/forfuncsake/minissdpc/description"
+	"github.com/forfuncsake/minissdpc/gena"
+	"github.com/forfuncsake/minissdpc/soap"
+)
+
+// Types and paths used by Wemo switches
+const (
+	DeviceType     = "urn:Belkin:device:controllee:1"
+	BasicEventType = "urn:Belkin:service:basicevent:1"
+
+	SetupPath     = "/setup.xml"
+	EventSCPDPath = "/eventservice.xml"
+	ControlPath   = "/upnp/control/basicevent1"
+	EventSubPath  = "/upnp/event/basicevent1"
+)
+
+// DefaultServer is the SERVER header advertised by real Wemo devices
+const DefaultServer = "Unspecified, UPnP/1.0, Unspecified"
+
+const binaryStateVar = "BinaryState"
+
+// basicEvent declares the subset of the Wemo basicevent service
+// that clients use to switch a device and follow its state
+var basicEvent = description.ServiceDefinition{
+	ServiceType: BasicEventType,
+	ServiceID:   "urn:Belkin:serviceId:basicevent1",
+	SCPDURL:     EventSCPDPath,
+	ControlURL:  ControlPath,
+	EventSubURL: EventSubPath,
+	Actions: []description.ActionDefinition{
+		{Name: "GetBinaryState", Out: []description.Arg{{Name: binaryStateVar}}},
+		{
+			Name: "SetBinaryState",
+			In:   []description.Arg{{Name: binaryStateVar}},
+			Out:  []description.Arg{{Name: binaryStateVar}},
+		},
+		{Name: "GetFriendlyName", Out: []description.Arg{{Name: "FriendlyName"}}},
+	},
+	Variables: []description.StateVariable{
+		{SendEvents: description.SendEventsYes, Name: binaryStateVar, DataType: "boolean", DefaultValue: "0"},
+		{SendEvents: description.SendEventsNo, Name: "FriendlyName", DataType: "string"},
+	},
+}
+
+// A Switch is a virtual Wemo switch. It must be created with NewSwitch.
+type Switch struct {
+	Name   string
+	Serial string
+
+	// OnChange is called when a client switches the device on or off.
+	// If it returns an error, the client is told the action failed
+	// and the state is left unchanged.
+	OnChange func(on bool) error
+
+	// changing is held while a client changes the state, so that
+	// OnChange calls do not overlap. mu guards the state itself and
+	// is never held while OnChange runs, so a slow hook does not
+	// block other requests.
+	changing sync.Mutex
+	mu       sync.Mutex
+	on       bool
+	root     *description.Root
+	events   *gena.Server
+}
+
+// NewSwitch returns a switch with the given friendly name. If serial
+// is empty, one is derived from the name so that the device keeps
+// the same identity across restarts.
+func NewSwitch(name, serial string, onChange func(on bool) error) (*Switch, error) {
+	if serial == "" {
+		serial = SerialFromName(name)
+	}
+
+	svc, err := basicEvent.Service()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Switch{
+		Name:     name,
+		Serial:   serial,
+		OnChange: onChange,
+		events:   gena.NewServer(gena.Property{Name: binaryStateVar, Value: "0"}),
+	}
+	s.root = description.New(description.Device{
+		DeviceType:       DeviceType,
+		FriendlyName:     name,
+		Manufacturer:     "Belkin International Inc.",
+		ManufacturerURL:  "http://www.belkin.com",
+		ModelDescription: "Belkin Plugin Socket 1.0",
+		ModelName:        "Socket",
+		ModelNumber:      "1.0",
+		ModelURL:         "http://www.belkin.com/plugin/",
+		SerialNumber:     serial,
+		UDN:              s.UDN(),
+		Services:         []description.Service{svc},
+		Extra: []description.Element{
+			{XMLName: xml.Name{Local: "macAddress"}, Value: macAddress(serial)},
+			{XMLName: xml.Name{Local: "firmwareVersion"}, Value: "WeMo_WW_2.00.11057.PVT-OWRT-SNS"},
+		},
+	})
+	s.root.Path = SetupPath
+	return s, nil
+}
+
+// SerialFromName derives a stable 14 character serial number from a name
+func SerialFromName(name string) string {
+	sum := sha1.Sum([]byte(name))
+	return strings.ToUpper(hex.EncodeToString(sum[:7]))
+}
+
+// macAddress derives a Belkin prefixed MAC address from the serial
+func macAddress(serial string) string {
+	sum := sha1.Sum([]byte(serial))
+	return "94103E" + strings.ToUpper(hex.EncodeToString(sum[:3]))
+}
+
+// UDN returns the unique device name of the switch
+func (s *Switch) UDN() string {
+	return "uuid:Socket-1_0-" + s.Serial
+}
+
+// On reports whether the switch is on
+func (s *Switch) On() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.on
+}
+
+// Set changes the state of the switch locally, without calling
+// OnChange, and notifies any subscribed clients
+func (s *Switch) Set(on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set(on)
+}
+
+// set must be called with s.mu held
+func (s *Switch) set(on bool) {
+	if s.on == on {
+		return
+	}
+	s.on = on
+	s.events.Set(gena.Property{Name: binaryStateVar, Value: binaryState(on)})
+}
+
+// Handler returns the handler for all of the switch's HTTP endpoints
+func (s *Switch) Handler() (http.Handler, error) {
+	mux, err := s.root.ServeMux()
+	if err != nil {
+		return nil, err
+	}
+
+	control := soap.NewHandler(BasicEventType, s.root.Device.Services[0].SCPD)
+	control.Handle("GetBinaryState", s.getBinaryState)
+	control.Handle("SetBinaryState", s.setBinaryState)
+	control.Handle("GetFriendlyName", s.getFriendlyName)
+
+	mux.Handle(ControlPath, control)
+	mux.Handle(EventSubPath, s.events)
+	return mux, nil
+}
+
+// Services returns the SSDP entries that advertise the switch, with
+// baseURL being the scheme and host the switch is served on
+func (s *Switch) Services(baseURL, server string) ([]minissdpc.Service, error) {
+	if server == "" {
+		server = DefaultServer
+	}
+	return s.root.Services(baseURL, server)
+}
+
+// Register registers all of the switch's SSDP entries with minissdpd
+func (s *Switch) Register(c *minissdpc.Client, baseURL, server string) error {
+	services, err := s.Services(baseURL, server)
+	if err != nil {
+		return err
+	}
+	for _, svc := range services {
+		if err := c.RegisterService(svc); err != nil {
+			return fmt.Errorf("could not register %s: %v", svc.USN, err)
+		}
+	}
+	return nil
+}
+
+// Close ends all event subscriptions to the switch
+func (s *Switch) Close() {
+	s.events.Close()
+}
+
+func (s *Switch) getBinaryState(r *soap.Request) ([]soap.Arg, error) {
+	return []soap.Arg{{Name: binaryStateVar, Value: binaryState(s.On())}}, nil
+}
+
+func (s *Switch) setBinaryState(r *soap.Request) ([]soap.Arg, error) {
+	v, _ := r.Arg(binaryStateVar)
+	var on bool
+	switch v {
+	case "0":
+	case "1":
+		on = true
+	default:
+		return nil, soap.ErrArgumentValueInvalid
+	}
+
+	s.changing.Lock()
+	defer s.changing.Unlock()
+
+	if s.On() != on && s.OnChange != nil {
+		if err := s.OnChange(on); err != nil {
+			return nil, err
+		}
+	}
+
+	// set does nothing if Set has already made the same change
+	s.mu.Lock()
+	s.set(on)
+	s.mu.Unlock()
+	return []soap.Arg{{Name: binaryStateVar, Value: binaryState(on)}}, nil
+}
+
+func (s *Switch) getFriendlyName(r *soap.Request) ([]soap.Arg, error) {
+	return []soap.Arg{{Name: "FriendlyName", Value: s.Name}}, nil
+}
+
+func binaryState(on bool) string {
+	if on {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,300 @@
+package wemo
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forfuncsake/minissdpc"
+	"github.com/forfuncsake/minissdpc/description"
+	"github.com/forfuncsake/minissdpc/gena"
+	"github.com/forfuncsake/minissdpc/soap"
+)
+
+func newTestSwitch(t *testing.T, onChange func(bool) error) (*Switch, *httptest.Server) {
+	s, err := NewSwitch("Lamp", "", onChange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := s.Handler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, httptest.NewServer(h)
+}
+
+func invoke(t *testing.T, url, action string, args ...soap.Arg) *soap.Envelope {
+	body, err := soap.EncodeAction(BasicEventType, action, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, url+ControlPath, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("SOAPACTION", soap.FormatSOAPAction(BasicEventType, action))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	env, err := soap.Decode(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func TestSetupXML(t *testing.T) {
+	s, srv := newTestSwitch(t, nil)
+	defer srv.Close()
+	defer s.Close()
+
+	for _, path := range []string{SetupPath, EventSCPDPath} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: unexpected status %s", path, resp.Status)
+		}
+
+		if path == SetupPath {
+			root, err := description.Parse(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := root.Device
+			if d.DeviceType != DeviceType || d.FriendlyName != "Lamp" || d.UDN != s.UDN() {
+				t.Fatalf("unexpected device: %#v", d)
+			}
+			if len(d.Services) != 1 || d.Services[0].ControlURL != ControlPath {
+				t.Fatalf("unexpected services: %#v", d.Services)
+			}
+			continue
+		}
+
+		scpd, err := description.ParseSCPD(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if scpd.Action("SetBinaryState") == nil {
+			t.Fatal("SCPD has no SetBinaryState action")
+		}
+	}
+}
+
+func TestBinaryState(t *testing.T) {
+	var changes []bool
+	fail := false
+	s, srv := newTestSwitch(t, func(on bool) error {
+		if fail {
+			return errors.New("relay stuck")
+		}
+		changes = append(changes, on)
+		return nil
+	})
+	defer srv.Close()
+	defer s.Close()
+
+	env := invoke(t, srv.URL, "SetBinaryState", soap.Arg{Name: "BinaryState", Value: "1"})
+	if v, _ := env.Arg("BinaryState"); env.Fault != nil || v != "1" {
+		t.Fatalf("unexpected response to SetBinaryState: %#v", env)
+	}
+	if !s.On() {
+		t.Fatal("switch is not on")
+	}
+
+	env = invoke(t, srv.URL, "GetBinaryState")
+	if v, _ := env.Arg("BinaryState"); v != "1" {
+		t.Fatalf("expected state 1, got %q", v)
+	}
+
+	// Setting the same state again does not call OnChange
+	invoke(t, srv.URL, "SetBinaryState", soap.Arg{Name: "BinaryState", Value: "1"})
+	invoke(t, srv.URL, "SetBinaryState", soap.Arg{Name: "BinaryState", Value: "0"})
+	if len(changes) != 2 || !changes[0] || changes[1] {
+		t.Fatalf("unexpected OnChange calls: %v", changes)
+	}
+
+	fail = true
+	env = invoke(t, srv.URL, "SetBinaryState", soap.Arg{Name: "BinaryState", Value: "1"})
+	if env.Fault == nil || env.Fault.Code != soap.ErrActionFailed.Code {
+		t.Fatalf("expected action failure, got %#v", env)
+	}
+	if s.On() {
+		t.Fatal("state changed despite OnChange error")
+	}
+
+	env = invoke(t, srv.URL, "SetBinaryState", soap.Arg{Name: "BinaryState", Value: "on"})
+	if env.Fault == nil || env.Fault.Code != soap.ErrArgumentValueInvalid.Code {
+		t.Fatalf("expected invalid argument fault, got %#v", env)
+	}
+
+	env = invoke(t, srv.URL, "GetFriendlyName")
+	if v, _ := env.Arg("FriendlyName"); v != "Lamp" {
+		t.Fatalf("expected friendly name Lamp, got %q", v)
+	}
+}
+
+func TestSlowOnChange(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s, srv := newTestSwitch(t, func(on bool) error {
+		close(started)
+		<-release
+		return nil
+	})
+	defer srv.Close()
+	defer s.Close()
+
+	done := make(chan error)
+	go func() {
+		_, err := soap.Invoke(nil, srv.URL+ControlPath, BasicEventType, "SetBinaryState",
+			[]soap.Arg{{Name: "BinaryState", Value: "1"}})
+		done <- err
+	}()
+	<-started
+
+	// Other requests are answered while OnChange runs
+	env := invoke(t, srv.URL, "GetBinaryState")
+	if v, _ := env.Arg("BinaryState"); v != "0" {
+		t.Fatalf("expected state 0 while OnChange runs, got %q", v)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if !s.On() {
+		t.Fatal("switch is not on after OnChange returned")
+	}
+}
+
+func TestEvents(t *testing.T) {
+	s, srv := newTestSwitch(t, nil)
+	defer srv.Close()
+	defer s.Close()
+
+	states := make(chan string, 10)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		props, err := gena.DecodePropertySet(req.Body)
+		if err != nil || len(props) != 1 {
+			t.Errorf("unexpected NOTIFY: %v %v", props, err)
+			return
+		}
+		states <- props[0].Value
+	}))
+	defer callback.Close()
+
+	req, _ := http.NewRequest("SUBSCRIBE", srv.URL+EventSubPath, nil)
+	req.Header.Set("CALLBACK", "<"+callback.URL+">")
+	req.Header.Set("NT", "upnp:event")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("subscribe failed: %s", resp.Status)
+	}
+
+	// Each change is awaited, as changes made while a NOTIFY is
+	// being sent are merged into the next one
+	expectState := func(expect string) {
+		select {
+		case v := <-states:
+			if v != expect {
+				t.Fatalf("expected state %s, got %s", expect, v)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for NOTIFY")
+		}
+	}
+	expectState("0")
+	invoke(t, srv.URL, "SetBinaryState", soap.Arg{Name: "BinaryState", Value: "1"})
+	expectState("1")
+	s.Set(false)
+	expectState("0")
+}
+
+func TestRegister(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wemo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "minissdpd.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	received := make(chan []byte)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		b, _ := ioutil.ReadAll(conn)
+		received <- b
+	}()
+
+	s, err := NewSwitch("Lamp", "221517K0101769", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	c := &minissdpc.Client{SocketPath: path}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register(c, "http://192.168.1.10:49153/", ""); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	b := <-received
+	services, err := s.Services("http://192.168.1.10:49153", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 4 {
+		t.Fatalf("expected 4 services, got %d", len(services))
+	}
+	for _, svc := range services {
+		if svc.Location != "http://192.168.1.10:49153/setup.xml" || svc.Server != DefaultServer {
+			t.Fatalf("unexpected service %v", svc)
+		}
+		if !bytes.Contains(b, []byte(svc.USN)) {
+			t.Errorf("%s was not registered", svc.USN)
+		}
+	}
+	if !strings.Contains(string(b), "uuid:Socket-1_0-221517K0101769::urn:Belkin:device:controllee:1") {
+		t.Fatal("controllee USN was not registered")
+	}
+}
+
+func TestSerialFromName(t *testing.T) {
+	a, b := SerialFromName("Lamp"), SerialFromName("Fan")
+	if len(a) != 14 || a == b || a != SerialFromName("Lamp") {
+		t.Fatalf("unexpected serials %q and %q", a, b)
+	}
+}